@@ -0,0 +1,96 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/aarzilli/gdlv/internal/dlvclient/service/api"
+)
+
+func isBookmarked(file string, lineno int) bool {
+	for _, l := range conf.Bookmarks[file] {
+		if l == lineno {
+			return true
+		}
+	}
+	return false
+}
+
+func toggleBookmark(file string, lineno int) {
+	if conf.Bookmarks == nil {
+		conf.Bookmarks = make(map[string][]int)
+	}
+	lines := conf.Bookmarks[file]
+	for i, l := range lines {
+		if l == lineno {
+			lines = append(lines[:i], lines[i+1:]...)
+			if len(lines) == 0 {
+				delete(conf.Bookmarks, file)
+			} else {
+				conf.Bookmarks[file] = lines
+			}
+			saveConfiguration()
+			return
+		}
+	}
+	lines = append(lines, lineno)
+	sort.Ints(lines)
+	conf.Bookmarks[file] = lines
+	saveConfiguration()
+}
+
+// nextBookmark returns the bookmark following (dir > 0) or preceding
+// (dir < 0) file:lineno, bookmarks are ordered by file name and line number
+// and the search wraps around.
+func nextBookmark(bookmarks map[string][]int, file string, lineno int, dir int) (string, int, bool) {
+	type bookmark struct {
+		file   string
+		lineno int
+	}
+	var all []bookmark
+	for f, lines := range bookmarks {
+		for _, l := range lines {
+			all = append(all, bookmark{f, l})
+		}
+	}
+	if len(all) == 0 {
+		return "", 0, false
+	}
+	less := func(a, b bookmark) bool {
+		if a.file == b.file {
+			return a.lineno < b.lineno
+		}
+		return a.file < b.file
+	}
+	sort.Slice(all, func(i, j int) bool { return less(all[i], all[j]) })
+
+	cur := bookmark{file, lineno}
+	if dir > 0 {
+		for _, bm := range all {
+			if less(cur, bm) {
+				return bm.file, bm.lineno, true
+			}
+		}
+		return all[0].file, all[0].lineno, true
+	}
+	for i := len(all) - 1; i >= 0; i-- {
+		if less(all[i], cur) {
+			return all[i].file, all[i].lineno, true
+		}
+	}
+	return all[len(all)-1].file, all[len(all)-1].lineno, true
+}
+
+// jumpToBookmark shows the next (dir > 0) or previous (dir < 0) bookmark in
+// the listing panel.
+func jumpToBookmark(dir int) {
+	file, lineno, _ := listingCursorOrPC()
+	file, lineno, ok := nextBookmark(conf.Bookmarks, file, lineno, dir)
+	if !ok {
+		return
+	}
+	listingPanel.pinnedLoc = &api.Location{File: file, Line: lineno}
+	if file == listingPanel.file {
+		listingPanel.cursorLine = lineno
+	}
+	go refreshState(refreshToSameFrame, clearNothing, nil)
+}
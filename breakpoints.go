@@ -2,9 +2,22 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
 	"io"
+	"io/ioutil"
 	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
 
 	"github.com/aarzilli/gdlv/internal/dlvclient/service/api"
 )
@@ -125,6 +138,473 @@ func restoreFrozenBreakpoints(out io.Writer) {
 	}
 }
 
+// savedBreakpoint is a breakpoint written by saveBreakpointsFile, along
+// with the state gdlv keeps for it.
+type savedBreakpoint struct {
+	api.Breakpoint
+	LogFormat   string `json:"logFormat,omitempty"`   // format of 'trace -log'
+	OnlyChanged bool   `json:"onlyChanged,omitempty"` // created by 'trace -changed'
+}
+
+// saveBreakpointsFile writes all user breakpoints to the file at path.
+func saveBreakpointsFile(out io.Writer, path string) error {
+	bps, err := client.ListBreakpoints()
+	if err != nil {
+		return err
+	}
+	saved := []savedBreakpoint{}
+	for _, bp := range bps {
+		if bp.ID < 0 {
+			continue
+		}
+		bp.TotalHitCount = 0
+		bp.HitCount = nil
+		_, onlyChanged := changepoints[bp.ID]
+		saved = append(saved, savedBreakpoint{*bp, logpoints[bp.ID], onlyChanged})
+	}
+	buf, err := json.MarshalIndent(saved, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, buf, 0640); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Saved %d breakpoints to %s\n", len(saved), path)
+	return nil
+}
+
+// loadBreakpointsFile creates the breakpoints saved in path by
+// saveBreakpointsFile, breakpoints that can not be created are reported
+// and skipped.
+func loadBreakpointsFile(out io.Writer, path string) error {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var saved []savedBreakpoint
+	if err := json.Unmarshal(buf, &saved); err != nil {
+		return err
+	}
+	n := 0
+	for i := range saved {
+		requestedBp := saved[i].Breakpoint
+		requestedBp.ID = 0
+		requestedBp.Addr = 0
+		bp, err := client.CreateBreakpoint(&requestedBp)
+		if err != nil {
+			fmt.Fprintf(out, "Could not restore %s at %s:%d: %v\n", formatBreakpointName(&saved[i].Breakpoint, false), ShortenFilePath(saved[i].File), saved[i].Line, err)
+			continue
+		}
+		if saved[i].LogFormat != "" {
+			logpoints[bp.ID] = saved[i].LogFormat
+		}
+		if saved[i].OnlyChanged {
+			changepoints[bp.ID] = &changepoint{}
+		}
+		freezeBreakpoint(out, bp)
+		n++
+	}
+	fmt.Fprintf(out, "Restored %d of %d breakpoints from %s\n", n, len(saved), path)
+	return nil
+}
+
+// prevCondition is a breakpoint condition evaluated by gdlv instead of
+// delve. It can refer to the value an expression had the last time the
+// breakpoint was hit using prev(expr), for example "x >= 2*prev(x)".
+// The condition is never true the first time the breakpoint is hit, since
+// there are no previous values yet.
+type prevCondition struct {
+	Cond string
+	prev map[string]string
+}
+
+// prevConditions maps breakpoint IDs to their gdlv conditions.
+var prevConditions = map[int]*prevCondition{}
+
+func setPrevCondition(id int, cond string) error {
+	if cond == "" {
+		delete(prevConditions, id)
+		return nil
+	}
+	if _, _, err := substitutePrev(cond, nil); err != nil {
+		return err
+	}
+	prevConditions[id] = &prevCondition{Cond: cond}
+	return nil
+}
+
+// substitutePrev returns the list of arguments of prev calls in cond and,
+// if vals is not nil, cond with each prev call replaced by the value of
+// its argument in vals.
+func substitutePrev(cond string, vals map[string]string) (string, []string, error) {
+	fset := token.NewFileSet()
+	expr, err := parser.ParseExprFrom(fset, "", cond, 0)
+	if err != nil {
+		return "", nil, err
+	}
+	type prevCall struct {
+		start, end int
+		arg        string
+	}
+	var calls []prevCall
+	ast.Inspect(expr, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if id, ok := call.Fun.(*ast.Ident); !ok || id.Name != "prev" || len(call.Args) != 1 {
+			return true
+		}
+		arg := call.Args[0]
+		calls = append(calls, prevCall{
+			fset.Position(call.Pos()).Offset, fset.Position(call.End()).Offset,
+			cond[fset.Position(arg.Pos()).Offset:fset.Position(arg.End()).Offset]})
+		return false
+	})
+	if len(calls) == 0 {
+		return "", nil, fmt.Errorf("condition does not use prev")
+	}
+	args := make([]string, len(calls))
+	for i := range calls {
+		args[i] = calls[i].arg
+	}
+	if vals == nil {
+		return "", args, nil
+	}
+	var buf bytes.Buffer
+	last := 0
+	for _, call := range calls {
+		buf.WriteString(cond[last:call.start])
+		buf.WriteString("(" + vals[call.arg] + ")")
+		last = call.end
+	}
+	buf.WriteString(cond[last:])
+	return buf.String(), args, nil
+}
+
+// eval evaluates the condition in scope and records the new values of the
+// arguments of prev.
+func (pc *prevCondition) eval(scope api.EvalScope) (bool, error) {
+	_, args, err := substitutePrev(pc.Cond, nil)
+	if err != nil {
+		return false, err
+	}
+	cur := map[string]string{}
+	for _, arg := range args {
+		v, err := client.EvalVariable(scope, arg, api.LoadConfig{MaxStringLen: 1024})
+		if err != nil {
+			return false, err
+		}
+		switch v.Kind {
+		case reflect.String:
+			cur[arg] = strconv.Quote(v.Value)
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr, reflect.Float32, reflect.Float64:
+			cur[arg] = v.Value
+		default:
+			return false, fmt.Errorf("can not use prev on %s of type %s", arg, v.Type)
+		}
+	}
+	prev := pc.prev
+	pc.prev = cur
+	if prev == nil {
+		return false, nil
+	}
+	expr, _, _ := substitutePrev(pc.Cond, prev)
+	v, err := client.EvalVariable(scope, expr, api.LoadConfig{})
+	if err != nil {
+		return false, err
+	}
+	if v.Kind != reflect.Bool {
+		return false, fmt.Errorf("condition %q is not boolean", pc.Cond)
+	}
+	return v.Value == "true", nil
+}
+
+// prevConditionsStop returns false if state is stopped at breakpoints that
+// have a gdlv condition and all those conditions are false, meaning that
+// execution should be resumed.
+func prevConditionsStop(out io.Writer, state *api.DebuggerState) bool {
+	if state == nil || state.Exited || len(prevConditions) == 0 {
+		return true
+	}
+	stopped := false
+	for _, th := range state.Threads {
+		if th.Breakpoint == nil || th.Breakpoint.Tracepoint {
+			continue
+		}
+		pc := prevConditions[th.Breakpoint.ID]
+		if pc == nil {
+			return true
+		}
+		stopped = true
+		stop, err := pc.eval(api.EvalScope{GoroutineID: th.GoroutineID})
+		if err != nil {
+			fmt.Fprintf(out, "Error evaluating condition of %s: %v\n", formatBreakpointName(th.Breakpoint, false), err)
+			return true
+		}
+		if stop {
+			return true
+		}
+	}
+	return !stopped
+}
+
+// logpoints maps the IDs of tracepoints created with 'trace -log' to their
+// format strings.
+var logpoints = map[int]string{}
+
+// splitLogFormat splits the format string of a logpoint at each verb, the
+// returned slice always has one more element than the number of verbs. A
+// verb is a '%' followed by optional flags and terminated by a letter, '%%'
+// is a literal '%'.
+func splitLogFormat(format string) []string {
+	r := []string{}
+	var cur strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			cur.WriteByte(format[i])
+			continue
+		}
+		if i+1 < len(format) && format[i+1] == '%' {
+			cur.WriteByte('%')
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(format) && !isLetter(format[j]) {
+			j++
+		}
+		r = append(r, cur.String())
+		cur.Reset()
+		i = j
+	}
+	return append(r, cur.String())
+}
+
+func isLetter(ch byte) bool {
+	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+// formatLogMessage substitutes vals into the verbs of format.
+func formatLogMessage(format string, vals []string) string {
+	parts := splitLogFormat(format)
+	var buf strings.Builder
+	for i, part := range parts {
+		buf.WriteString(part)
+		if i < len(parts)-1 {
+			if i < len(vals) {
+				buf.WriteString(vals[i])
+			} else {
+				buf.WriteString("%!(MISSING)")
+			}
+		}
+	}
+	return buf.String()
+}
+
+// parseLogpoint parses the arguments of 'trace -log', a quoted format string
+// followed by one expression for each verb of the format string and by the
+// arguments of 'trace'.
+func parseLogpoint(args string) (format string, exprs []string, rest string, err error) {
+	args = strings.TrimSpace(args)
+	quoted, err := strconv.QuotedPrefix(args)
+	if err != nil {
+		return "", nil, "", fmt.Errorf("format string must be quoted")
+	}
+	format, _ = strconv.Unquote(quoted)
+	rest = strings.TrimSpace(args[len(quoted):])
+	for n := len(splitLogFormat(format)) - 1; n > 0; n-- {
+		fields := strings.SplitN(rest, " ", 2)
+		if fields[0] == "" {
+			return "", nil, "", fmt.Errorf("not enough expressions for format string %q", format)
+		}
+		exprs = append(exprs, fields[0])
+		rest = ""
+		if len(fields) > 1 {
+			rest = strings.TrimSpace(fields[1])
+		}
+	}
+	if rest == "" {
+		return "", nil, "", fmt.Errorf("location required")
+	}
+	return format, exprs, rest, nil
+}
+
+// changepoint is a tracepoint created with 'trace -changed', it is only
+// displayed when the value of its expression changes.
+type changepoint struct {
+	seen bool
+	last string
+}
+
+// changepoints maps the IDs of tracepoints created with 'trace -changed' to
+// the last value of their expression.
+var changepoints = map[int]*changepoint{}
+
+// changed records val as the current value of the expression and returns
+// true if it is different from the previous one.
+func (cp *changepoint) changed(val string) bool {
+	if cp.seen && cp.last == val {
+		return false
+	}
+	cp.seen, cp.last = true, val
+	return true
+}
+
+// changepointUnchanged returns true if th is stopped at a changepoint whose
+// expression has the same value it had the last time it was hit.
+func changepointUnchanged(th *api.Thread) bool {
+	cp, ok := changepoints[th.Breakpoint.ID]
+	if !ok || th.BreakpointInfo == nil || len(th.BreakpointInfo.Variables) == 0 {
+		return false
+	}
+	return !cp.changed(wrapApiVariableSimple(&th.BreakpointInfo.Variables[0]).SinglelineString(false, false))
+}
+
+type bpProfileEntry struct {
+	bp      api.Breakpoint
+	hits    uint64
+	stops   int
+	elapsed time.Duration
+}
+
+// bpProfile records how much time is spent on each breakpoint while the
+// target is running, see profileContinue.
+var bpProfile = struct {
+	mu      sync.Mutex
+	enabled bool
+	runs    int
+	total   time.Duration
+	entries map[int]*bpProfileEntry
+}{
+	entries: map[int]*bpProfileEntry{},
+}
+
+// profileContinue calls fn and, if breakpoint profiling is enabled, times
+// the run and attributes its duration to the breakpoints hit during it.
+func profileContinue(fn func() <-chan *api.DebuggerState) <-chan *api.DebuggerState {
+	bpProfile.mu.Lock()
+	enabled := bpProfile.enabled
+	bpProfile.mu.Unlock()
+	if !enabled {
+		return fn()
+	}
+
+	before := map[int]uint64{}
+	if bps, err := client.ListBreakpoints(); err == nil {
+		for _, bp := range bps {
+			before[bp.ID] = bp.TotalHitCount
+		}
+	}
+	start := time.Now()
+	in := fn()
+	out := make(chan *api.DebuggerState)
+	go func() {
+		var last *api.DebuggerState
+		for state := range in {
+			last = state
+			out <- state
+		}
+		bpProfileRecord(before, time.Since(start), last)
+		close(out)
+	}()
+	return out
+}
+
+func bpProfileRecord(before map[int]uint64, elapsed time.Duration, state *api.DebuggerState) {
+	bps, err := client.ListBreakpoints()
+	if err != nil {
+		return
+	}
+
+	bpProfile.mu.Lock()
+	defer bpProfile.mu.Unlock()
+	bpProfile.runs++
+	bpProfile.total += elapsed
+
+	totalHits := uint64(0)
+	hits := map[int]uint64{}
+	for _, bp := range bps {
+		if bp.TotalHitCount > before[bp.ID] {
+			hits[bp.ID] = bp.TotalHitCount - before[bp.ID]
+			totalHits += hits[bp.ID]
+		}
+	}
+
+	for _, bp := range bps {
+		e := bpProfile.entries[bp.ID]
+		if e == nil {
+			e = &bpProfileEntry{}
+			bpProfile.entries[bp.ID] = e
+		}
+		e.bp = *bp
+		e.hits += hits[bp.ID]
+		if totalHits > 0 {
+			e.elapsed += time.Duration(float64(elapsed) * float64(hits[bp.ID]) / float64(totalHits))
+		}
+		if state != nil {
+			for _, th := range state.Threads {
+				if th.Breakpoint != nil && th.Breakpoint.ID == bp.ID {
+					e.stops++
+					break
+				}
+			}
+		}
+	}
+}
+
+func bpCommand(out io.Writer, args string) error {
+	argv := strings.Fields(args)
+	if len(argv) == 0 || argv[0] != "profile" {
+		return fmt.Errorf("unknown subcommand, see 'help bp'")
+	}
+
+	bpProfile.mu.Lock()
+	defer bpProfile.mu.Unlock()
+
+	if len(argv) > 1 {
+		switch argv[1] {
+		case "on":
+			bpProfile.enabled = true
+		case "off":
+			bpProfile.enabled = false
+		case "reset":
+			bpProfile.runs = 0
+			bpProfile.total = 0
+			bpProfile.entries = map[int]*bpProfileEntry{}
+		default:
+			return fmt.Errorf("unknown argument %q", argv[1])
+		}
+		return nil
+	}
+
+	if bpProfile.runs == 0 {
+		if !bpProfile.enabled {
+			fmt.Fprintln(out, "Breakpoint profiling is off, use 'bp profile on' to enable it")
+		} else {
+			fmt.Fprintln(out, "No runs profiled")
+		}
+		return nil
+	}
+
+	entries := make([]*bpProfileEntry, 0, len(bpProfile.entries))
+	for _, e := range bpProfile.entries {
+		if e.bp.ID >= 0 {
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].elapsed > entries[j].elapsed })
+
+	fmt.Fprintf(out, "%d runs profiled, total time %v\n", bpProfile.runs, bpProfile.total)
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 8, 1, ' ', 0)
+	fmt.Fprintf(w, "Breakpoint\tHits\tStops\tEst. time\tCondition\t\n")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%v\t%s\t\n", formatBreakpointName(&e.bp, true), e.hits, e.stops, e.elapsed, e.bp.Cond)
+	}
+	return w.Flush()
+}
+
 func (fbp *frozenBreakpoint) Restore(out io.Writer, create bool) {
 	if fbp.Bp.FunctionName == "" || fbp.Bp.File == "" {
 		return
@@ -209,11 +689,24 @@ func (fbp *frozenBreakpoint) Set(out io.Writer, functionLoc *api.Location) {
 	}
 }
 
+// disabledBreakpointIDOffset is added to the ID of disabled breakpoints so
+// that they do not collide with the IDs of breakpoints created later.
+const disabledBreakpointIDOffset = 1000000
+
+func isFrozenBreakpoint(id int) bool {
+	for i := range FrozenBreakpoints {
+		if FrozenBreakpoints[i].Bp.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
 func disableBreakpoint(bp *api.Breakpoint) {
 	for i := range FrozenBreakpoints {
 		if FrozenBreakpoints[i].Bp.ID == bp.ID {
 			client.ClearBreakpoint(FrozenBreakpoints[i].Bp.ID)
-			FrozenBreakpoints[i].Bp.ID += 1000000 // XXX ugly hack!
+			FrozenBreakpoints[i].Bp.ID += disabledBreakpointIDOffset
 			DisabledBreakpoints = append(DisabledBreakpoints, FrozenBreakpoints[i])
 			copy(FrozenBreakpoints[i:], FrozenBreakpoints[i+1:])
 			FrozenBreakpoints = FrozenBreakpoints[:len(FrozenBreakpoints)-1]
@@ -241,6 +734,66 @@ func enableBreakpoint(bp *api.Breakpoint) {
 	wnd.Changed()
 }
 
+// resetHitCounts resets the hit counts of bp by clearing it and creating it
+// again. The new breakpoint gets a different ID, everything that refers to
+// the old ID is moved to the new one.
+func resetHitCounts(bp *api.Breakpoint) {
+	out := editorWriter{&scrollbackEditor, true}
+	nbp := *bp
+	nbp.TotalHitCount = 0
+	nbp.HitCount = nil
+	if _, err := client.ClearBreakpoint(bp.ID); err != nil {
+		fmt.Fprintf(&out, "Could not reset hit counts of breakpoint %d: %v\n", bp.ID, err)
+		return
+	}
+	newbp, err := client.CreateBreakpoint(&nbp)
+	if err != nil {
+		fmt.Fprintf(&out, "Could not restore breakpoint %d after resetting hit counts: %v\n", bp.ID, err)
+		removeFrozenBreakpoint(bp)
+	} else {
+		rekeyBreakpoint(bp.ID, newbp.ID)
+		saveConfiguration()
+	}
+	refreshState(refreshToSameFrame, clearBreakpoint, nil)
+	wnd.Changed()
+}
+
+// forgetBreakpoint removes the state kept by gdlv for breakpoint id, it must
+// be called every time a breakpoint is cleared since its ID can be reused
+// by a different breakpoint later.
+func forgetBreakpoint(id int) {
+	delete(prevConditions, id)
+	delete(logpoints, id)
+	delete(changepoints, id)
+}
+
+// rekeyBreakpoint moves all the state associated with breakpoint oldID to
+// breakpoint newID.
+func rekeyBreakpoint(oldID, newID int) {
+	if oldID == newID {
+		return
+	}
+	for _, fbps := range [][]frozenBreakpoint{FrozenBreakpoints, DisabledBreakpoints} {
+		for i := range fbps {
+			if fbps[i].Bp.ID == oldID {
+				fbps[i].Bp.ID = newID
+			}
+		}
+	}
+	if pc, ok := prevConditions[oldID]; ok {
+		delete(prevConditions, oldID)
+		prevConditions[newID] = pc
+	}
+	if lp, ok := logpoints[oldID]; ok {
+		delete(logpoints, oldID)
+		logpoints[newID] = lp
+	}
+	if cp, ok := changepoints[oldID]; ok {
+		delete(changepoints, oldID)
+		changepoints[newID] = cp
+	}
+}
+
 type anyBreakpoint struct {
 	*api.Breakpoint
 	enabled bool
@@ -6,19 +6,28 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"go/ast"
 	"go/parser"
 	"go/scanner"
+	"go/token"
 	"io"
+	"io/ioutil"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"text/tabwriter"
 	"unicode"
 
 	"golang.org/x/mobile/event/key"
 
 	"github.com/aarzilli/gdlv/internal/dlvclient/service/api"
+	"github.com/aarzilli/gdlv/internal/prettyprint"
 
 	"github.com/aarzilli/nucular"
 	"github.com/aarzilli/nucular/label"
@@ -82,19 +91,40 @@ Type "help" followed by the name of a command for more information about it.`},
 		{aliases: []string{"break", "b"}, cmdFn: breakpoint, complete: completeLocation, helpMsg: `Sets a breakpoint.
 
 	break [name] <linespec>
+	break -save <file>
+	break -load <file>
 
-See $GOPATH/src/github.com/derekparker/delve/Documentation/cli/locspec.md for the syntax of linespec. To set breakpoints you can also right click on a source line and click "Set breakpoint". Breakpoint properties can be changed by right clicking on a breakpoint (either in the source panel or the breakpoints panel) and selecting "Edit breakpoint".`},
+With -save all breakpoints and tracepoints are written to the specified file, including the format of tracepoints created with trace -log, -load recreates the breakpoints saved in a file.
+
+See $GOPATH/src/github.com/derekparker/delve/Documentation/cli/locspec.md for the syntax of linespec. To set breakpoints you can also right click on a source line and click "Set breakpoint" (or "Set conditional breakpoint..." to specify a condition). Breakpoint properties can be changed by right clicking on a breakpoint (either in the source panel or the breakpoints panel) and selecting "Edit breakpoint".`},
 		{aliases: []string{"trace", "t"}, cmdFn: tracepoint, complete: completeLocation, helpMsg: `Set tracepoint.
 
 	trace [name] <linespec>
+	trace -log "<format>" <expr>... [name] <linespec>
+	trace -changed <expr> [name] <linespec>
 	
-A tracepoint is a breakpoint that does not stop the execution of the program, instead when the tracepoint is hit a notification is displayed. See $GOPATH/src/github.com/derekparker/delve/Documentation/cli/locspec.md for the syntax of linespec.
+A tracepoint is a breakpoint that does not stop the execution of the program, instead when the tracepoint is hit a notification is displayed.
+
+With -log the tracepoint is a logpoint: when it is hit each verb of the format string (for example %v) is replaced with the value of the corresponding expression and the result is printed. One expression must be specified for each verb and expressions can not contain spaces. See $GOPATH/src/github.com/derekparker/delve/Documentation/cli/locspec.md for the syntax of linespec.
+
+With -changed the notification is only displayed when the value of expr is different from the one it had the last time the tracepoint was hit. The expression can not contain spaces.
 
 See also: "help on", "help cond" and "help clear"`},
 		{aliases: []string{"clear"}, cmdFn: clear, helpMsg: `Deletes breakpoint.
 		
 			clear <breakpoint name or id>`},
-		{aliases: []string{"restart", "r"}, cmdFn: restart, helpMsg: `Restart process.
+		{aliases: []string{"disable"}, cmdFn: disableCommand, helpMsg: `Disables a breakpoint without deleting it.
+
+	disable <breakpoint name or id>`},
+		{aliases: []string{"enable"}, cmdFn: enableCommand, helpMsg: `Enables a previously disabled breakpoint.
+
+	enable <breakpoint name or id>`},
+		{aliases: []string{"clearall"}, cmdFn: clearAll, helpMsg: `Deletes multiple breakpoints.
+
+	clearall [<regex>]
+
+Without arguments deletes all breakpoints, otherwise deletes the breakpoints whose name or function matches the regular expression.`},
+		{aliases: []string{"restart", "r"}, cmdFn: disabledInCore("restart", restart), helpMsg: `Restart process.
 
 For recordings a checkpoint can be optionally specified.
 For live processes any argument to restart will be used as argument to the program, use:
@@ -102,40 +132,100 @@ For live processes any argument to restart will be used as argument to the progr
 	restart --
 	
 To clear the arguments passed to the program.`},
-		{aliases: []string{"continue", "c"}, cmdFn: cont, helpMsg: "Run until breakpoint or program termination."},
-		{aliases: []string{"rewind", "rw"}, cmdFn: rewind, helpMsg: "Run backwards until breakpoint or program termination."},
-		{aliases: []string{"checkpoint", "check"}, cmdFn: checkpoint, helpMsg: `Creates a checkpoint at the current position.
+		{aliases: []string{"continue", "c"}, cmdFn: disabledInCore("continue", cont), helpMsg: `Run until breakpoint or program termination.
+
+	continue [<locspec>]
+
+If a location is specified a temporary breakpoint is set there and removed once execution stops.`},
+		{aliases: []string{"rewind", "rw"}, cmdFn: disabledInCore("rewind", rewind), helpMsg: "Run backwards until breakpoint or program termination."},
+		{aliases: []string{"dump"}, cmdFn: disabledInCore("dump", dump), helpMsg: `Writes a core dump of the target process.
+
+	dump <file>`},
+		{aliases: []string{"checkpoint", "check"}, cmdFn: disabledInCore("checkpoint", checkpoint), helpMsg: `Creates a checkpoint at the current position.
 	
 	checkpoint [where]`},
-		{aliases: []string{"step", "s"}, cmdFn: step, helpMsg: `Single step through program.
+		{aliases: []string{"step", "s"}, cmdFn: disabledInCore("step", step), helpMsg: `Single step through program.
 		
-		step [-list|-first|-last|name]
+		step [-list [-all]|-first|-last|name]
 		
-Specify a name to step into one specific function call. Use the -list option for all the function calls on the current line. To step into a specific function call you can also right click on a function call (on the current line) and select "Step into".
-
-Option -first will step into the first function call of the line, -last will step into the last call of the line. When called without arguments step will use -first as default, but this can be changed using config.`},
-		{aliases: []string{"step-instruction", "si"}, cmdFn: stepInstruction, helpMsg: "Single step a single cpu instruction."},
-		{aliases: []string{"next", "n"}, cmdFn: next, helpMsg: "Step over to next source line."},
-		{aliases: []string{"stepout", "o"}, cmdFn: stepout, helpMsg: "Step out of the current function."},
-		{aliases: []string{"cancelnext"}, cmdFn: cancelnext, helpMsg: "Cancels the next operation currently in progress."},
-		{aliases: []string{"interrupt"}, cmdFn: interrupt, helpMsg: "interrupts execution."},
+Specify a name to step into one specific function call. Use the -list option for all the function calls on the current line that have not been executed yet, add -all to also list the calls before the current instruction. To step into a specific function call you can also right click on a function call (on the current line) and select "Step into".
+
+Option -first will step into the first function call of the line, -last will step into the last call of the line. When called without arguments step will use -first as default, but this can be changed using config.
+
+If step or next stop inside one of the packages listed in the configuration window (by default runtime) stepout is executed automatically.`},
+		{aliases: []string{"step-instruction", "si"}, cmdFn: disabledInCore("step-instruction", stepInstruction), helpMsg: "Single step a single cpu instruction."},
+		{aliases: []string{"next", "n"}, cmdFn: disabledInCore("next", next), helpMsg: `Step over to next source line.
+
+	next [-until <expr>]
+
+With -until next is repeated until the boolean expression expr becomes true or the current function returns.`},
+		{aliases: []string{"stepout", "o"}, cmdFn: disabledInCore("stepout", stepout), helpMsg: `Step out of the current function.
+
+	stepout [-ret]
+
+With -ret the values returned by the function are also shown in the local variables panel, until the next time the program stops.`},
+		{aliases: []string{"cancelnext"}, cmdFn: disabledInCore("cancelnext", cancelnext), helpMsg: "Cancels the next operation currently in progress."},
+		{aliases: []string{"interrupt"}, cmdFn: disabledInCore("interrupt", interrupt), helpMsg: `interrupts execution.
+
+	interrupt [-cancel]
+
+With -cancel the next, step or stepout operation in progress is also canceled.`},
+		{aliases: []string{"attach"}, cmdFn: attachCommand, helpMsg: `Attaches to a running process.
+
+	attach <pid>
+	attach <name-regex>
+
+The current debugging session is terminated. If the argument is not a pid the running processes whose name matches the regular expression are listed, if only one process matches gdlv attaches to it, otherwise a window to choose between them is opened.`},
+		{aliases: []string{"reconnect"}, cmdFn: reconnectCommand, helpMsg: `Reconnects to the headless delve server.
+
+Use this if the connection to the server was dropped or the server was restarted. Frozen breakpoints are restored after reconnecting.`},
+		{aliases: []string{"core"}, cmdFn: coreCommand, complete: completeFilesystem, helpMsg: `Opens a core file.
+
+	core <executable> <core file>
+
+The current debugging session is terminated. Commands that resume or alter the execution of the target are not available while debugging a core file.`},
 		{aliases: []string{"print", "p"}, complete: completeVariable, cmdFn: printVar, helpMsg: `Evaluate an expression.
 
 	print [@<scope-expr>] <expression>
 	print [@<scope-expr>] $ <starlar-expression>
+	print -nan [@<scope-expr>] <expression>
 
 See $GOPATH/src/github.com/derekparker/delve/Documentation/cli/expr.md for a description of supported expressions.
+Expressions containing function or method calls, for example 'print obj.Method(arg1, arg2)', are evaluated by injecting the call in the current goroutine. This is only possible in the topmost frame of the current goroutine.
+With -nan the path of every NaN, +Inf, -Inf and denormal floating point value contained in the result (as far as it was loaded) is also printed.
 Type 'help scope-expr' for a description of <scope-expr>.`},
 		{aliases: []string{"list", "ls"}, complete: completeLocation, cmdFn: listCommand, helpMsg: `Show source code.
 		
 			list <linespec>
 		
 		See $GOPATH/src/github.com/derekparker/delve/Documentation/cli/expr.md for a description of supported expressions.`},
+		{aliases: []string{"funcs"}, cmdFn: funcsCommand, helpMsg: `Lists functions.
+
+	funcs [-page <n>] [<regex>]
+
+Prints the functions matching the regular expression, 50 at a time. Each function name can be passed to 'list'.`},
+		{aliases: []string{"types"}, cmdFn: typesCommand, helpMsg: `Lists types.
+
+	types [-page <n>] [<regex>]
+
+Prints the types matching the regular expression, 50 at a time.`},
+		{aliases: []string{"sources"}, cmdFn: sourcesCommand, helpMsg: `Lists source files.
+
+	sources [-page <n>] [<regex>]
+
+Prints the source files matching the regular expression, 50 at a time. Each file is printed as a location that can be passed to 'list'.`},
 		{aliases: []string{"set"}, cmdFn: setVar, complete: completeVariable, helpMsg: `Changes the value of a variable.
 
 	set <variable> = <value>
 
-See $GOPATH/src/github.com/derekparker/delve/Documentation/cli/expr.md for a description of supported expressions. Only numerical variables and pointers can be changed.`},
+See $GOPATH/src/github.com/derekparker/delve/Documentation/cli/expr.md for a description of supported expressions. Numerical variables, pointers and elements of arrays and slices can be changed, for example:
+
+	set arr[2] = 7
+
+Strings can be changed to point to a string already in memory, structs and arrays are assigned one element at a time:
+
+	set s = otherString
+	set st = otherStruct`},
 		{aliases: []string{"display", "disp", "dp"}, complete: completeVariable, cmdFn: displayVar, helpMsg: `Adds one expression to the Variables panel.
 	
 	display [@<scope-expr>] <expression>
@@ -143,10 +233,94 @@ See $GOPATH/src/github.com/derekparker/delve/Documentation/cli/expr.md for a des
 
 See $GOPATH/src/github.com/derekparker/delve/Documentation/cli/expr.md for a description of supported expressions.
 Type 'help scope-expr' for a description of <scope-expr>.`},
+		{aliases: []string{"monitor"}, complete: completeVariable, cmdFn: monitorVar, helpMsg: `Adds one expression to the Variables panel and keeps it there across restarts.
+
+	monitor [@<scope-expr>] <expression>
+	monitor -clear [<expression>]
+	monitor
+
+Monitored expressions are evaluated by name, rather than by address, so they are resolved again every time the target process is restarted. They are saved in the configuration file, for each executable.
+Without arguments lists all monitored expressions, 'monitor -clear' stops monitoring the specified expression (or all expressions, if none is specified).`},
+		{aliases: []string{"let"}, cmdFn: letVar, helpMsg: `Evaluates an expression and stores its value in a starlark global variable.
+
+	let <name> = [@<scope-expr>] <expression>
+
+The variable can be used by subsequent starlark expressions and scripts, for example:
+
+	let x = v.field
+	print $ x + 1`},
+		{aliases: []string{"map-diff"}, complete: completeVariable, cmdFn: mapDiffCommand, helpMsg: `Shows how the contents of a map changed since the last invocation.
+
+	map-diff [@<scope-expr>] <map-expression>
+	map-diff -clear [<map-expression>]
+
+The first invocation takes a snapshot of the map, subsequent invocations list the entries that were added (+), removed (-) and changed (~) since the previous one. Use -clear to discard the snapshot of an expression (or all snapshots). Only the first 10000 entries of a map are compared.`},
+		{aliases: []string{"embeds"}, complete: completeVariable, cmdFn: embedsCommand, helpMsg: `Lists the types embedded in a struct and the fields and methods they contribute.
+
+	embeds [@<scope-expr>] <expr>
+
+Embedded types are listed recursively, each one with the path used to reach it. Fields and methods that are not promoted because a shallower embedding (or the struct itself) defines the same name are marked as shadowed, names defined more than once at the same depth are marked as ambiguous.
+Fields are recognized as embedded when their name is the same as the name of their type. Only methods that were compiled into the executable are listed.`},
+		{aliases: []string{"ptype", "whatis"}, complete: completeVariable, cmdFn: ptypeCommand, helpMsg: `Prints the definition of a type.
+
+	ptype <type>
+	ptype [@<scope-expr>] <expr>
+
+If the argument is the name of a type its size is printed, for structs the offset, size and type of each field is also printed. If the argument is an expression its static type is printed first, followed by the definition of that type.
+Field sizes include the padding that follows the field.`},
 		{aliases: []string{"details", "det", "dt"}, complete: completeVariable, cmdFn: detailsVar, helpMsg: `Opens details window for the specified expression.
 	
 	details <expr>
+	details -list
+	details -close <n>
+
+Details windows are titled with the expression and the goroutine and frame they were opened in. Use -list to enumerate the open details windows and -close to close one of them.
 `},
+		{aliases: []string{"memwatch", "mw"}, complete: completeVariable, cmdFn: memwatchCommand, helpMsg: `Opens a window showing a region of memory.
+
+	memwatch <expr> [<len>]
+
+Shows len bytes (64 by default) starting at the address specified by expr. If expr evaluates to a pointer or an integer its value is used as the address, for slices and strings the address of their contents is used, otherwise the address of the variable is used.
+The region is read again every time the program stops, bytes that changed since the last stop are highlighted.`},
+		{aliases: []string{"syscalls"}, cmdFn: syscallsCommand, helpMsg: `Lists goroutines blocked in a system call or a cgo call.
+
+Goroutines are classified using the runtime function they are currently executing, the name of the system call (or C function) is determined from their stacktrace when possible.`},
+		{aliases: []string{"bt", "stack"}, cmdFn: stackCommand, helpMsg: `Prints the stacktrace of the selected goroutine.
+
+	bt [-full] [depth]
+
+With -full the arguments and local variables of each frame are also printed. If depth is not specified the depth set in the Stacktrace panel is used.`},
+		{aliases: []string{"regs"}, cmdFn: regsCommand, helpMsg: `Prints the registers of the current thread.
+
+	regs [-a]
+
+With -a the extended register set (floating point and vector registers) is also printed.`},
+		{aliases: []string{"goroutines", "grs"}, cmdFn: goroutinesCommand, helpMsg: `Lists goroutines.
+
+	goroutines [-label <key>[=<value>]]
+
+With -label only the goroutines that have the specified pprof label are listed, if the value is omitted any goroutine with the label key is listed. Labels are only available with versions of delve that report them.`},
+		{aliases: []string{"thread", "tr"}, cmdFn: threadCommand, helpMsg: `Switches to the specified thread.
+
+	thread [<id>]
+
+Without arguments prints the current thread and its location.`},
+		{aliases: []string{"disassemble", "disass"}, cmdFn: disassCommand, complete: completeLocation, helpMsg: `Prints disassembly.
+
+	disass
+	disass -a <start> <end>
+	disass -l <locspec>
+
+With no arguments disassembles the function of the current frame, -a disassembles the specified address range, -l disassembles the function containing the specified location. The flavor set in the configuration window is used.`},
+		{aliases: []string{"bp"}, cmdFn: bpCommand, helpMsg: `Breakpoint utilities.
+
+	bp profile on
+	bp profile off
+	bp profile reset
+	bp profile
+
+Profiles the time spent by continue and rewind, including the continues used to complete next, step and stepout when they are interrupted by a breakpoint. While profiling is on the duration of each run is recorded and attributed to the breakpoints that were hit during it, in proportion to the number of hits. 'bp profile' reports, for each breakpoint, the number of hits, how many times it stopped execution and an estimate of the time spent on it.
+Note that the backend only counts hits for which the condition of the breakpoint was true, evaluations of the condition that returned false are not counted, but the time spent on them is included in the total run time.`},
 		{aliases: []string{"layout"}, cmdFn: layoutCommand, helpMsg: `Manages window layout.
 	
 	layout <name>
@@ -159,13 +333,41 @@ Saves the current layout.
 
 	layout list
 	
-Lists saved layouts.`},
-		{aliases: []string{"config"}, cmdFn: configCommand, helpMsg: `Configuration`},
+Lists saved layouts.
+
+	layout export <name> <file>
+
+Writes the specified layout to a file.
+
+	layout import <file>
+
+Adds the layout contained in a file to the saved layouts.
+
+	layout delete [-f] <name>
+
+Deletes the specified layout. The default layout and the layout currently in use can only be deleted with -f.`},
+		{aliases: []string{"config"}, cmdFn: configCommand, helpMsg: `Configuration.
+
+	config			Opens the configuration window.
+	config alias <command> <alias>	Adds an alias for a command.
+	config alias <alias>	Removes an alias.
+	config workdir		Prints the working directory of the target.
+	config workdir <path>	Sets the working directory of the target, takes effect on the next restart.
+	config subst-import <file>	Imports path substitution rules from a file.
+	config subst-export <file>	Exports path substitution rules to a file.
+	config save <profile>	Saves the current configuration as a profile.
+	config load <profile>	Replaces the current configuration with a saved profile.
+	config profiles		Lists saved profiles.
+	config disass-flavor intel|gnu	Changes the syntax used to show disassembly.
+
+Path substitution rules can also be specified with the GDLV_SUBST environment variable, as a list of from=to pairs separated by the path list separator (':' on unix, ';' on windows).
+`},
 		{aliases: []string{"scroll"}, cmdFn: scrollCommand, helpMsg: `Controls scrollback behavior.
 	
 	scroll clear		Clears scrollback
 	scroll silence		Silences output from inferior
 	scroll noise		Re-enables output from inferior.
+	scroll save [-append] <file>	Writes the contents of the scrollback to a file, with -append the contents are appended to the file if it already exists.
 `},
 		{aliases: []string{"exit", "quit", "q"}, cmdFn: exitCommand, helpMsg: "Exit the debugger."},
 
@@ -173,7 +375,7 @@ Lists saved layouts.`},
 	
 	window <kind>
 	
-Kind is one of listing, diassembly, goroutines, stacktrace, variables, globals, breakpoints, threads, registers, sources, functions, types and checkpoints.
+Kind is one of listing, diassembly, goroutines, stacktrace, variables, globals, breakpoints, threads, registers, sources, functions, types, checkpoints and history.
 
 Shortcuts:
 	Alt-1	Listing window
@@ -188,10 +390,15 @@ Shortcuts:
 `},
 		{aliases: []string{"source"}, cmdFn: sourceCommand, complete: completeFilesystem, helpMsg: `Executes a starlark script
 	
-	source <path>
+	source <path> [<args>...]
 
-If path is a single '-' character an interactive starlark interpreter will start instead. Type 'exit' to exit.
+The arguments that follow path are passed, as strings, to the main function of the script, use single quotes to pass arguments containing spaces. If path is a single '-' character an interactive starlark interpreter will start instead. Type 'exit' to exit.
 See documentation in doc/starlark.md.`},
+		{aliases: []string{"assert"}, cmdFn: assertCommand, complete: completeVariable, helpMsg: `Evaluates a boolean expression and fails if it is false.
+
+	assert [-fatal] [@<scope-expr>] <expression>
+
+The command returns an error when the expression is false or can not be evaluated, which stops an -init command script. With -fatal the script is stopped even if -continue-on-error was specified.`},
 	}
 
 	sort.Sort(ByFirstAlias(c.cmds))
@@ -274,11 +481,18 @@ and GDLV_BOLD_FONT to the path of two ttf files.
 	fmt.Fprintln(out, "Keybindings:")
 	fmt.Fprintln(w, "    Ctrl +/- \t Zoom in/out")
 	fmt.Fprintln(w, "    Escape \t Focus command line")
+	fmt.Fprintln(w, "    Ctrl-F \t Search the scrollback (Enter/Shift-Enter for next/previous match)")
 	fmt.Fprintln(w, "    Shift-F5, Ctrl-delete \t Request manual stop")
+	fmt.Fprintln(w, "    Ctrl-Shift-F5 \t Request manual stop and cancel next operation")
+	fmt.Fprintln(w, "    F2, Shift-F2 \t Go to next/previous bookmark")
+	fmt.Fprintln(w, "    Ctrl-F2 \t Toggle bookmark on the selected line of the listing")
+	fmt.Fprintln(w, "    F4 \t Run to the selected line of the listing")
 	fmt.Fprintln(w, "    F5 \t Continue")
+	fmt.Fprintln(w, "    F9 \t Toggle breakpoint on the selected line of the listing")
 	fmt.Fprintln(w, "    F10, Alt-right \t Next")
 	fmt.Fprintln(w, "    F11, Alt-down \t Step")
 	fmt.Fprintln(w, "    Shift-F11, Alt-up \t Step Out")
+	fmt.Fprintln(w, "    Ctrl-F11 \t Step into a chosen call")
 
 	if err := w.Flush(); err != nil {
 		return err
@@ -290,7 +504,32 @@ and GDLV_BOLD_FONT to the path of two ttf files.
 }
 
 func setBreakpoint(out io.Writer, tracepoint bool, argstr string) error {
+	return setBreakpointLog(out, tracepoint, argstr, "", nil, false)
+}
+
+// setBreakpointLog sets a breakpoint, if logfmt isn't empty the breakpoint
+// is a logpoint printing logexprs with logfmt. If onlyChanged is set the
+// breakpoint is a changepoint, printed only when the value of its
+// expression changes.
+func setBreakpointLog(out io.Writer, tracepoint bool, argstr, logfmt string, logexprs []string, onlyChanged bool) error {
+	if !tracepoint {
+		const savePrefix, loadPrefix = "-save ", "-load "
+		switch {
+		case strings.HasPrefix(argstr, savePrefix):
+			return saveBreakpointsFile(out, strings.TrimSpace(argstr[len(savePrefix):]))
+		case strings.HasPrefix(argstr, loadPrefix):
+			if curThread < 0 {
+				return fmt.Errorf("process exited")
+			}
+			defer refreshState(refreshToSameFrame, clearBreakpoint, nil)
+			return loadBreakpointsFile(out, strings.TrimSpace(argstr[len(loadPrefix):]))
+		}
+	}
+
 	if curThread < 0 {
+		if logfmt != "" || onlyChanged {
+			return fmt.Errorf("process exited")
+		}
 		cmd := "B"
 		if tracepoint {
 			cmd = "T"
@@ -320,6 +559,7 @@ func setBreakpoint(out io.Writer, tracepoint bool, argstr string) error {
 	}
 
 	requestedBp.Tracepoint = tracepoint
+	requestedBp.Variables = logexprs
 	locs, err := client.FindLocation(currentEvalScope(), locspec)
 	if err != nil {
 		if requestedBp.Name == "" {
@@ -335,34 +575,45 @@ func setBreakpoint(out io.Writer, tracepoint bool, argstr string) error {
 	}
 	for _, loc := range locs {
 		requestedBp.Addr = loc.PC
-		setBreakpointEx(out, requestedBp)
+		bp := setBreakpointEx(out, requestedBp)
+		if bp == nil {
+			continue
+		}
+		if logfmt != "" {
+			logpoints[bp.ID] = logfmt
+		}
+		if onlyChanged {
+			changepoints[bp.ID] = &changepoint{}
+		}
 	}
 	return nil
 }
 
-func setBreakpointEx(out io.Writer, requestedBp *api.Breakpoint) {
+func setBreakpointEx(out io.Writer, requestedBp *api.Breakpoint) *api.Breakpoint {
 	if curThread < 0 {
 		switch {
 		default:
 			fallthrough
 		case requestedBp.Addr != 0:
 			fmt.Fprintf(out, "error: process exited\n")
-			return
+			return nil
 		case requestedBp.FunctionName != "":
 			ScheduledBreakpoints = append(ScheduledBreakpoints, fmt.Sprintf("B%s", requestedBp.FunctionName))
 		case requestedBp.File != "":
 			ScheduledBreakpoints = append(ScheduledBreakpoints, fmt.Sprintf("T%s:%d", requestedBp.File, requestedBp.Line))
 		}
 		fmt.Fprintf(out, "Breakpoint will be set on restart\n")
-		return
+		return nil
 	}
 	bp, err := client.CreateBreakpoint(requestedBp)
 	if err != nil {
 		fmt.Fprintf(out, "Could not create breakpoint: %v\n", err)
+		return nil
 	}
 
 	fmt.Fprintf(out, "%s set at %s\n", formatBreakpointName(bp, true), formatBreakpointLocation(bp))
 	freezeBreakpoint(out, bp)
+	return bp
 }
 
 func breakpoint(out io.Writer, args string) error {
@@ -370,6 +621,22 @@ func breakpoint(out io.Writer, args string) error {
 }
 
 func tracepoint(out io.Writer, args string) error {
+	const logPrefix = "-log "
+	if strings.HasPrefix(args, logPrefix) {
+		logfmt, logexprs, rest, err := parseLogpoint(args[len(logPrefix):])
+		if err != nil {
+			return err
+		}
+		return setBreakpointLog(out, true, rest, logfmt, logexprs, false)
+	}
+	const changedPrefix = "-changed "
+	if strings.HasPrefix(args, changedPrefix) {
+		fields := strings.SplitN(strings.TrimSpace(args[len(changedPrefix):]), " ", 2)
+		if len(fields) < 2 {
+			return fmt.Errorf("wrong number of arguments: trace -changed <expr> [name] <linespec>")
+		}
+		return setBreakpointLog(out, true, strings.TrimSpace(fields[1]), "", fields[:1], true)
+	}
 	return setBreakpoint(out, true, args)
 }
 
@@ -388,10 +655,85 @@ func clear(out io.Writer, args string) error {
 	if err != nil {
 		return err
 	}
+	forgetBreakpoint(bp.ID)
 	fmt.Fprintf(out, "%s cleared at %s\n", formatBreakpointName(bp, true), formatBreakpointLocation(bp))
 	return nil
 }
 
+func disableCommand(out io.Writer, args string) error {
+	args = strings.TrimSpace(args)
+	if len(args) == 0 {
+		return fmt.Errorf("not enough arguments")
+	}
+	id, err := strconv.Atoi(args)
+	var bp *api.Breakpoint
+	if err == nil {
+		bp, err = client.GetBreakpoint(id)
+	} else {
+		bp, err = client.GetBreakpointByName(args)
+	}
+	if err != nil {
+		return err
+	}
+	if !isFrozenBreakpoint(bp.ID) {
+		return fmt.Errorf("%s can not be disabled", formatBreakpointName(bp, false))
+	}
+	disableBreakpoint(bp)
+	fmt.Fprintf(out, "%s disabled at %s\n", formatBreakpointName(bp, true), formatBreakpointLocation(bp))
+	return nil
+}
+
+func enableCommand(out io.Writer, args string) error {
+	args = strings.TrimSpace(args)
+	if len(args) == 0 {
+		return fmt.Errorf("not enough arguments")
+	}
+	id, err := strconv.Atoi(args)
+	for i := range DisabledBreakpoints {
+		bp := DisabledBreakpoints[i].Bp
+		if (err == nil && (bp.ID == id || bp.ID == id+disabledBreakpointIDOffset)) || (err != nil && bp.Name == args) {
+			enableBreakpoint(&bp)
+			fmt.Fprintf(out, "Breakpoint %s enabled at %s\n", args, formatBreakpointLocation(&bp))
+			return nil
+		}
+	}
+	return fmt.Errorf("no disabled breakpoint %s", args)
+}
+
+func clearAll(out io.Writer, args string) error {
+	var re *regexp.Regexp
+	if args = strings.TrimSpace(args); args != "" {
+		var err error
+		re, err = regexp.Compile(args)
+		if err != nil {
+			return err
+		}
+	}
+	bps, err := client.ListBreakpoints()
+	if err != nil {
+		return err
+	}
+	defer refreshState(refreshToSameFrame, clearBreakpoint, nil)
+	n := 0
+	for _, bp := range bps {
+		if bp.ID < 0 {
+			continue
+		}
+		if re != nil && !re.MatchString(bp.Name) && !re.MatchString(bp.FunctionName) {
+			continue
+		}
+		if _, err := client.ClearBreakpoint(bp.ID); err != nil {
+			fmt.Fprintf(out, "Could not clear %s: %v\n", formatBreakpointName(bp, false), err)
+			continue
+		}
+		removeFrozenBreakpoint(bp)
+		forgetBreakpoint(bp.ID)
+		n++
+	}
+	fmt.Fprintf(out, "Cleared %d breakpoints\n", n)
+	return nil
+}
+
 func restart(out io.Writer, args string) error {
 	resetArgs := false
 	var newArgs []string
@@ -424,6 +766,13 @@ func restart(out io.Writer, args string) error {
 		return err
 	}
 
+	if BackendServer.workdir != BackendServer.launchWorkdir {
+		go pseudoCommandWrap(func(w io.Writer) error {
+			return BackendServer.Relaunch(w, resetArgs, newArgs)
+		})
+		return nil
+	}
+
 	if BackendServer.StaleExecutable() {
 		wnd.PopupOpen("Recompile?", dynamicPopupFlags, rect.Rect{100, 100, 550, 400}, true, func(w *nucular.Window) {
 			w.Row(30).Static(0)
@@ -532,6 +881,7 @@ func pseudoCommandWrap(cmd func(io.Writer) error) {
 }
 
 func doRestart(out io.Writer, resetArgs bool, args []string) error {
+	cancelPendingNext(out)
 	_, err := client.RestartFrom("", resetArgs, args)
 	if err != nil {
 		return err
@@ -550,6 +900,7 @@ func doRebuild(out io.Writer, resetArgs bool, args []string) error {
 
 	updateFrozenBreakpoints()
 	clearFrozenBreakpoints()
+	cancelPendingNext(out)
 
 	discarded, err := client.RestartFrom("", resetArgs, args)
 	if err != nil {
@@ -569,22 +920,54 @@ func doRebuild(out io.Writer, resetArgs bool, args []string) error {
 	return nil
 }
 
+// cancelPendingNext cancels a next, step or stepout that is still in
+// progress before the target is restarted, or warns about it if
+// conf.KeepNextOnRestart is set.
+func cancelPendingNext(out io.Writer) {
+	state, err := client.GetStateNonBlocking()
+	if err != nil || state == nil || !state.NextInProgress {
+		return
+	}
+	interruptedGid = -1
+	if conf.KeepNextOnRestart {
+		fmt.Fprintf(out, "Warning: a next, step or stepout is in progress, stepping commands will fail until it is cancelled\n")
+		return
+	}
+	if err := client.CancelNext(); err != nil {
+		fmt.Fprintf(out, "Could not cancel next: %v\n", err)
+		return
+	}
+	fmt.Fprintf(out, "Cancelled next in progress\n")
+}
+
 func cont(out io.Writer, args string) error {
-	stateChan := client.Continue()
+	if args = strings.TrimSpace(args); args != "" {
+		return continueToLocspec(out, args)
+	}
+	interruptedGid = -1
 	var state *api.DebuggerState
-	for state = range stateChan {
-		if state.Err != nil {
-			refreshState(refreshToFrameZero, clearStop, state)
-			return state.Err
+	for resume := true; resume; {
+		resume = false
+		stateChan := profileContinue(client.Continue)
+		for state = range stateChan {
+			if state.Err != nil {
+				refreshState(refreshToFrameZero, clearStop, state)
+				return state.Err
+			}
+			if !prevConditionsStop(out, state) {
+				resume = true
+				continue
+			}
+			printcontext(out, state)
 		}
-		printcontext(out, state)
 	}
 	refreshState(refreshToFrameZero, clearStop, state)
 	return nil
 }
 
 func rewind(out io.Writer, args string) error {
-	stateChan := client.Rewind()
+	interruptedGid = -1
+	stateChan := profileContinue(client.Rewind)
 	var state *api.DebuggerState
 	for state = range stateChan {
 		if state.Err != nil {
@@ -606,20 +989,50 @@ const (
 	continueActionStopWithoutCancel
 )
 
-func continueUntilCompleteNext(out io.Writer, state *api.DebuggerState, op string, bp *api.Breakpoint) error {
+// sessionContinueAction is the answer to the "breakpoint hit during next"
+// question that the user asked to remember for the rest of the session.
+var sessionContinueAction struct {
+	set    bool
+	action continueAction
+}
+
+// interruptedGid is the goroutine that a next, step or stepout was
+// executing on when the user chose to stop at a breakpoint hit by a
+// different goroutine, or -1.
+var interruptedGid = -1
+
+// continueUntilCompleteNext continues until the next, step or stepout
+// started by goroutine opGid is completed.
+func continueUntilCompleteNext(out io.Writer, state *api.DebuggerState, op string, opGid int, bp *api.Breakpoint) error {
+	_, err := continueUntilCompleteNextState(out, state, op, opGid, bp)
+	return err
+}
+
+// continueUntilCompleteNextState is like continueUntilCompleteNext but also
+// returns the state where execution stopped.
+func continueUntilCompleteNextState(out io.Writer, state *api.DebuggerState, op string, opGid int, bp *api.Breakpoint) (*api.DebuggerState, error) {
 	ignoreAll := false
+	interruptedGid = -1
 	if !state.NextInProgress {
 		goto continueCompleted
 	}
 continueLoop:
 	for {
-		stateChan := client.Continue()
+		stateChan := profileContinue(client.Continue)
+		resume := false
 		for state = range stateChan {
 			if state.Err != nil {
 				break continueLoop
 			}
+			if !prevConditionsStop(out, state) {
+				resume = true
+				continue
+			}
 			printcontext(out, state)
 		}
+		if resume && state.NextInProgress {
+			continue
+		}
 		if bp != nil {
 			for _, th := range state.Threads {
 				if th.Breakpoint != nil && th.Breakpoint.ID == bp.ID {
@@ -636,41 +1049,55 @@ continueLoop:
 			continue
 		}
 
-		answerChan := make(chan continueAction)
-		wnd.PopupOpen("Configuration", dynamicPopupFlags, rect.Rect{100, 100, 600, 700}, true, func(w *nucular.Window) {
-			w.Row(20).Dynamic(1)
-			w.Label(fmt.Sprintf("Another goroutine hit a breakpoint before '%s' finished.", op), "LC")
-			w.Label(fmt.Sprintf("You can either chose to ignore other breakpoints and finish '%s' or to stop here.", op), "LC")
-			w.Row(80).Dynamic(1)
-			w.LabelWrap(fmt.Sprintf("If you chose to stop here you can either cancel '%s' or suspend it; if you chose  to suspend it you won't be able to 'step', 'next' or 'stepout' until you either     cancel it or complete it.", op))
-
-			w.Row(30).Dynamic(1)
-			if w.ButtonText(fmt.Sprintf("continue '%s', ignore this breakpoint", op)) {
-				answerChan <- continueActionIgnoreThis
-				w.Close()
-			}
-			if w.ButtonText(fmt.Sprintf("continue '%s', ignore any other breakpoints", op)) {
-				answerChan <- continueActionIgnoreAll
-				w.Close()
-			}
-			if w.ButtonText(fmt.Sprintf("stop here, cancel '%s'", op)) {
-				answerChan <- continueActionStopAndCancel
-				w.Close()
-			}
-			if w.ButtonText(fmt.Sprintf("stop here, do not cancel '%s'", op)) {
-				answerChan <- continueActionStopWithoutCancel
-				w.Close()
-			}
-		})
-		switch <-answerChan {
+		var action continueAction
+		if sessionContinueAction.set {
+			action = sessionContinueAction.action
+		} else {
+			answerChan := make(chan continueAction)
+			remember := false
+			wnd.PopupOpen("Configuration", dynamicPopupFlags, rect.Rect{100, 100, 600, 700}, true, func(w *nucular.Window) {
+				w.Row(20).Dynamic(1)
+				w.Label(fmt.Sprintf("Another goroutine hit a breakpoint before '%s' finished.", op), "LC")
+				w.Label(fmt.Sprintf("You can either chose to ignore other breakpoints and finish '%s' or to stop here.", op), "LC")
+				w.Row(80).Dynamic(1)
+				w.LabelWrap(fmt.Sprintf("If you chose to stop here you can either cancel '%s' or suspend it; if you chose  to suspend it you won't be able to 'step', 'next' or 'stepout' until you either     cancel it or complete it.", op))
+
+				w.Row(30).Dynamic(1)
+				w.CheckboxText("Remember my choice for this session", &remember)
+				answer := func(action continueAction) {
+					if remember {
+						sessionContinueAction.set = true
+						sessionContinueAction.action = action
+					}
+					answerChan <- action
+					w.Close()
+				}
+				if w.ButtonText(fmt.Sprintf("continue '%s', ignore this breakpoint", op)) {
+					answer(continueActionIgnoreThis)
+				}
+				if w.ButtonText(fmt.Sprintf("continue '%s', ignore any other breakpoints", op)) {
+					answer(continueActionIgnoreAll)
+				}
+				if w.ButtonText(fmt.Sprintf("stop here, cancel '%s'", op)) {
+					answer(continueActionStopAndCancel)
+				}
+				if w.ButtonText(fmt.Sprintf("stop here, do not cancel '%s'", op)) {
+					answer(continueActionStopWithoutCancel)
+				}
+			})
+			action = <-answerChan
+		}
+		switch action {
 		case continueActionIgnoreThis:
 			// nothing to do
 		case continueActionIgnoreAll:
 			ignoreAll = true
 		case continueActionStopAndCancel:
 			client.CancelNext()
+			rememberInterruptedGoroutine(out, state, op, opGid)
 			break continueLoop
 		case continueActionStopWithoutCancel:
+			rememberInterruptedGoroutine(out, state, op, opGid)
 			break continueLoop
 		}
 
@@ -679,24 +1106,53 @@ continueLoop:
 
 continueCompleted:
 	refreshState(refreshToFrameZero, clearStop, state)
-	return nil
+	return state, nil
 }
 
-func step(out io.Writer, args string) error {
-	getsics := func() ([]stepIntoCall, uint64, error) {
-		state, err := client.GetState()
-		if err != nil {
-			return nil, 0, err
-		}
-		if curGid < 0 {
-			return nil, 0, errors.New("no selected goroutine")
-		}
-		loc := currentLocation(state)
-		if loc == nil {
-			return nil, 0, errors.New("could not find current location")
-		}
-		return stepIntoList(*loc), state.CurrentThread.PC, nil
+func rememberInterruptedGoroutine(out io.Writer, state *api.DebuggerState, op string, opGid int) {
+	if opGid < 0 || state.SelectedGoroutine == nil || state.SelectedGoroutine.ID == opGid {
+		return
+	}
+	interruptedGid = opGid
+	fmt.Fprintf(out, "Stopped on goroutine %d, '%s' was executing on goroutine %d, use the \"back to goroutine %d\" button to switch back to it\n", state.SelectedGoroutine.ID, op, opGid, opGid)
+}
+
+// switchToInterruptedGoroutine selects the goroutine that was executing a
+// next, step or stepout before it was interrupted by a breakpoint.
+func switchToInterruptedGoroutine() {
+	gid := interruptedGid
+	interruptedGid = -1
+	if gid < 0 {
+		return
+	}
+	state, err := client.SwitchGoroutine(gid)
+	if err != nil {
+		out := editorWriter{&scrollbackEditor, true}
+		fmt.Fprintf(&out, "Could not switch goroutine: %v\n", err)
+		return
+	}
+	refreshState(refreshToFrameZero, clearGoroutineSwitch, state)
+}
+
+// currentStepIntoCalls returns the calls on the current line of the
+// selected goroutine and the current PC.
+func currentStepIntoCalls() ([]stepIntoCall, uint64, error) {
+	state, err := client.GetState()
+	if err != nil {
+		return nil, 0, err
+	}
+	if curGid < 0 {
+		return nil, 0, errors.New("no selected goroutine")
+	}
+	loc := currentLocation(state)
+	if loc == nil {
+		return nil, 0, errors.New("could not find current location")
 	}
+	return stepIntoList(*loc), state.CurrentThread.PC, nil
+}
+
+func step(out io.Writer, args string) error {
+	getsics := currentStepIntoCalls
 
 	if args == "" {
 		args = conf.DefaultStepBehaviour
@@ -714,14 +1170,18 @@ func step(out io.Writer, args string) error {
 			return stepIntoFirst(out)
 		}
 
-	case "-list":
+	case "-list", "-list -all":
 		sics, pc, err := getsics()
 		if err != nil {
 			return err
 		}
+		all := args == "-list -all"
 		for _, sic := range sics {
-			if sic.Inst.Loc.PC >= pc {
+			switch {
+			case sic.Inst.Loc.PC >= pc:
 				fmt.Fprintf(out, "%s\t%s\n", sic.Name, sic.ExprString())
+			case all:
+				fmt.Fprintf(out, "%s\t%s\t(already executed)\n", sic.Name, sic.ExprString())
 			}
 		}
 	default:
@@ -740,12 +1200,86 @@ func step(out io.Writer, args string) error {
 }
 
 func stepIntoFirst(out io.Writer) error {
+	gid := curGid
+	skipped := stoppedInSkippedPackage()
 	state, err := client.Step()
 	if err != nil {
 		return err
 	}
 	printcontext(out, state)
-	return continueUntilCompleteNext(out, state, "step", nil)
+	state, err = continueUntilCompleteNextState(out, state, "step", gid, nil)
+	if err != nil || skipped {
+		return err
+	}
+	return stepOutOfSkippedPackages(out, state)
+}
+
+// functionPackage returns the package path of the function called fnname.
+func functionPackage(fnname string) string {
+	slash := strings.LastIndex(fnname, "/")
+	if dot := strings.Index(fnname[slash+1:], "."); dot >= 0 {
+		return fnname[:slash+1+dot]
+	}
+	return fnname
+}
+
+// inSkippedPackage returns true if fnname belongs to one of the packages in
+// conf.StepSkipPackages, or one of their subpackages.
+func inSkippedPackage(fnname string) bool {
+	pkg := functionPackage(fnname)
+	for _, skip := range conf.StepSkipPackages {
+		if pkg == skip || strings.HasPrefix(pkg, skip+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// stoppedInSkippedPackage returns true if the target is currently stopped
+// inside one of the packages in conf.StepSkipPackages, in which case the
+// user is stepping through that package on purpose and stepping commands
+// should not step out of it.
+func stoppedInSkippedPackage() bool {
+	if conf.StepSkipDepth <= 0 || len(conf.StepSkipPackages) == 0 {
+		return false
+	}
+	state, err := client.GetState()
+	if err != nil {
+		return false
+	}
+	loc := currentLocation(state)
+	return loc != nil && loc.Function != nil && inSkippedPackage(loc.Function.Name())
+}
+
+// stepOutOfSkippedPackages executes stepout, up to conf.StepSkipDepth
+// times, while the current location is inside one of the packages in
+// conf.StepSkipPackages.
+func stepOutOfSkippedPackages(out io.Writer, state *api.DebuggerState) error {
+	gid := curGid
+	for i := 0; i < conf.StepSkipDepth; i++ {
+		if state == nil || state.Exited || state.NextInProgress {
+			return nil
+		}
+		if state.CurrentThread != nil && state.CurrentThread.Breakpoint != nil {
+			return nil
+		}
+		loc := currentLocation(state)
+		if loc == nil || loc.Function == nil || !inSkippedPackage(loc.Function.Name()) {
+			return nil
+		}
+		fmt.Fprintf(out, "Stepping out of %s\n", loc.Function.Name())
+		var err error
+		state, err = client.StepOut()
+		if err != nil {
+			return err
+		}
+		printcontext(out, state)
+		state, err = continueUntilCompleteNextState(out, state, "stepout", gid, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func stepInto(out io.Writer, sic stepIntoCall) error {
@@ -771,7 +1305,7 @@ func stepInto(out io.Writer, sic stepIntoCall) error {
 		return err
 	}
 	printcontext(out, state)
-	err = continueUntilCompleteNext(out, state, "step", nil)
+	err = continueUntilCompleteNext(out, state, "step", curGid, nil)
 	client.ClearBreakpoint(bp.ID)
 	if err != nil {
 		return err
@@ -800,31 +1334,127 @@ func stepInstruction(out io.Writer, args string) error {
 }
 
 func next(out io.Writer, args string) error {
+	const untilPrefix = "-until "
+	if args = strings.TrimSpace(args); strings.HasPrefix(args, untilPrefix) {
+		return nextUntil(out, strings.TrimSpace(args[len(untilPrefix):]))
+	}
+	gid := curGid
+	skipped := stoppedInSkippedPackage()
 	state, err := client.Next()
 	if err != nil {
 		return err
 	}
 	printcontext(out, state)
-	return continueUntilCompleteNext(out, state, "next", nil)
-}
-
-func stepout(out io.Writer, args string) error {
-	state, err := client.StepOut()
-	if err != nil {
+	state, err = continueUntilCompleteNextState(out, state, "next", gid, nil)
+	if err != nil || skipped {
 		return err
 	}
-	printcontext(out, state)
-	return continueUntilCompleteNext(out, state, "stepout", nil)
+	return stepOutOfSkippedPackages(out, state)
 }
 
-func cancelnext(out io.Writer, args string) error {
-	return client.CancelNext()
-}
+const maxNextUntilSteps = 10000
+
+// nextUntil executes next until cond becomes true or the current function
+// returns.
+func nextUntil(out io.Writer, cond string) error {
+	if cond == "" {
+		return errors.New("no condition specified")
+	}
+	evalCond := func() (bool, error) {
+		v := evalScopedExpr(cond, ShortLoadConfig)
+		if v.Unreadable != "" {
+			return false, fmt.Errorf("could not evaluate %s: %s", cond, v.Unreadable)
+		}
+		if v.Kind != reflect.Bool {
+			return false, fmt.Errorf("%s is not a boolean expression", cond)
+		}
+		return v.Value == "true", nil
+	}
+	if _, err := evalCond(); err != nil {
+		return err
+	}
+
+	state, err := client.GetState()
+	if err != nil {
+		return err
+	}
+	loc := currentLocation(state)
+	if loc == nil || loc.Function == nil {
+		return errors.New("could not find current function")
+	}
+	fnname := loc.Function.Name()
+	gid := curGid
+
+	for i := 0; i < maxNextUntilSteps; i++ {
+		state, err = client.Next()
+		if err != nil {
+			return err
+		}
+		state, err = continueUntilCompleteNextState(out, state, "next", gid, nil)
+		if err != nil {
+			return err
+		}
+		if state.Exited || state.NextInProgress {
+			return nil
+		}
+		if state.CurrentThread != nil && state.CurrentThread.Breakpoint != nil {
+			fmt.Fprintf(out, "Stopped at a breakpoint before %s became true\n", cond)
+			return nil
+		}
+		loc := currentLocation(state)
+		if loc == nil || loc.Function == nil || loc.Function.Name() != fnname {
+			fmt.Fprintf(out, "Stepped out of %s without %s becoming true\n", fnname, cond)
+			return nil
+		}
+		ok, err := evalCond()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s:%d %s = %v\n", abbrevFileName(loc.File), loc.Line, cond, ok)
+		if ok {
+			return nil
+		}
+	}
+	fmt.Fprintf(out, "Gave up after %d steps\n", maxNextUntilSteps)
+	return nil
+}
+
+func stepout(out io.Writer, args string) error {
+	showRet := false
+	switch args = strings.TrimSpace(args); args {
+	case "":
+	case "-ret":
+		showRet = true
+	default:
+		return fmt.Errorf("unknown argument %q", args)
+	}
+	gid := curGid
+	state, err := client.StepOut()
+	if err != nil {
+		return err
+	}
+	printcontext(out, state)
+	state, err = continueUntilCompleteNextState(out, state, "stepout", gid, nil)
+	if err != nil || !showRet {
+		return err
+	}
+	if state != nil && state.CurrentThread != nil {
+		localsPanel.returns = wrapApiVariables(state.CurrentThread.ReturnValues, 0, 0, "", true)
+	}
+	return nil
+}
+
+func cancelnext(out io.Writer, args string) error {
+	return client.CancelNext()
+}
 
 func interrupt(out io.Writer, args string) error {
-	if args == "eof" {
+	switch args {
+	case "eof":
 		close(BackendServer.stdinChan)
 		return nil
+	case "-cancel":
+		return interruptAndCancel(out)
 	}
 	_, err := client.Halt()
 	if err != nil {
@@ -834,11 +1464,37 @@ func interrupt(out io.Writer, args string) error {
 	return nil
 }
 
+// interruptAndCancel stops the target, if it is running, and cancels the
+// next operation in progress.
+func interruptAndCancel(out io.Writer) error {
+	if client.Running() {
+		if _, err := client.Halt(); err != nil {
+			return err
+		}
+	}
+	if err := client.CancelNext(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Next operation canceled\n")
+	refreshState(refreshToFrameZero, clearStop, nil)
+	return nil
+}
+
 func printVar(out io.Writer, args string) error {
+	nanCheck := false
+	if strings.HasPrefix(args, "-nan ") {
+		nanCheck = true
+		args = strings.TrimSpace(args[len("-nan "):])
+	}
 	if len(args) == 0 {
 		return fmt.Errorf("not enough arguments")
 	}
 	val := evalScopedExpr(args, getVariableLoadConfig())
+	if se := ParseScopedExpr(args); val.Unreadable != "" && se.Kind != InvalidScopeExpr && !strings.HasPrefix(se.EvalExpr, "$") && exprHasCall(se.EvalExpr) {
+		// type conversions look like function calls, only inject a call if
+		// the expression evaluator couldn't handle it.
+		val = evalCallExpr(out, args, getVariableLoadConfig())
+	}
 	valstr := wrapApiVariableSimple(val).MultilineString("")
 	nlcount := 0
 	for _, ch := range valstr {
@@ -852,6 +1508,15 @@ func printVar(out io.Writer, args string) error {
 	} else {
 		fmt.Fprintln(out, valstr)
 	}
+	if nanCheck && val.Unreadable == "" {
+		specials := findSpecialFloats(val, ParseScopedExpr(args).EvalExpr, nil)
+		if len(specials) == 0 {
+			fmt.Fprintln(out, "No NaN, Inf or denormal values found")
+		}
+		for _, s := range specials {
+			fmt.Fprintf(out, "\t%s\n", s)
+		}
+	}
 	return nil
 }
 
@@ -860,7 +1525,413 @@ func displayVar(out io.Writer, args string) error {
 	return nil
 }
 
+func monitorVar(out io.Writer, args string) error {
+	args = strings.TrimSpace(args)
+	switch {
+	case args == "":
+		if len(MonitoredExpressions) == 0 {
+			fmt.Fprintln(out, "No monitored expressions")
+		}
+		for i, expr := range MonitoredExpressions {
+			fmt.Fprintf(out, "%d\t%s\n", i, expr)
+		}
+		return nil
+
+	case args == "-clear" || strings.HasPrefix(args, "-clear "):
+		expr := strings.TrimSpace(args[len("-clear"):])
+		if expr == "" {
+			MonitoredExpressions = MonitoredExpressions[:0]
+			saveConfiguration()
+			return nil
+		}
+		for i := range MonitoredExpressions {
+			if MonitoredExpressions[i] == expr {
+				copy(MonitoredExpressions[i:], MonitoredExpressions[i+1:])
+				MonitoredExpressions = MonitoredExpressions[:len(MonitoredExpressions)-1]
+				saveConfiguration()
+				return nil
+			}
+		}
+		return fmt.Errorf("expression %q is not monitored", expr)
+	}
+
+	for _, expr := range MonitoredExpressions {
+		if expr == args {
+			return fmt.Errorf("expression %q is already monitored", args)
+		}
+	}
+	MonitoredExpressions = append(MonitoredExpressions, args)
+	saveConfiguration()
+	restoreMonitoredExpressions()
+	return nil
+}
+
+func letVar(out io.Writer, args string) error {
+	eq := strings.Index(args, "=")
+	if eq < 0 {
+		return fmt.Errorf("syntax error, expected <name> = <expression>")
+	}
+	name := strings.TrimSpace(args[:eq])
+	expr := strings.TrimSpace(args[eq+1:])
+	if t, err := parser.ParseExpr(name); err != nil || !isIdent(t) {
+		return fmt.Errorf("%q is not a valid name", name)
+	}
+	if expr == "" {
+		return fmt.Errorf("not enough arguments")
+	}
+	v := evalScopedExpr(expr, getVariableLoadConfig())
+	if v.Unreadable != "" {
+		return fmt.Errorf("could not evaluate %s: %s", expr, v.Unreadable)
+	}
+	return StarlarkEnv.SetGlobal(name, v)
+}
+
+func isIdent(t ast.Expr) bool {
+	_, ok := t.(*ast.Ident)
+	return ok
+}
+
+// mapSnapshots contains the last snapshot taken by map-diff for each
+// expression, as a map from the string representation of keys to the
+// string representation of values.
+var mapSnapshots = map[string]map[string]string{}
+
+func mapDiffCommand(out io.Writer, args string) error {
+	expr := strings.TrimSpace(args)
+	if expr == "" {
+		return fmt.Errorf("not enough arguments")
+	}
+	if expr == "-clear" || strings.HasPrefix(expr, "-clear ") {
+		expr = strings.TrimSpace(expr[len("-clear"):])
+		if expr == "" {
+			mapSnapshots = map[string]map[string]string{}
+		} else {
+			delete(mapSnapshots, expr)
+		}
+		return nil
+	}
+
+	v := evalScopedExpr(expr, LongArrayLoadConfig)
+	if v.Unreadable != "" {
+		return fmt.Errorf("could not evaluate %s: %s", expr, v.Unreadable)
+	}
+	if v.Kind != reflect.Map {
+		return fmt.Errorf("%s is not a map", expr)
+	}
+	truncated, err := loadFullMap(v)
+	if err != nil {
+		return err
+	}
+	if truncated {
+		fmt.Fprintf(out, "%s has %d entries, only the first %d will be compared\n", expr, v.Len, maxFullMapLen)
+	}
+
+	cur := make(map[string]string, len(v.Children)/2)
+	for i := 0; i+1 < len(v.Children); i += 2 {
+		cur[prettyprint.Singleline(&v.Children[i], false, false)] = prettyprint.Singleline(&v.Children[i+1], false, false)
+	}
+
+	old, ok := mapSnapshots[expr]
+	mapSnapshots[expr] = cur
+	if !ok {
+		fmt.Fprintf(out, "Snapshot of %s taken (%d entries)\n", expr, len(cur))
+		return nil
+	}
+
+	var added, removed, changed []string
+	for k, val := range cur {
+		oldval, ok := old[k]
+		switch {
+		case !ok:
+			added = append(added, fmt.Sprintf("+ %s: %s", k, val))
+		case oldval != val:
+			changed = append(changed, fmt.Sprintf("~ %s: %s -> %s", k, oldval, val))
+		}
+	}
+	for k, oldval := range old {
+		if _, ok := cur[k]; !ok {
+			removed = append(removed, fmt.Sprintf("- %s: %s", k, oldval))
+		}
+	}
+
+	if len(added)+len(removed)+len(changed) == 0 {
+		fmt.Fprintf(out, "No changes to %s (%d entries)\n", expr, len(cur))
+		return nil
+	}
+	for _, diff := range [][]string{added, removed, changed} {
+		sort.Strings(diff)
+		for _, s := range diff {
+			fmt.Fprintln(out, s)
+		}
+	}
+	fmt.Fprintf(out, "%d added, %d removed, %d changed\n", len(added), len(removed), len(changed))
+	return nil
+}
+
+// embedsMaxDepth is the maximum depth of embedding explored by the embeds
+// command.
+const embedsMaxDepth = 5
+
+var embedsLoadConfig = api.LoadConfig{FollowPointers: true, MaxVariableRecurse: embedsMaxDepth, MaxStringLen: 1, MaxArrayValues: 0, MaxStructFields: -1}
+
+// ptypeBase is the address of the values used to inspect a type, the
+// memory there is never actually read.
+const ptypeBase = 0x1000
+
+var ptypeLoadConfig = api.LoadConfig{MaxVariableRecurse: 1, MaxArrayValues: 2, MaxStructFields: -1}
+
+func ptypeCommand(out io.Writer, args string) error {
+	arg := strings.TrimSpace(args)
+	if arg == "" {
+		return fmt.Errorf("not enough arguments")
+	}
+	typ := arg
+	if types, err := client.ListTypes("^" + regexp.QuoteMeta(arg) + "$"); err != nil || len(types) == 0 {
+		v := evalScopedExpr(arg, api.LoadConfig{})
+		if v.Type == "" {
+			return fmt.Errorf("could not evaluate %s: %s", arg, v.Unreadable)
+		}
+		typ = v.Type
+		fmt.Fprintf(out, "%s: %s\n", arg, typ)
+	}
+
+	v, size, err := typeLayout(typ)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "type %s %s (size %d)\n", typ, v.Kind, size)
+	if v.RealType != "" && v.RealType != typ {
+		fmt.Fprintf(out, "underlying type %s\n", v.RealType)
+	}
+	if v.Kind != reflect.Struct {
+		return nil
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 8, 1, ' ', 0)
+	fmt.Fprintf(w, "\toffset\tsize\tfield\ttype\n")
+	for i := range v.Children {
+		field := &v.Children[i]
+		end := ptypeBase + size
+		if i+1 < len(v.Children) {
+			end = v.Children[i+1].Addr
+		}
+		fmt.Fprintf(w, "\t%d\t%d\t%s\t%s\n", field.Addr-ptypeBase, end-field.Addr, field.Name, field.Type)
+	}
+	return w.Flush()
+}
+
+// typeLayout returns a value of type typ, with children for each field if
+// typ is a struct, and the size of typ. The value is evaluated as the first
+// element of a two element array at ptypeBase so that its size can be read
+// from the address of the second element.
+func typeLayout(typ string) (*api.Variable, uintptr, error) {
+	expr := fmt.Sprintf("*(*[2]%s)(%#x)", ptypeTypeExpr(typ), ptypeBase)
+	v, err := client.EvalVariable(currentEvalScope(), expr, ptypeLoadConfig)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(v.Children) != 2 {
+		return nil, 0, fmt.Errorf("could not determine layout of %s", typ)
+	}
+	return &v.Children[0], v.Children[1].Addr - v.Children[0].Addr, nil
+}
+
+// ptypeTypeExpr converts a type name into an expression, quoting the package
+// path if it contains characters that are not valid in an identifier.
+func ptypeTypeExpr(typ string) string {
+	if strings.ContainsAny(typ, "*[]() ") {
+		return typ
+	}
+	slash := strings.LastIndex(typ, "/")
+	dot := strings.LastIndex(typ[slash+1:], ".")
+	if dot < 0 {
+		return typ
+	}
+	dot += slash + 1
+	pkg := typ[:dot]
+	if !strings.ContainsAny(pkg, "./") {
+		return typ
+	}
+	return fmt.Sprintf("%q%s", pkg, typ[dot:])
+}
+
+// embeddedType describes a struct type reached through embedding.
+type embeddedType struct {
+	path       string
+	typ        string
+	depth      int
+	note       string
+	fields     []string
+	methods    []string
+	ptrMethods []string
+}
+
+func embedsCommand(out io.Writer, args string) error {
+	expr := strings.TrimSpace(args)
+	if expr == "" {
+		return fmt.Errorf("not enough arguments")
+	}
+	v := evalScopedExpr(expr, embedsLoadConfig)
+	if v.Unreadable != "" {
+		return fmt.Errorf("could not evaluate %s: %s", expr, v.Unreadable)
+	}
+	if v.Kind == reflect.Ptr && len(v.Children) == 1 {
+		v = &v.Children[0]
+	}
+	if v.Kind != reflect.Struct {
+		return fmt.Errorf("%s is not a struct (%s)", expr, v.Type)
+	}
+
+	ets := collectEmbeddedTypes(v, expr, 0, nil)
+
+	// a name is promoted from the shallowest depth that defines it, if it is
+	// defined exactly once at that depth
+	mindepth := map[string]int{}
+	count := map[string]int{}
+	for _, et := range ets {
+		for _, names := range [][]string{et.fields, et.methods, et.ptrMethods} {
+			for _, name := range names {
+				if d, ok := mindepth[name]; !ok || et.depth < d {
+					mindepth[name] = et.depth
+					count[name] = 0
+				}
+				if et.depth == mindepth[name] {
+					count[name]++
+				}
+			}
+		}
+	}
+	describe := func(et *embeddedType, names []string) string {
+		r := make([]string, len(names))
+		for i, name := range names {
+			switch {
+			case mindepth[name] < et.depth:
+				r[i] = name + " (shadowed)"
+			case count[name] > 1:
+				r[i] = name + " (ambiguous)"
+			default:
+				r[i] = name
+			}
+		}
+		return strings.Join(r, ", ")
+	}
+
+	for i := range ets {
+		et := &ets[i]
+		indent := strings.Repeat("    ", et.depth)
+		fmt.Fprintf(out, "%s%s %s%s\n", indent, et.path, et.typ, et.note)
+		if len(et.fields) > 0 {
+			fmt.Fprintf(out, "%s    fields: %s\n", indent, describe(et, et.fields))
+		}
+		if len(et.methods) > 0 {
+			fmt.Fprintf(out, "%s    methods: %s\n", indent, describe(et, et.methods))
+		}
+		if len(et.ptrMethods) > 0 {
+			fmt.Fprintf(out, "%s    pointer methods: %s\n", indent, describe(et, et.ptrMethods))
+		}
+	}
+	return nil
+}
+
+// collectEmbeddedTypes appends to r a description of v, followed by the
+// descriptions of all the types embedded in it.
+func collectEmbeddedTypes(v *api.Variable, path string, depth int, r []embeddedType) []embeddedType {
+	et := embeddedType{path: path, typ: v.Type, depth: depth}
+	et.methods, et.ptrMethods = typeMethods(funcsPanel.slice, v.Type)
+	if v.Kind == reflect.Struct && int(v.Len) != len(v.Children) {
+		et.note = " (not loaded)"
+	}
+	var embedded []*api.Variable
+	for i := range v.Children {
+		f := &v.Children[i]
+		et.fields = append(et.fields, f.Name)
+		if isEmbeddedField(f) {
+			embedded = append(embedded, f)
+		}
+	}
+	r = append(r, et)
+
+	for _, f := range embedded {
+		fpath := path + "." + f.Name
+		switch {
+		case f.Kind == reflect.Ptr && (len(f.Children) == 0 || f.Children[0].Addr == 0):
+			r = append(r, embeddedType{path: fpath, typ: f.Type, depth: depth + 1, note: " (nil)"})
+		case f.Kind == reflect.Ptr:
+			r = collectEmbeddedTypes(&f.Children[0], fpath, depth+1, r)
+		case f.Kind == reflect.Struct && depth+1 <= embedsMaxDepth:
+			r = collectEmbeddedTypes(f, fpath, depth+1, r)
+		default:
+			ef := embeddedType{path: fpath, typ: f.Type, depth: depth + 1}
+			if f.Kind == reflect.Interface {
+				ef.note = " (interface)"
+			} else {
+				ef.methods, ef.ptrMethods = typeMethods(funcsPanel.slice, f.Type)
+			}
+			r = append(r, ef)
+		}
+	}
+	return r
+}
+
+// isEmbeddedField returns true if f looks like an embedded field, i.e. its
+// name is the same as the unqualified name of its type.
+func isEmbeddedField(f *api.Variable) bool {
+	typ := strings.TrimPrefix(f.Type, "*")
+	if i := strings.Index(typ, "["); i >= 0 {
+		typ = typ[:i]
+	}
+	if i := strings.LastIndex(typ, "."); i >= 0 {
+		typ = typ[i+1:]
+	}
+	return f.Name != "" && f.Name == typ
+}
+
+// typeMethods returns the names of the methods of typ with a value receiver
+// and with a pointer receiver found in fns.
+func typeMethods(fns []string, typ string) (methods, ptrMethods []string) {
+	typ = strings.TrimPrefix(typ, "*")
+	dot := strings.LastIndex(typ, ".")
+	if dot < 0 {
+		return nil, nil
+	}
+	valuePrefix := typ + "."
+	ptrPrefix := typ[:dot] + ".(*" + typ[dot+1:] + ")."
+	for _, fn := range fns {
+		switch {
+		case strings.HasPrefix(fn, valuePrefix) && !strings.Contains(fn[len(valuePrefix):], "."):
+			methods = append(methods, fn[len(valuePrefix):])
+		case strings.HasPrefix(fn, ptrPrefix) && !strings.Contains(fn[len(ptrPrefix):], "."):
+			ptrMethods = append(ptrMethods, fn[len(ptrPrefix):])
+		}
+	}
+	sort.Strings(methods)
+	sort.Strings(ptrMethods)
+	return methods, ptrMethods
+}
+
 func detailsVar(out io.Writer, args string) error {
+	const closePrefix = "-close "
+	switch {
+	case args == "-list":
+		for _, dv := range openDetailViewers() {
+			fmt.Fprintf(out, "%d\t%s\n", dv.id, strings.TrimPrefix(dv.title, "Details "))
+		}
+		return nil
+	case strings.HasPrefix(args, closePrefix):
+		n, err := strconv.Atoi(strings.TrimSpace(args[len(closePrefix):]))
+		if err != nil {
+			return fmt.Errorf("could not parse window number: %v", err)
+		}
+		for _, dv := range openDetailViewers() {
+			if dv.id == n {
+				dv.closeRequested = true
+				wnd.Changed()
+				return nil
+			}
+		}
+		return fmt.Errorf("no details window %d", n)
+	}
 	newDetailViewer(wnd, args)
 	return nil
 }
@@ -885,21 +1956,200 @@ func listCommand(out io.Writer, args string) error {
 	return nil
 }
 
+const listPageSize = 50
+
+func funcsCommand(out io.Writer, args string) error {
+	return printMatchingNames(out, "funcs", args, client.ListFunctions, nil)
+}
+
+func typesCommand(out io.Writer, args string) error {
+	return printMatchingNames(out, "types", args, client.ListTypes, nil)
+}
+
+func sourcesCommand(out io.Writer, args string) error {
+	return printMatchingNames(out, "sources", args, client.ListSources, func(s string) string {
+		return s + ":1"
+	})
+}
+
+// printMatchingNames prints one page of the names returned by list, args
+// has the form '[-page <n>] [<regex>]'. If format isn't nil it is used to
+// convert each name before printing it.
+func printMatchingNames(out io.Writer, cmdname, args string, list func(string) ([]string, error), format func(string) string) error {
+	page := 1
+	argv := strings.SplitN(strings.TrimSpace(args), " ", 3)
+	if argv[0] == "-page" {
+		if len(argv) < 2 {
+			return fmt.Errorf("not enough arguments")
+		}
+		var err error
+		page, err = strconv.Atoi(argv[1])
+		if err != nil || page < 1 {
+			return fmt.Errorf("invalid page number %q", argv[1])
+		}
+		argv = argv[2:]
+	}
+	filter := strings.TrimSpace(strings.Join(argv, " "))
+
+	names, err := list(filter)
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		fmt.Fprintf(out, "No matches\n")
+		return nil
+	}
+
+	npages := (len(names) + listPageSize - 1) / listPageSize
+	if page > npages {
+		return fmt.Errorf("page %d out of range (%d pages)", page, npages)
+	}
+	start := (page - 1) * listPageSize
+	end := start + listPageSize
+	if end > len(names) {
+		end = len(names)
+	}
+	for _, name := range names[start:end] {
+		if format != nil {
+			name = format(name)
+		}
+		fmt.Fprintln(out, name)
+	}
+	if page < npages {
+		fmt.Fprintf(out, "Page %d of %d (%d matches), type '%s -page %d %s' for more\n", page, npages, len(names), cmdname, page+1, filter)
+	}
+	return nil
+}
+
 func setVar(out io.Writer, args string) error {
-	// HACK: in go '=' is not an operator, we detect the error and try to recover from it by splitting the input string
-	_, err := parser.ParseExpr(args)
+	lexpr, rexpr, err := splitAssignment(args)
+	if err != nil {
+		return err
+	}
+	return setVarExpr(currentEvalScope(), lexpr, rexpr)
+}
+
+// splitAssignment splits an assignment statement into its left hand side
+// and right hand side, by looking for the first '=' token that isn't
+// nested inside parenthesis, brackets or braces.
+func splitAssignment(args string) (lexpr, rexpr string, err error) {
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(args))
+	var scanErr error
+	s.Init(file, []byte(args), func(pos token.Position, msg string) {
+		if scanErr == nil {
+			scanErr = fmt.Errorf("syntax error: %s", msg)
+		}
+	}, 0)
+
+	depth := 0
+	for {
+		pos, tok, _ := s.Scan()
+		if scanErr != nil {
+			return "", "", scanErr
+		}
+		switch tok {
+		case token.EOF:
+			return "", "", fmt.Errorf("syntax error '=' not found")
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		case token.ASSIGN:
+			if depth == 0 {
+				off := file.Offset(pos)
+				lexpr = strings.TrimSpace(args[:off])
+				rexpr = strings.TrimSpace(args[off+1:])
+				if lexpr == "" || rexpr == "" {
+					return "", "", fmt.Errorf("syntax error, expected <variable> = <value>")
+				}
+				if _, err := parser.ParseExpr(lexpr); err != nil {
+					return "", "", fmt.Errorf("syntax error in %q: %v", lexpr, err)
+				}
+				if _, err := parser.ParseExpr(rexpr); err != nil {
+					return "", "", fmt.Errorf("syntax error in %q: %v", rexpr, err)
+				}
+				return lexpr, rexpr, nil
+			}
+		}
+	}
+}
+
+// setVarExpr assigns rexpr to lexpr. Assignments that delve can not
+// perform directly (strings, structs and arrays) are converted into a
+// sequence of assignments that it can perform.
+func setVarExpr(scope api.EvalScope, lexpr, rexpr string) error {
+	err := client.SetVariable(scope, lexpr, rexpr)
 	if err == nil {
-		return fmt.Errorf("syntax error '=' not found")
+		return nil
 	}
 
-	el, ok := err.(scanner.ErrorList)
-	if !ok || el[0].Msg != "expected '==', found '='" {
+	cfg := api.LoadConfig{FollowPointers: false, MaxVariableRecurse: 1, MaxStringLen: 0, MaxArrayValues: 0, MaxStructFields: -1}
+	lv, lerr := client.EvalVariable(scope, lexpr, cfg)
+	if lerr != nil {
 		return err
 	}
 
-	lexpr := args[:el[0].Pos.Offset]
-	rexpr := args[el[0].Pos.Offset+1:]
-	return client.SetVariable(currentEvalScope(), lexpr, rexpr)
+	switch lv.Kind {
+	case reflect.String:
+		return setStringVar(scope, lexpr, lv, rexpr)
+	case reflect.Struct, reflect.Array:
+		rv, rerr := client.EvalVariable(scope, rexpr, cfg)
+		if rerr != nil {
+			return fmt.Errorf("could not evaluate %s: %v", rexpr, rerr)
+		}
+		if rv.Type != lv.Type {
+			return fmt.Errorf("can not assign %s to %s: mismatched types %s and %s", rexpr, lexpr, rv.Type, lv.Type)
+		}
+		if lv.Kind == reflect.Struct {
+			for _, field := range lv.Children {
+				if err := setVarExpr(scope, fmt.Sprintf("(%s).%s", lexpr, field.Name), fmt.Sprintf("(%s).%s", rexpr, field.Name)); err != nil {
+					return err
+				}
+			}
+		} else {
+			for i := int64(0); i < lv.Len; i++ {
+				if err := setVarExpr(scope, fmt.Sprintf("(%s)[%d]", lexpr, i), fmt.Sprintf("(%s)[%d]", rexpr, i)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case reflect.Slice, reflect.Map, reflect.Chan, reflect.Func, reflect.Interface:
+		return fmt.Errorf("can not assign to %s, variables of kind %s can not be changed: %v", lexpr, lv.Kind, err)
+	default:
+		return err
+	}
+}
+
+// setStringVar assigns rexpr to the string variable lexpr by changing its
+// string header to point to the contents of rexpr. Since memory can not be
+// allocated in the target process rexpr must be a string that already
+// exists in the target's memory.
+func setStringVar(scope api.EvalScope, lexpr string, lv *api.Variable, rexpr string) error {
+	rv, err := client.EvalVariable(scope, rexpr, api.LoadConfig{MaxStringLen: 0})
+	if err != nil {
+		return fmt.Errorf("could not evaluate %s: %v", rexpr, err)
+	}
+	if rv.Kind != reflect.String {
+		return fmt.Errorf("can not assign %s to %s: mismatched types %s and %s", rexpr, lexpr, rv.Type, lv.Type)
+	}
+	if lv.Addr == 0 {
+		return fmt.Errorf("can not assign to %s: variable is not addressable", lexpr)
+	}
+	if rv.Base == 0 && rv.Len != 0 {
+		return fmt.Errorf("can not assign %s to %s: new memory can not be allocated in the target process, the value must be a string already in memory (for example another string variable)", rexpr, lexpr)
+	}
+
+	// string header: data pointer followed by length, both are word sized
+	// so the header is written as an array of two words, letting the target
+	// determine the word size.
+	if err := client.SetVariable(scope, fmt.Sprintf("(*(*[2]uintptr)(%#x))[0]", lv.Addr), fmt.Sprintf("%#x", rv.Base)); err != nil {
+		return err
+	}
+	return client.SetVariable(scope, fmt.Sprintf("(*(*[2]int)(%#x))[1]", lv.Addr), fmt.Sprintf("%d", rv.Len))
 }
 
 // ExitRequestError is returned when the user
@@ -914,6 +2164,43 @@ func exitCommand(out io.Writer, args string) error {
 	return ExitRequestError{}
 }
 
+func dump(out io.Writer, args string) error {
+	if client == nil {
+		return errors.New("not connected")
+	}
+	if args == "" {
+		return errors.New("not enough arguments")
+	}
+	state, err := client.GetState()
+	if err != nil {
+		return err
+	}
+	if state.Exited {
+		return errors.New("process has exited")
+	}
+
+	ds, err := client.CoreDumpStart(args)
+	if err != nil {
+		return err
+	}
+	for ds.Dumping {
+		if ds.MemTotal > 0 {
+			fmt.Fprintf(out, "Dumping memory %d / %d bytes\n", ds.MemDone, ds.MemTotal)
+		} else if ds.ThreadsTotal > 0 {
+			fmt.Fprintf(out, "Dumping threads %d / %d\n", ds.ThreadsDone, ds.ThreadsTotal)
+		}
+		ds = client.CoreDumpWait(1000)
+	}
+	if ds.Err != "" {
+		return errors.New(ds.Err)
+	}
+	if !ds.AllDone {
+		return errors.New("core dump could not be completed")
+	}
+	fmt.Fprintf(out, "Core dump written to %s\n", args)
+	return nil
+}
+
 func checkpoint(out io.Writer, args string) error {
 	if args == "" {
 		state, err := client.GetState()
@@ -937,6 +2224,9 @@ func checkpoint(out io.Writer, args string) error {
 	return nil
 }
 
+// currentLayout is the name of the last layout loaded.
+var currentLayout = "default"
+
 func layoutCommand(out io.Writer, args string) error {
 	argv := strings.SplitN(args, " ", 3)
 	if len(argv) < 0 {
@@ -964,22 +2254,123 @@ func layoutCommand(out io.Writer, args string) error {
 
 		conf.Layouts[name] = LayoutDescr{Description: description, Layout: serializeLayout()}
 		saveConfiguration()
+	case "export":
+		if len(argv) < 3 {
+			return fmt.Errorf("not enough arguments")
+		}
+		return exportLayout(argv[1], argv[2])
+	case "import":
+		if len(argv) < 2 {
+			return fmt.Errorf("not enough arguments")
+		}
+		name, err := importLayout(strings.TrimSpace(args[len("import"):]))
+		if err != nil {
+			return err
+		}
+		saveConfiguration()
+		fmt.Fprintf(out, "Imported layout %q\n", name)
+	case "delete":
+		return deleteLayout(out, strings.TrimSpace(args[len("delete"):]))
 	default:
 		ld, ok := conf.Layouts[argv[0]]
 		if !ok {
 			return fmt.Errorf("unknown layout %q", argv[0])
 		}
 		loadPanelDescrToplevel(ld.Layout)
+		currentLayout = argv[0]
 		wnd.Changed()
 	}
 	return nil
 }
 
+func deleteLayout(out io.Writer, args string) error {
+	force := false
+	if args == "-f" || strings.HasPrefix(args, "-f ") {
+		force = true
+		args = strings.TrimSpace(args[2:])
+	}
+	name := args
+	if name == "" {
+		return fmt.Errorf("not enough arguments")
+	}
+	if _, ok := conf.Layouts[name]; !ok {
+		return fmt.Errorf("unknown layout %q", name)
+	}
+	if !force && (name == "default" || name == currentLayout) {
+		return fmt.Errorf("layout %q is in use, use 'layout delete -f %s' to delete it anyway", name, name)
+	}
+	delete(conf.Layouts, name)
+	saveConfiguration()
+	fmt.Fprintf(out, "Deleted layout %q\n", name)
+	return nil
+}
+
 func configCommand(out io.Writer, args string) error {
 	const aliasPrefix = "alias "
 	if strings.HasPrefix(args, aliasPrefix) {
 		return configureSetAlias(strings.TrimSpace(args[len(aliasPrefix):]))
 	}
+	const substImportPrefix = "subst-import "
+	if strings.HasPrefix(args, substImportPrefix) {
+		n, err := importSubstitutePath(strings.TrimSpace(args[len(substImportPrefix):]))
+		if err != nil {
+			return err
+		}
+		saveConfiguration()
+		fmt.Fprintf(out, "Imported %d substitution rules\n", n)
+		return nil
+	}
+	const substExportPrefix = "subst-export "
+	if strings.HasPrefix(args, substExportPrefix) {
+		return exportSubstitutePath(strings.TrimSpace(args[len(substExportPrefix):]))
+	}
+	const workdirPrefix = "workdir"
+	if args == workdirPrefix || strings.HasPrefix(args, workdirPrefix+" ") {
+		return configureWorkdir(out, strings.TrimSpace(args[len(workdirPrefix):]))
+	}
+	const savePrefix = "save "
+	if strings.HasPrefix(args, savePrefix) {
+		name := strings.TrimSpace(args[len(savePrefix):])
+		if err := saveProfile(name); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Configuration saved to %s\n", profileLoc(name))
+		return nil
+	}
+	const loadPrefix = "load "
+	if strings.HasPrefix(args, loadPrefix) {
+		name := strings.TrimSpace(args[len(loadPrefix):])
+		if err := loadProfile(name); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Configuration loaded from %s\n", profileLoc(name))
+		return nil
+	}
+	const disassFlavorPrefix = "disass-flavor "
+	if strings.HasPrefix(args, disassFlavorPrefix) {
+		switch strings.ToLower(strings.TrimSpace(args[len(disassFlavorPrefix):])) {
+		case "intel":
+			conf.DisassemblyFlavour = 0
+		case "gnu", "att":
+			conf.DisassemblyFlavour = 1
+		default:
+			return errors.New("unknown disassembly flavor, use intel or gnu")
+		}
+		saveConfiguration()
+		disassemblyPanel.asyncLoad.clear()
+		wnd.Changed()
+		return nil
+	}
+	if args == "profiles" {
+		names, err := listProfiles()
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			fmt.Fprintln(out, name)
+		}
+		return nil
+	}
 	cw := newConfigWindow()
 	wnd.PopupOpen("Configuration", dynamicPopupFlags, rect.Rect{100, 100, 600, 700}, true, cw.Update)
 	return nil
@@ -1014,10 +2405,51 @@ func configureSetAlias(rest string) error {
 	return fmt.Errorf("wrong number of arguments")
 }
 
+func configureWorkdir(out io.Writer, path string) error {
+	if path == "" {
+		if BackendServer.workdir == "" {
+			wd, _ := os.Getwd()
+			fmt.Fprintf(out, "Working directory: %s (inherited from gdlv)\n", wd)
+		} else {
+			fmt.Fprintf(out, "Working directory: %s\n", BackendServer.workdir)
+		}
+		if BackendServer.workdir != BackendServer.launchWorkdir {
+			fmt.Fprintf(out, "The new working directory will be used after the next restart\n")
+		}
+		return nil
+	}
+	if !BackendServer.CanSetWorkdir() {
+		return fmt.Errorf("can not change the working directory of a target that was not started by gdlv")
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", path)
+	}
+	BackendServer.workdir = path
+	fmt.Fprintf(out, "Working directory set to %s, restart to apply\n", path)
+	return nil
+}
+
 type configWindow struct {
 	selectedSubstitutionRule int
 	from                     nucular.TextEditor
 	to                       nucular.TextEditor
+	regexp                   bool
+	ruleErr                  error
+
+	skipPackages nucular.TextEditor
+
+	selectedTypeLimit string
+	limitType         nucular.TextEditor
+	limitArray        int
+	limitString       int
 }
 
 func newConfigWindow() *configWindow {
@@ -1025,6 +2457,10 @@ func newConfigWindow() *configWindow {
 		selectedSubstitutionRule: -1,
 		from:                     nucular.TextEditor{Flags: nucular.EditSelectable | nucular.EditClipboard},
 		to:                       nucular.TextEditor{Flags: nucular.EditSelectable | nucular.EditClipboard},
+		skipPackages:             nucular.TextEditor{Flags: nucular.EditSelectable | nucular.EditClipboard, Buffer: []rune(strings.Join(conf.StepSkipPackages, " "))},
+		limitType:                nucular.TextEditor{Flags: nucular.EditSelectable | nucular.EditClipboard},
+		limitArray:               LongLoadConfig.MaxArrayValues,
+		limitString:              LongLoadConfig.MaxStringLen,
 	}
 }
 
@@ -1061,14 +2497,18 @@ func (cw *configWindow) Update(w *nucular.Window) {
 	breakbLbl := breakb[0]
 	if conf.StopOnNextBreakpoint {
 		breakbLbl = breakb[1]
+	} else if sessionContinueAction.set {
+		breakbLbl = "Use remembered choice"
 	}
 	if w := w.Combo(label.TA(breakbLbl, "LC"), 100, nil); w != nil {
 		w.Row(20).Dynamic(1)
 		if w.MenuItem(label.TA(breakb[0], "LC")) {
 			conf.StopOnNextBreakpoint = false
+			sessionContinueAction.set = false
 		}
 		if w.MenuItem(label.TA(breakb[1], "LC")) {
 			conf.StopOnNextBreakpoint = true
+			sessionContinueAction.set = false
 		}
 	}
 
@@ -1093,6 +2533,50 @@ func (cw *configWindow) Update(w *nucular.Window) {
 	w.Row(30).Static(200, 200)
 	w.Spacing(1)
 	w.PropertyInt("Max string load:", 1, &conf.MaxStringLen, 4096, 1, 1)
+	w.Row(30).Static(200, 200)
+	w.Spacing(1)
+	w.PropertyInt("Max auto load depth:", 1, &conf.MaxVariableDepth, 100, 1, 1)
+
+	w.Row(30).Static(0)
+	if w.TreePush(nucular.TreeTab, "Load configuration by type:", false) {
+		cw.typeLoadLimits(w)
+		w.TreePop()
+	}
+
+	w.Row(30).Static(0)
+	w.CheckboxText("Show constant names for integer values (slower)", &conf.ShowEnumNames)
+	w.Row(30).Static(0)
+	w.CheckboxText("Show full file paths", &conf.FullFilePaths)
+	w.Row(30).Static(0)
+	w.CheckboxText("Prefix scrollback lines with a timestamp", &conf.TimestampOutput)
+	w.Row(30).Static(0)
+	w.CheckboxText("Disable ANSI colors in scrollback", &conf.DisableANSIColors)
+	w.Row(30).Static(0)
+	w.CheckboxText("Show variable values in the listing (slower)", &conf.InlineValues)
+	w.Row(30).Static(0)
+	w.CheckboxText("Switch to disassembly when stopping in optimized functions", &conf.DisassembleOptimized)
+	w.Row(30).Static(0)
+	w.CheckboxText("Only complete names that start with the typed text", &conf.StrictCompletion)
+	w.Row(30).Static(0)
+	w.CheckboxText("Do not cancel next/step/stepout on restart, only warn", &conf.KeepNextOnRestart)
+
+	if conf.MaxHistoryLength == 0 {
+		conf.MaxHistoryLength = defaultMaxHistoryLength
+	}
+	w.Row(30).Static(200, 200)
+	w.Label("Command history:", "LC")
+	w.PropertyInt("Max saved:", 1, &conf.MaxHistoryLength, 100000, 100, 100)
+	w.Row(30).Static(0)
+	w.CheckboxText("Do not save commands starting with a space", &conf.HistoryIgnoreSpace)
+
+	w.Row(30).Static(200, 0)
+	w.Label("Step out of packages:", "LC")
+	if cw.skipPackages.Edit(w)&nucular.EditActive != 0 {
+		conf.StepSkipPackages = strings.Fields(string(cw.skipPackages.Buffer))
+	}
+	w.Row(30).Static(200, 200)
+	w.Spacing(1)
+	w.PropertyInt("Max step outs:", 1, &conf.StepSkipDepth, 100, 1, 1)
 
 	w.Row(30).Static(0)
 	if w.TreePush(nucular.TreeTab, "Path substitutions:", false) {
@@ -1104,7 +2588,11 @@ func (cw *configWindow) Update(w *nucular.Window) {
 			}
 			for i, r := range conf.SubstitutePath {
 				s := cw.selectedSubstitutionRule == i
-				w.SelectableLabel(fmt.Sprintf("%s -> %s", r.From, r.To), "LC", &s)
+				rx := ""
+				if r.Regexp {
+					rx = " (regexp)"
+				}
+				w.SelectableLabel(fmt.Sprintf("%s -> %s%s", r.From, r.To, rx), "LC", &s)
 				if s {
 					cw.selectedSubstitutionRule = i
 				}
@@ -1128,9 +2616,22 @@ func (cw *configWindow) Update(w *nucular.Window) {
 		w.Label("To:", "LC")
 		cw.to.Edit(w)
 		if w.ButtonText("Add") {
-			conf.SubstitutePath = append(conf.SubstitutePath, SubstitutePathRule{From: string(cw.from.Buffer), To: string(cw.to.Buffer)})
-			cw.from.Buffer = cw.from.Buffer[:0]
-			cw.to.Buffer = cw.to.Buffer[:0]
+			rule := SubstitutePathRule{From: string(cw.from.Buffer), To: string(cw.to.Buffer), Regexp: cw.regexp}
+			cw.ruleErr = nil
+			if rule.Regexp {
+				_, cw.ruleErr = rule.compile()
+			}
+			if cw.ruleErr == nil {
+				conf.SubstitutePath = append(conf.SubstitutePath, rule)
+				cw.from.Buffer = cw.from.Buffer[:0]
+				cw.to.Buffer = cw.to.Buffer[:0]
+			}
+		}
+		w.Row(30).Static(0)
+		w.CheckboxText("Regular expression (use $1, $2... in To to reference submatches)", &cw.regexp)
+		if cw.ruleErr != nil {
+			w.Row(30).Static(0)
+			w.Label(fmt.Sprintf("Invalid regular expression: %v", cw.ruleErr), "LC")
 		}
 
 		w.TreePop()
@@ -1144,6 +2645,51 @@ func (cw *configWindow) Update(w *nucular.Window) {
 	}
 }
 
+func (cw *configWindow) typeLoadLimits(w *nucular.Window) {
+	w.Row(160).Static(0, 100)
+	if w := w.GroupBegin("type-load-limits-list", nucular.WindowNoHScrollbar); w != nil {
+		w.Row(30).Static(0)
+		if len(conf.TypeLoadLimits) == 0 {
+			w.Label("(no types)", "LC")
+		}
+		typs := make([]string, 0, len(conf.TypeLoadLimits))
+		for typ := range conf.TypeLoadLimits {
+			typs = append(typs, typ)
+		}
+		sort.Strings(typs)
+		for _, typ := range typs {
+			l := conf.TypeLoadLimits[typ]
+			s := cw.selectedTypeLimit == typ
+			w.SelectableLabel(fmt.Sprintf("%s: array %d, string %d", typ, l.MaxArrayValues, l.MaxStringLen), "LC", &s)
+			if s {
+				cw.selectedTypeLimit = typ
+			}
+		}
+		w.GroupEnd()
+	}
+	if w := w.GroupBegin("type-load-limits-controls", nucular.WindowNoScrollbar); w != nil {
+		w.Row(30).Static(0)
+		if w.ButtonText("Remove") {
+			delete(conf.TypeLoadLimits, cw.selectedTypeLimit)
+			cw.selectedTypeLimit = ""
+		}
+		w.GroupEnd()
+	}
+	w.Row(30).Static(50, 0)
+	w.Label("Type:", "LC")
+	cw.limitType.Edit(w)
+	w.Row(30).Static(200, 200, 80)
+	w.PropertyInt("Max array load:", 1, &cw.limitArray, 65536, 1, 1)
+	w.PropertyInt("Max string load:", 1, &cw.limitString, 65536, 1, 1)
+	if w.ButtonText("Add") && len(cw.limitType.Buffer) > 0 {
+		if conf.TypeLoadLimits == nil {
+			conf.TypeLoadLimits = make(map[string]TypeLoadLimits)
+		}
+		conf.TypeLoadLimits[string(cw.limitType.Buffer)] = TypeLoadLimits{MaxArrayValues: cw.limitArray, MaxStringLen: cw.limitString}
+		cw.limitType.Buffer = cw.limitType.Buffer[:0]
+	}
+}
+
 func stringCombo(w *nucular.Window, values []string, value *string) {
 	i0 := 0
 	for i := range values {
@@ -1160,10 +2706,15 @@ func stringCombo(w *nucular.Window, values []string, value *string) {
 }
 
 func scrollCommand(out io.Writer, args string) error {
+	const savePrefix = "save "
+	if strings.HasPrefix(args, savePrefix) {
+		return saveScrollback(out, strings.TrimSpace(args[len(savePrefix):]))
+	}
 	switch args {
 	case "clear":
 		wnd.Lock()
 		scrollbackEditor.Buffer = scrollbackEditor.Buffer[:0]
+		scrollbackANSI.reset()
 		scrollbackEditor.Cursor = 0
 		scrollbackEditor.CursorFollow = true
 		wnd.Unlock()
@@ -1190,6 +2741,41 @@ func scrollCommand(out io.Writer, args string) error {
 	return nil
 }
 
+// saveScrollback writes the contents of the scrollback to a file, args has
+// the form '[-append] <file>'.
+func saveScrollback(out io.Writer, args string) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	const appendFlag = "-append "
+	if strings.HasPrefix(args, appendFlag) {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		args = strings.TrimSpace(args[len(appendFlag):])
+	}
+	if args == "" {
+		return fmt.Errorf("not enough arguments")
+	}
+
+	wnd.Lock()
+	text := string(scrollbackEditor.Buffer)
+	wnd.Unlock()
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+
+	fh, err := os.OpenFile(args, flags, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err := fh.WriteString(text); err != nil {
+		fh.Close()
+		return err
+	}
+	if err := fh.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Scrollback written to %s\n", args)
+	return nil
+}
+
 func windowCommand(out io.Writer, args string) error {
 	args = strings.ToLower(strings.TrimSpace(args))
 	if args == "styled" {
@@ -1274,7 +2860,16 @@ func sourceCommand(out io.Writer, args string) error {
 		return nil
 	}
 
-	v, err := StarlarkEnv.Execute(out, expandTilde(args), nil, "main", nil, nil)
+	argv := splitQuotedFields(args, '\'')
+	if len(argv) == 0 {
+		return fmt.Errorf("wrong number of arguments: source <filename>")
+	}
+	mainArgs := make([]interface{}, len(argv)-1)
+	for i := range mainArgs {
+		mainArgs[i] = argv[i+1]
+	}
+
+	v, err := StarlarkEnv.Execute(out, expandTilde(argv[0]), nil, "main", mainArgs, nil)
 	if err != nil {
 		return err
 	}
@@ -1347,102 +2942,404 @@ func printReturnValues(out io.Writer, th *api.Thread) {
 	fmt.Fprintln(out)
 }
 
+// optimizedHintShown is set after the hint about the disassembly window
+// has been printed once.
+var optimizedHintShown bool
+
+// optimizedFunctionStop is called when the target stops in an optimized
+// function, where stepping by line is unreliable.
+func optimizedFunctionStop(out io.Writer) {
+	fmt.Fprintln(out, optimizedFunctionWarning)
+	if conf.DisassembleOptimized {
+		openWindow(infoDisassembly)
+		return
+	}
+	if !optimizedHintShown {
+		optimizedHintShown = true
+		fmt.Fprintln(out, "Use 'window disassembly' to step by instruction, or enable switching to the disassembly automatically in the configuration window")
+	}
+}
+
 func printcontextThread(out io.Writer, th *api.Thread) {
 	fn := th.Function
 
 	if th.Breakpoint == nil {
 		fmt.Fprintf(out, "> %s() %s:%d (PC: %#v)\n", fn.Name(), ShortenFilePath(th.File), th.Line, th.PC)
 		if th.Function != nil && th.Function.Optimized {
-			fmt.Fprintln(out, optimizedFunctionWarning)
+			optimizedFunctionStop(out)
+		}
+		printReturnValues(out, th)
+		return
+	}
+
+	if changepointUnchanged(th) {
+		return
+	}
+
+	args := ""
+	if th.BreakpointInfo != nil && th.Breakpoint.LoadArgs != nil && *th.Breakpoint.LoadArgs == ShortLoadConfig {
+		var arg []string
+		for _, ar := range th.BreakpointInfo.Arguments {
+			arg = append(arg, wrapApiVariableSimple(&ar).SinglelineString(true, true))
+		}
+		args = strings.Join(arg, ", ")
+	}
+
+	bpname := ""
+	if th.Breakpoint.Name != "" {
+		bpname = fmt.Sprintf("[%s] ", th.Breakpoint.Name)
+	}
+
+	if hitCount, ok := th.Breakpoint.HitCount[strconv.Itoa(th.GoroutineID)]; ok {
+		fmt.Fprintf(out, "> %s%s(%s) %s:%d (hits goroutine(%d):%d total:%d) (PC: %#v)\n",
+			bpname,
+			fn.Name(),
+			args,
+			ShortenFilePath(th.File),
+			th.Line,
+			th.GoroutineID,
+			hitCount,
+			th.Breakpoint.TotalHitCount,
+			th.PC)
+	} else {
+		fmt.Fprintf(out, "> %s%s(%s) %s:%d (hits total:%d) (PC: %#v)\n",
+			bpname,
+			fn.Name(),
+			args,
+			ShortenFilePath(th.File),
+			th.Line,
+			th.Breakpoint.TotalHitCount,
+			th.PC)
+	}
+	if th.Function != nil && th.Function.Optimized {
+		optimizedFunctionStop(out)
+	}
+
+	printReturnValues(out, th)
+
+	if th.BreakpointInfo != nil {
+		bp := th.Breakpoint
+		bpi := th.BreakpointInfo
+
+		if bpi.Goroutine != nil {
+			writeGoroutineLong(os.Stdout, bpi.Goroutine, "\t")
+		}
+
+		if logfmt, ok := logpoints[bp.ID]; ok {
+			vals := make([]string, len(bpi.Variables))
+			for i := range bpi.Variables {
+				vals[i] = wrapApiVariableSimple(&bpi.Variables[i]).SinglelineString(false, false)
+			}
+			fmt.Fprintf(out, "    %s\n", formatLogMessage(logfmt, vals))
+		} else {
+			for _, v := range bpi.Variables {
+				fmt.Fprintf(out, "    %s: %s\n", v.Name, wrapApiVariableSimple(&v).MultilineString("\t"))
+			}
+		}
+
+		for _, v := range bpi.Locals {
+			if *bp.LoadLocals == LongLoadConfig {
+				fmt.Fprintf(out, "    %s: %s\n", v.Name, wrapApiVariableSimple(&v).MultilineString("\t"))
+			} else {
+				fmt.Fprintf(out, "    %s: %s\n", v.Name, wrapApiVariableSimple(&v).SinglelineString(true, true))
+			}
+		}
+
+		if bp.LoadArgs != nil && *bp.LoadArgs == LongLoadConfig {
+			for _, v := range bpi.Arguments {
+				fmt.Fprintf(out, "    %s: %s\n", v.Name, wrapApiVariableSimple(&v).MultilineString("\t"))
+			}
+		}
+
+		if bpi.Stacktrace != nil {
+			fmt.Fprintf(out, "    Stack:\n")
+			printStack(out, bpi.Stacktrace, "        ")
+		}
+	}
+}
+
+func formatLocation(loc api.Location) string {
+	return fmt.Sprintf("%s at %s:%d (%#v)", loc.Function.Name(), ShortenFilePath(loc.File), loc.Line, loc.PC)
+}
+
+var cgoFunctions = []string{"runtime.cgocall", "runtime.asmcgocall", "runtime.asmcgocall_no_g"}
+
+var syscallFunctionPrefixes = []string{"syscall.Syscall", "syscall.RawSyscall", "syscall.syscall", "syscall.rawSyscall", "runtime/internal/syscall.Syscall", "golang.org/x/sys/unix.Syscall", "golang.org/x/sys/unix.RawSyscall", "runtime.entersyscall", "runtime.exitsyscall"}
+
+var syscallPackagePrefixes = []string{"syscall.", "internal/syscall/", "golang.org/x/sys/unix."}
+
+const syscallsStackDepth = 20
+
+func syscallsCommand(out io.Writer, args string) error {
+	gs, err := client.ListGoroutines(0, 0)
+	if err != nil {
+		return err
+	}
+	sort.Sort(goroutinesByID(gs))
+
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 8, 0, ' ', 0)
+	n := 0
+	for _, g := range gs {
+		fnname := g.CurrentLoc.Function.Name()
+		kind := ""
+		for _, cgofn := range cgoFunctions {
+			if fnname == cgofn {
+				kind = "cgo"
+				break
+			}
+		}
+		if kind == "" {
+			for _, prefix := range syscallFunctionPrefixes {
+				if strings.HasPrefix(fnname, prefix) {
+					kind = "syscall"
+					break
+				}
+			}
+		}
+		if kind == "" {
+			continue
+		}
+		n++
+
+		name := "?"
+		if frames, err := client.Stacktrace(g.ID, syscallsStackDepth, false, nil); err == nil {
+			name = syscallName(kind, frames)
+		}
+		fmt.Fprintf(w, "Goroutine %d \t %s \t %s \t %s\n", g.ID, kind, name, formatLocation(g.UserCurrentLoc))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%d goroutines in system calls or cgo calls\n", n)
+	return nil
+}
+
+// syscallName returns the name of the system call or C function being
+// called by the goroutine with the stacktrace frames.
+func syscallName(kind string, frames []api.Stackframe) string {
+	switch kind {
+	case "cgo":
+		const cfuncPrefix = "_Cfunc_"
+		for _, frame := range frames {
+			fnname := frame.Function.Name()
+			if i := strings.Index(fnname, cfuncPrefix); i >= 0 {
+				return fnname[i+len(cfuncPrefix):]
+			}
+		}
+	case "syscall":
+		// the outermost function of the syscall package is the one called by
+		// user code.
+		name := ""
+		for _, frame := range frames {
+			fnname := frame.Function.Name()
+			insyscall := false
+			for _, prefix := range syscallPackagePrefixes {
+				if strings.HasPrefix(fnname, prefix) {
+					insyscall = true
+					break
+				}
+			}
+			if insyscall {
+				name = fnname
+			} else if name != "" {
+				break
+			}
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return "?"
+}
+
+func writeGoroutineLong(w io.Writer, g *api.Goroutine, prefix string) {
+	fmt.Fprintf(w, "%sGoroutine %d:\n%s\tRuntime: %s\n%s\tUser: %s\n%s\tGo: %s\n",
+		prefix, g.ID,
+		prefix, formatLocation(g.CurrentLoc),
+		prefix, formatLocation(g.UserCurrentLoc),
+		prefix, formatLocation(g.GoStatementLoc))
+	if len(g.Labels) > 0 {
+		fmt.Fprintf(w, "%s\tLabels: %s\n", prefix, formatGoroutineLabels(g.Labels))
+	}
+}
+
+func goroutinesCommand(out io.Writer, args string) error {
+	const labelPrefix = "-label "
+	filter := ""
+	args = strings.TrimSpace(args)
+	switch {
+	case args == "":
+	case strings.HasPrefix(args, labelPrefix):
+		filter = strings.TrimSpace(args[len(labelPrefix):])
+	default:
+		return fmt.Errorf("wrong argument %q", args)
+	}
+	gs, err := client.ListGoroutines(0, 0)
+	if err != nil {
+		return err
+	}
+	sort.Sort(goroutinesByID(gs))
+	n := 0
+	for _, g := range gs {
+		if !goroutineHasLabel(g, filter) {
+			continue
+		}
+		cur := " "
+		if g.ID == curGid {
+			cur = "*"
+		}
+		fmt.Fprintf(out, "%s Goroutine %d - User: %s", cur, g.ID, formatLocation(g.UserCurrentLoc))
+		if len(g.Labels) > 0 {
+			fmt.Fprintf(out, " [%s]", formatGoroutineLabels(g.Labels))
 		}
-		printReturnValues(out, th)
-		return
+		fmt.Fprintln(out)
+		n++
 	}
+	fmt.Fprintf(out, "%d goroutines\n", n)
+	return nil
+}
 
-	args := ""
-	if th.BreakpointInfo != nil && th.Breakpoint.LoadArgs != nil && *th.Breakpoint.LoadArgs == ShortLoadConfig {
-		var arg []string
-		for _, ar := range th.BreakpointInfo.Arguments {
-			arg = append(arg, wrapApiVariableSimple(&ar).SinglelineString(true, true))
+func stackCommand(out io.Writer, args string) error {
+	depth := stackPanel.depth
+	var cfg *api.LoadConfig
+	for _, arg := range strings.Fields(args) {
+		if arg == "-full" {
+			cfg = &ShortLoadConfig
+			continue
 		}
-		args = strings.Join(arg, ", ")
+		n, err := strconv.Atoi(arg)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("wrong argument %q, expected -full or a depth", arg)
+		}
+		depth = n
 	}
-
-	bpname := ""
-	if th.Breakpoint.Name != "" {
-		bpname = fmt.Sprintf("[%s] ", th.Breakpoint.Name)
+	stack, err := client.Stacktrace(curGid, depth, false, cfg)
+	if err != nil {
+		return err
 	}
+	printStack(out, stack, "")
+	return nil
+}
 
-	if hitCount, ok := th.Breakpoint.HitCount[strconv.Itoa(th.GoroutineID)]; ok {
-		fmt.Fprintf(out, "> %s%s(%s) %s:%d (hits goroutine(%d):%d total:%d) (PC: %#v)\n",
-			bpname,
-			fn.Name(),
-			args,
-			ShortenFilePath(th.File),
-			th.Line,
-			th.GoroutineID,
-			hitCount,
-			th.Breakpoint.TotalHitCount,
-			th.PC)
-	} else {
-		fmt.Fprintf(out, "> %s%s(%s) %s:%d (hits total:%d) (PC: %#v)\n",
-			bpname,
-			fn.Name(),
-			args,
-			ShortenFilePath(th.File),
-			th.Line,
-			th.Breakpoint.TotalHitCount,
-			th.PC)
+func regsCommand(out io.Writer, args string) error {
+	all := false
+	switch strings.TrimSpace(args) {
+	case "":
+	case "-a":
+		all = true
+	default:
+		return fmt.Errorf("wrong argument %q", args)
 	}
-	if th.Function != nil && th.Function.Optimized {
-		fmt.Fprintln(out, optimizedFunctionWarning)
+	regs, err := client.ListRegisters(0, all)
+	if err != nil {
+		return err
 	}
+	io.WriteString(out, formatRegisters(regs))
+	return nil
+}
 
-	printReturnValues(out, th)
+func threadCommand(out io.Writer, args string) error {
+	args = strings.TrimSpace(args)
+	if args == "" {
+		if curThread < 0 {
+			return errors.New("no current thread")
+		}
+		th, err := client.GetThread(curThread)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Thread %d at %s\n", th.ID, formatLocation(api.Location{PC: th.PC, File: th.File, Line: th.Line, Function: th.Function}))
+		return nil
+	}
+	tid, err := strconv.Atoi(args)
+	if err != nil {
+		return fmt.Errorf("could not parse thread id: %v", err)
+	}
+	state, err := client.SwitchThread(tid)
+	if err != nil {
+		return err
+	}
+	refreshState(refreshToFrameZero, clearGoroutineSwitch, state)
+	if state.CurrentThread != nil {
+		th := state.CurrentThread
+		fmt.Fprintf(out, "Switched to thread %d at %s\n", th.ID, formatLocation(api.Location{PC: th.PC, File: th.File, Line: th.Line, Function: th.Function}))
+	}
+	return nil
+}
 
-	if th.BreakpointInfo != nil {
-		bp := th.Breakpoint
-		bpi := th.BreakpointInfo
+func disassCommand(out io.Writer, args string) error {
+	flavour := api.IntelFlavour
+	if conf.DisassemblyFlavour == 1 {
+		flavour = api.GNUFlavour
+	}
 
-		if bpi.Goroutine != nil {
-			writeGoroutineLong(os.Stdout, bpi.Goroutine, "\t")
+	argv := strings.SplitN(strings.TrimSpace(args), " ", 2)
+	var text api.AsmInstructions
+	var err error
+	switch argv[0] {
+	case "":
+		if curFrame >= len(stackPanel.stack) {
+			return fmt.Errorf("no current frame")
 		}
-
-		for _, v := range bpi.Variables {
-			fmt.Fprintf(out, "    %s: %s\n", v.Name, wrapApiVariableSimple(&v).MultilineString("\t"))
+		text, err = client.DisassemblePC(currentEvalScope(), stackPanel.stack[curFrame].PC, flavour)
+	case "-a":
+		if len(argv) < 2 {
+			return fmt.Errorf("not enough arguments")
 		}
-
-		for _, v := range bpi.Locals {
-			if *bp.LoadLocals == LongLoadConfig {
-				fmt.Fprintf(out, "    %s: %s\n", v.Name, wrapApiVariableSimple(&v).MultilineString("\t"))
-			} else {
-				fmt.Fprintf(out, "    %s: %s\n", v.Name, wrapApiVariableSimple(&v).SinglelineString(true, true))
-			}
+		rangev := strings.Fields(argv[1])
+		if len(rangev) != 2 {
+			return fmt.Errorf("wrong number of arguments")
 		}
-
-		if bp.LoadArgs != nil && *bp.LoadArgs == LongLoadConfig {
-			for _, v := range bpi.Arguments {
-				fmt.Fprintf(out, "    %s: %s\n", v.Name, wrapApiVariableSimple(&v).MultilineString("\t"))
-			}
+		start, err1 := strconv.ParseUint(rangev[0], 0, 64)
+		end, err2 := strconv.ParseUint(rangev[1], 0, 64)
+		if err1 != nil || err2 != nil {
+			return fmt.Errorf("wrong address range %q", argv[1])
 		}
-
-		if bpi.Stacktrace != nil {
-			fmt.Fprintf(out, "    Stack:\n")
-			printStack(out, bpi.Stacktrace, "        ")
+		text, err = client.DisassembleRange(currentEvalScope(), start, end, flavour)
+	case "-l":
+		if len(argv) < 2 {
+			return fmt.Errorf("not enough arguments")
+		}
+		var locs []api.Location
+		locs, err = client.FindLocation(currentEvalScope(), argv[1])
+		if err != nil {
+			return err
 		}
+		if len(locs) != 1 {
+			return fmt.Errorf("%q is ambiguous", argv[1])
+		}
+		text, err = client.DisassemblePC(currentEvalScope(), locs[0].PC, flavour)
+	default:
+		return fmt.Errorf("wrong argument %q", argv[0])
 	}
+	if err != nil {
+		return err
+	}
+	printDisassembly(out, text)
+	return nil
 }
 
-func formatLocation(loc api.Location) string {
-	return fmt.Sprintf("%s at %s:%d (%#v)", loc.Function.Name(), ShortenFilePath(loc.File), loc.Line, loc.PC)
-}
-
-func writeGoroutineLong(w io.Writer, g *api.Goroutine, prefix string) {
-	fmt.Fprintf(w, "%sGoroutine %d:\n%s\tRuntime: %s\n%s\tUser: %s\n%s\tGo: %s\n",
-		prefix, g.ID,
-		prefix, formatLocation(g.CurrentLoc),
-		prefix, formatLocation(g.UserCurrentLoc),
-		prefix, formatLocation(g.GoStatementLoc))
+func printDisassembly(out io.Writer, text api.AsmInstructions) {
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 8, 1, ' ', 0)
+	var fn *api.Function
+	for _, instr := range text {
+		if instr.Loc.Function != nil && (fn == nil || fn.Name() != instr.Loc.Function.Name()) {
+			fn = instr.Loc.Function
+			fmt.Fprintf(w, "TEXT %s(SB) %s\n", fn.Name(), ShortenFilePath(instr.Loc.File))
+		}
+		atpc := ""
+		if instr.AtPC {
+			atpc = "=>"
+		}
+		bp := ""
+		if instr.Breakpoint {
+			bp = "*"
+		}
+		fmt.Fprintf(w, "%s\t%s:%d\t%#x%s\t%x\t%s\n", atpc, filepath.Base(instr.Loc.File), instr.Loc.Line, instr.Loc.PC, bp, instr.Bytes, instr.Text)
+	}
+	w.Flush()
 }
 
 func printStack(out io.Writer, stack []api.Stackframe, ind string) {
@@ -1466,11 +3363,91 @@ func printStack(out io.Writer, stack []api.Stackframe, ind string) {
 	}
 }
 
-// ShortenFilePath take a full file path and attempts to shorten
-// it by replacing the current directory to './'.
+// ShortenFilePath take a full file path, applies path substitution rules
+// and attempts to shorten it by replacing the current directory to './',
+// GOROOT and GOPATH with $GOROOT and $GOPATH and removing the module cache
+// directory from the paths of modules.
 func ShortenFilePath(fullPath string) string {
+	fullPath = conf.substitutePath(fullPath)
+	if conf.FullFilePaths {
+		return fullPath
+	}
 	workingDir, _ := os.Getwd()
-	return strings.Replace(fullPath, workingDir, ".", 1)
+	goRootsCache.mu.Lock()
+	roots := goRootsCache.roots
+	goRootsCache.mu.Unlock()
+	return shortenFilePath(fullPath, workingDir, roots)
+}
+
+// goRoots contains the directories that ShortenFilePath abbreviates.
+type goRoots struct {
+	goroot, gopath, modcache string
+}
+
+// goRootsCache is filled in the background by loadGoRoots, until then
+// ShortenFilePath will not abbreviate GOROOT, GOPATH and the module cache.
+var goRootsCache struct {
+	mu    sync.Mutex
+	roots goRoots
+}
+
+func loadGoRoots() {
+	out, err := exec.Command("go", "env", "GOROOT", "GOPATH", "GOMODCACHE").Output()
+	if err != nil {
+		return
+	}
+	v := strings.Split(string(out), "\n")
+	if len(v) < 3 {
+		return
+	}
+	var roots goRoots
+	roots.goroot = v[0]
+	if gopath := filepath.SplitList(v[1]); len(gopath) > 0 {
+		roots.gopath = gopath[0]
+	}
+	roots.modcache = v[2]
+	if roots.modcache == "" && roots.gopath != "" {
+		// GOMODCACHE is not supported by versions of go before 1.15
+		roots.modcache = filepath.Join(roots.gopath, "pkg", "mod")
+	}
+	goRootsCache.mu.Lock()
+	goRootsCache.roots = roots
+	goRootsCache.mu.Unlock()
+}
+
+func shortenFilePath(path, wd string, roots goRoots) string {
+	hasDirPrefix := func(dir string) bool {
+		return dir != "" && strings.HasPrefix(path, dir) && len(path) > len(dir) && (path[len(dir)] == '/' || path[len(dir)] == os.PathSeparator)
+	}
+	switch {
+	case hasDirPrefix(roots.modcache):
+		return unescapeModulePath(path[len(roots.modcache)+1:])
+	case hasDirPrefix(roots.goroot):
+		return "$GOROOT" + path[len(roots.goroot):]
+	case hasDirPrefix(wd):
+		return "." + path[len(wd):]
+	case hasDirPrefix(roots.gopath):
+		return "$GOPATH" + path[len(roots.gopath):]
+	}
+	return path
+}
+
+// unescapeModulePath reverses the escaping of upper case letters used in
+// the module cache (for example "!burnt!sushi" is "BurntSushi").
+func unescapeModulePath(path string) string {
+	if !strings.Contains(path, "!") {
+		return path
+	}
+	var buf bytes.Buffer
+	for i := 0; i < len(path); i++ {
+		if path[i] == '!' && i+1 < len(path) && path[i+1] >= 'a' && path[i+1] <= 'z' {
+			buf.WriteByte(path[i+1] - 'a' + 'A')
+			i++
+			continue
+		}
+		buf.WriteByte(path[i])
+	}
+	return buf.String()
 }
 
 func executeCommand(cmdstr string) {
@@ -1592,33 +3569,232 @@ func (c *Commands) Call(cmdstr, args string, out io.Writer) error {
 	return c.Find(cmdstr)(out, args)
 }
 
+// disabledInCore wraps commands that resume the execution of the target,
+// which is not possible for core files.
+func disabledInCore(name string, fn cmdfunc) cmdfunc {
+	return func(out io.Writer, args string) error {
+		if BackendServer.IsCore() {
+			return fmt.Errorf("%s not available when debugging a core file", name)
+		}
+		return fn(out, args)
+	}
+}
+
+func coreCommand(out io.Writer, args string) error {
+	argv := splitQuotedFields(args, '\'')
+	if len(argv) != 2 {
+		return errors.New("wrong number of arguments: core <executable> <core file>")
+	}
+	return BackendServer.OpenCore(out, argv[0], argv[1])
+}
+
+func reconnectCommand(out io.Writer, args string) error {
+	return BackendServer.Reconnect(out)
+}
+
+func attachCommand(out io.Writer, args string) error {
+	if args == "" {
+		return errors.New("wrong number of arguments: attach <pid or name-regex>")
+	}
+	if pid, err := strconv.Atoi(args); err == nil {
+		return BackendServer.Attach(out, pid)
+	}
+	re, err := regexp.Compile(args)
+	if err != nil {
+		return err
+	}
+	procs, err := listProcesses()
+	if err != nil {
+		return err
+	}
+	matches := matchProcesses(procs, re)
+	for _, p := range matches {
+		fmt.Fprintf(out, "%d\t%s\n", p.pid, p.name)
+	}
+	switch len(matches) {
+	case 0:
+		return fmt.Errorf("no process matching %q", args)
+	case 1:
+		return BackendServer.Attach(out, matches[0].pid)
+	}
+
+	wnd.PopupOpen("Attach to process", dynamicPopupFlags, rect.Rect{100, 100, 500, 700}, true, func(w *nucular.Window) {
+		w.Row(20).Dynamic(1)
+		for _, p := range matches {
+			if w.ButtonText(fmt.Sprintf("%d %s", p.pid, p.name)) {
+				pid := p.pid
+				go pseudoCommandWrap(func(out io.Writer) error {
+					return BackendServer.Attach(out, pid)
+				})
+				w.Close()
+			}
+		}
+		w.Row(20).Static(0, 80, 0)
+		w.Spacing(1)
+		if w.ButtonText("Cancel") {
+			w.Close()
+		}
+		w.Spacing(1)
+	})
+	return nil
+}
+
 func doCommand(cmd string) {
 	var scrollbackOut = editorWriter{&scrollbackEditor, false}
 	fmt.Fprintf(&scrollbackOut, "%s %s\n", currentPrompt(), cmd)
 	go executeCommand(cmd)
 }
 
+// initCommands is the command script passed with the -init option, it is
+// executed once after the first connection to the target.
+var initCommands struct {
+	path            string
+	continueOnError bool
+	once            sync.Once
+}
+
+func runInitCommands() {
+	if initCommands.path == "" {
+		return
+	}
+	initCommands.once.Do(func() {
+		out := editorWriter{&scrollbackEditor, true}
+		if err := executeCommandScript(&out, initCommands.path, initCommands.continueOnError); err != nil {
+			fmt.Fprintf(&out, "Init script failed: %v\n", err)
+		}
+	})
+}
+
+// parseCommandScript returns the commands contained in a command script,
+// one per line, skipping empty lines and lines starting with '#'.
+func parseCommandScript(src string) []string {
+	r := []string{}
+	for _, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		r = append(r, line)
+	}
+	return r
+}
+
+// executeCommandScript executes the commands in the file at path, stopping
+// at the first failed command unless continueOnError is set.
+func executeCommandScript(out io.Writer, path string, continueOnError bool) error {
+	buf, err := ioutil.ReadFile(expandTilde(path))
+	if err != nil {
+		return err
+	}
+	echo := editorWriter{&scrollbackEditor, false}
+	for _, line := range parseCommandScript(string(buf)) {
+		fmt.Fprintf(&echo, "%s %s\n", currentPrompt(), line)
+		logf("Command: %s", line)
+		cmdstr, args := parseCommand(line)
+		err := cmds.Call(cmdstr, args, out)
+		wnd.Changed()
+		if err == nil {
+			continue
+		}
+		if _, ok := err.(ExitRequestError); ok {
+			handleExitRequest()
+			return nil
+		}
+		if aerr, ok := err.(*assertionError); !continueOnError || (ok && aerr.fatal) {
+			return fmt.Errorf("%s: %v", line, err)
+		}
+		fmt.Fprintf(out, "Command failed: %s\n", err)
+	}
+	return nil
+}
+
+type assertionError struct {
+	expr  string
+	fatal bool
+}
+
+func (err *assertionError) Error() string {
+	return fmt.Sprintf("assertion failed: %s", err.expr)
+}
+
+func assertCommand(out io.Writer, args string) error {
+	const fatalPrefix = "-fatal "
+	fatal := false
+	if strings.HasPrefix(args, fatalPrefix) {
+		fatal = true
+		args = strings.TrimSpace(args[len(fatalPrefix):])
+	}
+	if args == "" {
+		return errors.New("wrong number of arguments: assert [-fatal] <expr>")
+	}
+	ok, err := assertResult(evalScopedExpr(args, ShortLoadConfig))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Fprintf(out, "\n*** ASSERTION FAILED: %s ***\n\n", args)
+		return &assertionError{expr: args, fatal: fatal}
+	}
+	return nil
+}
+
+// assertResult returns the value of the boolean variable v.
+func assertResult(v *api.Variable) (bool, error) {
+	if v.Unreadable != "" {
+		return false, fmt.Errorf("could not evaluate assertion: %s", v.Unreadable)
+	}
+	if v.Kind != reflect.Bool {
+		return false, fmt.Errorf("assertion is not a boolean expression: %s has type %s", v.Name, v.Type)
+	}
+	return v.Value == "true", nil
+}
+
 func continueToLine(file string, lineno int) {
 	out := editorWriter{&scrollbackEditor, true}
+	if BackendServer.IsCore() {
+		fmt.Fprintf(&out, "Could not continue to specified line: not available when debugging a core file\n")
+		return
+	}
 	bp, err := client.CreateBreakpoint(&api.Breakpoint{File: file, Line: lineno})
 	if err != nil {
 		fmt.Fprintf(&out, "Could not continue to specified line, could not create breakpoint: %v\n", err)
 		return
 	}
-	state, err := client.StepOut()
+	if err := continueToBreakpoint(&out, bp, "continue-to-line"); err != nil {
+		fmt.Fprintf(&out, "Could not continue to specified line: %v\n", err)
+	}
+}
+
+func continueToLocspec(out io.Writer, locspec string) error {
+	locs, err := client.FindLocation(currentEvalScope(), locspec)
 	if err != nil {
-		fmt.Fprintf(&out, "Could not continue to specified line, could not step out: %v\n", err)
-		return
+		return err
 	}
-	printcontext(&out, state)
-	err = continueUntilCompleteNext(&out, state, "continue-to-line", bp)
-	client.ClearBreakpoint(bp.ID)
-	client.CancelNext()
-	refreshState(refreshToSameFrame, clearBreakpoint, nil)
+	if len(locs) != 1 {
+		return fmt.Errorf("ambiguous location %q (%d matches)", locspec, len(locs))
+	}
+	bp, err := client.CreateBreakpoint(&api.Breakpoint{Addr: locs[0].PC})
 	if err != nil {
-		fmt.Fprintf(&out, "Could not continue to specified line, could not step out: %v\n", err)
-		return
+		return fmt.Errorf("could not create breakpoint: %v", err)
+	}
+	return continueToBreakpoint(out, bp, "continue-to-location")
+}
+
+// continueToBreakpoint continues until the temporary breakpoint bp is
+// reached, bp is cleared when execution stops.
+func continueToBreakpoint(out io.Writer, bp *api.Breakpoint, op string) error {
+	defer func() {
+		client.ClearBreakpoint(bp.ID)
+		client.CancelNext()
+		refreshState(refreshToSameFrame, clearBreakpoint, nil)
+	}()
+	gid := curGid
+	state, err := client.StepOut()
+	if err != nil {
+		return fmt.Errorf("could not step out: %v", err)
 	}
+	printcontext(out, state)
+	return continueUntilCompleteNext(out, state, op, gid, bp)
 }
 
 func getVariableLoadConfig() api.LoadConfig {
@@ -1631,3 +3807,36 @@ func getVariableLoadConfig() api.LoadConfig {
 	}
 	return cfg
 }
+
+// getVariableLoadConfigForType is like getVariableLoadConfig but uses the
+// limits configured for typ, if any.
+func getVariableLoadConfigForType(typ string) api.LoadConfig {
+	cfg := getVariableLoadConfig()
+	if l, ok := conf.TypeLoadLimits[typ]; ok {
+		if l.MaxArrayValues > 0 {
+			cfg.MaxArrayValues = l.MaxArrayValues
+		}
+		if l.MaxStringLen > 0 {
+			cfg.MaxStringLen = l.MaxStringLen
+		}
+	}
+	return cfg
+}
+
+// belowTypeLoadLimits returns true if v was truncated to fewer elements
+// than the limits configured for its type allow.
+func belowTypeLoadLimits(v *api.Variable) bool {
+	l, ok := conf.TypeLoadLimits[v.Type]
+	if !ok || v.Addr == 0 {
+		return false
+	}
+	switch v.Kind {
+	case reflect.Array, reflect.Slice:
+		n := len(v.Children)
+		return n < int(v.Len) && n < l.MaxArrayValues
+	case reflect.String:
+		n := len(v.Value)
+		return n < int(v.Len) && n < l.MaxStringLen
+	}
+	return false
+}
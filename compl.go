@@ -67,7 +67,7 @@ func completeLocation() {
 	}
 	word = lastWord([]rune{' ', ':', '/'})
 	if len(word) > 0 {
-		completeWord(word, pathCompl, funcCompl)
+		completeWordFuzzy(word, !conf.StrictCompletion, pathCompl, funcCompl)
 	}
 }
 
@@ -88,7 +88,11 @@ func lastWord(seps []rune) string {
 }
 
 func completeWord(word string, completionLists ...[]string) {
-	cm := completeMachine{word: word}
+	completeWordFuzzy(word, false, completionLists...)
+}
+
+func completeWordFuzzy(word string, fuzzy bool, completionLists ...[]string) {
+	cm := completeMachine{word: word, fuzzy: fuzzy}
 	for _, completionList := range completionLists {
 		for _, compl := range completionList {
 			cm.add(compl)
@@ -99,7 +103,7 @@ func completeWord(word string, completionLists ...[]string) {
 
 func completeVariable() {
 	word := lastWord([]rune{' '})
-	cm := completeMachine{word: word}
+	cm := completeMachine{word: word, fuzzy: !conf.StrictCompletion}
 	func() {
 		localsPanel.asyncLoad.mu.Lock()
 		defer localsPanel.asyncLoad.mu.Unlock()
@@ -196,16 +200,81 @@ func expandTilde(path string) string {
 type completeMachine struct {
 	word   string
 	compls []string
+	// fuzzy enables matching completions that contain the characters of
+	// word in order, they are only used when no completion has word as a
+	// prefix.
+	fuzzy       bool
+	fuzzyCompls []string
 }
 
 func (cm *completeMachine) add(compl string) {
 	if strings.HasPrefix(compl, cm.word) {
 		cm.compls = append(cm.compls, compl)
+	} else if cm.fuzzy && fuzzyMatch(cm.word, compl) {
+		cm.fuzzyCompls = append(cm.fuzzyCompls, compl)
+	}
+}
+
+// fuzzyMatch returns true if the characters of word appear in compl in the
+// same order, ignoring case.
+func fuzzyMatch(word, compl string) bool {
+	compl = strings.ToLower(compl)
+	for _, ch := range strings.ToLower(word) {
+		i := strings.IndexRune(compl, ch)
+		if i < 0 {
+			return false
+		}
+		compl = compl[i+1:]
 	}
+	return true
+}
+
+// partsMatch returns true if each dot separated part of word is a prefix
+// of the corresponding part of compl, for example "ma.ma" and "main.main".
+func partsMatch(word, compl string) bool {
+	wordParts := strings.Split(word, ".")
+	complParts := strings.Split(compl, ".")
+	if len(wordParts) > len(complParts) {
+		return false
+	}
+	for i := range wordParts {
+		if !strings.HasPrefix(complParts[i], wordParts[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// fuzzyRank returns the rank of a fuzzy completion of word, lower is
+// better: completions where each part of word is a prefix of a part of
+// compl come before completions that only contain the characters of word.
+func fuzzyRank(word, compl string) int {
+	if partsMatch(word, compl) {
+		return 0
+	}
+	return 1
+}
+
+// rankFuzzy sorts fuzzy completions of word, best ranked first and
+// shortest first within the same rank.
+func rankFuzzy(word string, compls []string) []string {
+	compls = dedup(compls)
+	sort.SliceStable(compls, func(i, j int) bool {
+		ri, rj := fuzzyRank(word, compls[i]), fuzzyRank(word, compls[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return len(compls[i]) < len(compls[j])
+	})
+	return compls
 }
 
 func (cm *completeMachine) finish() {
 	cm.compls = dedup(cm.compls)
+	if len(cm.compls) == 0 && len(cm.fuzzyCompls) > 0 {
+		cm.finishFuzzy()
+		return
+	}
 	switch len(cm.compls) {
 	case 0:
 		return
@@ -214,14 +283,39 @@ func (cm *completeMachine) finish() {
 	default:
 		compl := commonPrefix(cm.compls)
 		commandLineEditor.Text([]rune(compl[len(cm.word):]))
-		out := editorWriter{&scrollbackEditor, false}
-		more := ""
-		if len(cm.compls) > 5 {
-			more = "..."
-			cm.compls = cm.compls[:5]
-		}
-		fmt.Fprintf(&out, "Completions: %s%s\n", strings.Join(cm.compls, ", "), more)
+		printCompletions(cm.compls)
+	}
+}
+
+// finishFuzzy replaces word with the best fuzzy completion if there is
+// only one with the best rank, otherwise lists them.
+func (cm *completeMachine) finishFuzzy() {
+	compls := rankFuzzy(cm.word, cm.fuzzyCompls)
+	if len(compls) > 1 && fuzzyRank(cm.word, compls[0]) == fuzzyRank(cm.word, compls[1]) {
+		printCompletions(compls)
+		return
+	}
+	ed := &commandLineEditor
+	start := ed.Cursor - len([]rune(cm.word))
+	if start < 0 || string(ed.Buffer[start:ed.Cursor]) != cm.word {
+		return
+	}
+	buf := append([]rune{}, ed.Buffer[:start]...)
+	buf = append(buf, []rune(compls[0])...)
+	cursor := len(buf)
+	buf = append(buf, ed.Buffer[ed.Cursor:]...)
+	ed.Buffer = buf
+	ed.Cursor = cursor
+}
+
+func printCompletions(compls []string) {
+	out := editorWriter{&scrollbackEditor, false}
+	more := ""
+	if len(compls) > 5 {
+		more = "..."
+		compls = compls[:5]
 	}
+	fmt.Fprintf(&out, "Completions: %s%s\n", strings.Join(compls, ", "), more)
 }
 
 func dedup(v []string) []string {
@@ -3,10 +3,16 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
+	"sync"
 
 	"github.com/aarzilli/nucular/rect"
 )
@@ -35,6 +41,37 @@ type Configuration struct {
 	SubstitutePath       []SubstitutePathRule
 	FrozenBreakpoints    map[string][]frozenBreakpoint
 	DisabledBreakpoints  map[string][]frozenBreakpoint
+	MonitoredExpressions map[string][]string
+	ShowEnumNames        bool
+	FullFilePaths        bool
+	MaxHistoryLength     int
+	HistoryIgnoreSpace   bool
+	TimestampOutput      bool
+	DisableANSIColors    bool
+	Bookmarks            map[string][]int
+	InlineValues         bool
+	TypeLoadLimits       map[string]TypeLoadLimits
+	StepSkipPackages     []string
+	StepSkipDepth        int
+	DisassembleOptimized bool
+	StructFieldPrefs     map[string]StructFieldPrefs
+	MaxVariableDepth     int
+	StrictCompletion     bool
+	KeepNextOnRestart    bool
+}
+
+// TypeLoadLimits overrides MaxArrayValues and MaxStringLen for variables
+// of a given type.
+type TypeLoadLimits struct {
+	MaxArrayValues int
+	MaxStringLen   int
+}
+
+// StructFieldPrefs lists the fields of a struct type that are hidden or
+// shown before all other fields.
+type StructFieldPrefs struct {
+	Hidden []string
+	Pinned []string
 }
 
 type LayoutDescr struct {
@@ -47,11 +84,41 @@ type SubstitutePathRule struct {
 	// Directory path will be substituted if it matches `From`.
 	From string
 	// Path to which substitution is performed.
+	// For regular expression rules it can reference submatches of From as
+	// $1, ${name}, etc.
 	To string
+	// If Regexp is set From is a regular expression.
+	Regexp bool
+}
+
+var substitutePathRegexps = struct {
+	mu sync.Mutex
+	m  map[string]*regexp.Regexp
+}{m: make(map[string]*regexp.Regexp)}
+
+// compile returns the compiled regular expression of a regular expression
+// rule.
+func (r *SubstitutePathRule) compile() (*regexp.Regexp, error) {
+	substitutePathRegexps.mu.Lock()
+	defer substitutePathRegexps.mu.Unlock()
+	if re := substitutePathRegexps.m[r.From]; re != nil {
+		return re, nil
+	}
+	re, err := regexp.Compile(r.From)
+	if err != nil {
+		return nil, err
+	}
+	substitutePathRegexps.m[r.From] = re
+	return re, nil
 }
 
 var conf Configuration
 
+// envSubstitutePath contains the substitution rules specified by the
+// GDLV_SUBST environment variable, they are applied after the rules in
+// the configuration and never saved.
+var envSubstitutePath []SubstitutePathRule
+
 func adjustConfiguration() {
 	if conf.Scaling < 0.2 {
 		conf.Scaling = 1.0
@@ -65,6 +132,15 @@ func adjustConfiguration() {
 	if ld, ok := conf.Layouts["default"]; !ok || ld.Layout == "" {
 		conf.Layouts["default"] = LayoutDescr{"|300_250LC_180Sl", "Default layout"}
 	}
+	if conf.StepSkipPackages == nil {
+		conf.StepSkipPackages = []string{"runtime"}
+	}
+	if conf.StepSkipDepth <= 0 {
+		conf.StepSkipDepth = defaultStepSkipDepth
+	}
+	if conf.MaxVariableDepth <= 0 {
+		conf.MaxVariableDepth = defaultMaxVariableDepth
+	}
 	if conf.SavedBounds == nil {
 		conf.SavedBounds = make(map[string]rect.Rect)
 	}
@@ -78,6 +154,56 @@ func configLoc() string {
 	return os.ExpandEnv(loc)
 }
 
+const defaultMaxHistoryLength = 1000
+
+const defaultStepSkipDepth = 3
+
+// defaultMaxVariableDepth is the default nesting depth up to which the
+// variables panel loads more data automatically.
+const defaultMaxVariableDepth = 10
+
+func historyLoc() string {
+	return configLoc() + "-history"
+}
+
+// loadHistory loads the command history saved by saveHistory.
+func loadHistory() {
+	buf, err := ioutil.ReadFile(historyLoc())
+	if err != nil {
+		return
+	}
+	for _, cmd := range strings.Split(string(buf), "\n") {
+		if cmd != "" {
+			cmdhistory = append(cmdhistory, cmd)
+		}
+	}
+	historyShown = len(cmdhistory)
+}
+
+// saveHistory saves the last conf.MaxHistoryLength commands of the command
+// history. If conf.HistoryIgnoreSpace is set commands starting with a space
+// are not saved.
+func saveHistory() {
+	max := conf.MaxHistoryLength
+	if max <= 0 {
+		max = defaultMaxHistoryLength
+	}
+	var saved []string
+	for i := len(cmdhistory) - 1; i >= 0 && len(saved) < max; i-- {
+		cmd := cmdhistory[i]
+		if cmd == "" || strings.Contains(cmd, "\n") || (conf.HistoryIgnoreSpace && strings.HasPrefix(cmd, " ")) {
+			continue
+		}
+		saved = append(saved, cmd)
+	}
+	var buf bytes.Buffer
+	for i := len(saved) - 1; i >= 0; i-- {
+		buf.WriteString(saved[i])
+		buf.WriteByte('\n')
+	}
+	ioutil.WriteFile(historyLoc(), buf.Bytes(), 0600)
+}
+
 func loadConfiguration() {
 	defer adjustConfiguration()
 	fh, err := os.Open(configLoc())
@@ -86,14 +212,194 @@ func loadConfiguration() {
 	}
 	defer fh.Close()
 	json.NewDecoder(fh).Decode(&conf)
-	if conf.CustomFormatters == nil {
-		conf.CustomFormatters = make(map[string]*CustomFormatter)
+	cleanupCustomFormatters(&conf)
+}
+
+func cleanupCustomFormatters(c *Configuration) {
+	if c.CustomFormatters == nil {
+		c.CustomFormatters = make(map[string]*CustomFormatter)
 	}
-	for k, cfmt := range conf.CustomFormatters {
+	for k, cfmt := range c.CustomFormatters {
 		if !cfmt.IsStarlark {
-			delete(conf.CustomFormatters, k)
+			delete(c.CustomFormatters, k)
+		}
+	}
+}
+
+func profilesDir() string {
+	return configLoc() + "-profiles"
+}
+
+// profileLoc returns the path of the configuration profile called name,
+// name can also be the path of a file.
+func profileLoc(name string) string {
+	if strings.ContainsRune(name, os.PathSeparator) || filepath.Ext(name) == ".json" {
+		return name
+	}
+	return filepath.Join(profilesDir(), name+".json")
+}
+
+func saveProfile(name string) error {
+	path := profileLoc(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	buf, err := json.MarshalIndent(&conf, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf, 0640)
+}
+
+// loadProfile replaces the current configuration with the profile called
+// name. The state kept for each executable (breakpoints, monitored
+// expressions and bookmarks) is not part of the profile and is preserved.
+func loadProfile(name string) error {
+	buf, err := ioutil.ReadFile(profileLoc(name))
+	if err != nil {
+		return err
+	}
+	var c Configuration
+	if err := json.Unmarshal(buf, &c); err != nil {
+		return err
+	}
+	cleanupCustomFormatters(&c)
+
+	wnd.Lock()
+	c.FrozenBreakpoints = conf.FrozenBreakpoints
+	c.DisabledBreakpoints = conf.DisabledBreakpoints
+	c.MonitoredExpressions = conf.MonitoredExpressions
+	c.Bookmarks = conf.Bookmarks
+	conf = c
+	adjustConfiguration()
+	saveConfiguration()
+	setupStyle()
+	wnd.Unlock()
+	wnd.Changed()
+	return nil
+}
+
+func listProfiles() ([]string, error) {
+	fis, err := ioutil.ReadDir(profilesDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var r []string
+	for _, fi := range fis {
+		if name := fi.Name(); !fi.IsDir() && filepath.Ext(name) == ".json" {
+			r = append(r, strings.TrimSuffix(name, ".json"))
+		}
+	}
+	return r, nil
+}
+
+// loadEnvSubstitutePath reads substitution rules from the GDLV_SUBST
+// environment variable.
+func loadEnvSubstitutePath() {
+	s := os.Getenv("GDLV_SUBST")
+	if s == "" {
+		return
+	}
+	rules, err := parseSubstitutePathList(s)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing GDLV_SUBST: %v\n", err)
+		return
+	}
+	envSubstitutePath = rules
+}
+
+// parseSubstitutePathList parses a list of substitution rules with the
+// format from1=to1<sep>from2=to2..., where <sep> is the path list
+// separator of the platform (':' on unix, ';' on windows).
+func parseSubstitutePathList(s string) ([]SubstitutePathRule, error) {
+	var r []SubstitutePathRule
+	for _, rule := range strings.Split(s, string(os.PathListSeparator)) {
+		if rule == "" {
+			continue
+		}
+		eq := strings.Index(rule, "=")
+		if eq <= 0 {
+			return nil, fmt.Errorf("malformed rule %q", rule)
 		}
+		r = append(r, SubstitutePathRule{From: rule[:eq], To: rule[eq+1:]})
+	}
+	return r, nil
+}
+
+// mergeSubstitutePath adds the rules in newRules to rules, rules with the
+// same From as an existing rule replace it.
+func mergeSubstitutePath(rules, newRules []SubstitutePathRule) []SubstitutePathRule {
+newRulesLoop:
+	for _, nr := range newRules {
+		for i := range rules {
+			if rules[i].From == nr.From {
+				rules[i].To = nr.To
+				continue newRulesLoop
+			}
+		}
+		rules = append(rules, nr)
+	}
+	return rules
+}
+
+func importSubstitutePath(path string) (int, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var rules []SubstitutePathRule
+	if err := json.Unmarshal(buf, &rules); err != nil {
+		return 0, err
 	}
+	conf.SubstitutePath = mergeSubstitutePath(conf.SubstitutePath, rules)
+	return len(rules), nil
+}
+
+func exportSubstitutePath(path string) error {
+	buf, err := json.MarshalIndent(conf.SubstitutePath, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf, 0640)
+}
+
+type exportedLayout struct {
+	Name string
+	LayoutDescr
+}
+
+func exportLayout(name, path string) error {
+	ld, ok := conf.Layouts[name]
+	if !ok {
+		return fmt.Errorf("unknown layout %q", name)
+	}
+	buf, err := json.MarshalIndent(exportedLayout{name, ld}, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf, 0640)
+}
+
+func importLayout(path string) (string, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var el exportedLayout
+	if err := json.Unmarshal(buf, &el); err != nil {
+		return "", err
+	}
+	if el.Name == "" {
+		return "", fmt.Errorf("layout has no name")
+	}
+	if err := checkLayout(el.Layout); err != nil {
+		return "", fmt.Errorf("malformed layout %q: %v", el.Name, err)
+	}
+	conf.Layouts[el.Name] = el.LayoutDescr
+	return el.Name, nil
 }
 
 func saveConfiguration() {
@@ -106,6 +412,10 @@ func saveConfiguration() {
 		}
 		conf.FrozenBreakpoints[BackendServer.debugid] = append(conf.FrozenBreakpoints[BackendServer.debugid][:0], FrozenBreakpoints...)
 		conf.DisabledBreakpoints[BackendServer.debugid] = append(conf.DisabledBreakpoints[BackendServer.debugid][:0], DisabledBreakpoints...)
+		if conf.MonitoredExpressions == nil {
+			conf.MonitoredExpressions = make(map[string][]string)
+		}
+		conf.MonitoredExpressions[BackendServer.debugid] = append(conf.MonitoredExpressions[BackendServer.debugid][:0], MonitoredExpressions...)
 	}
 	fh, err := os.Create(configLoc())
 	if err != nil {
@@ -117,8 +427,27 @@ func saveConfiguration() {
 
 func (conf *Configuration) substitutePath(path string) string {
 	path = crossPlatformPath(path)
+	for _, rules := range [][]SubstitutePathRule{conf.SubstitutePath, envSubstitutePath} {
+		if r, ok := applySubstitutePath(rules, path); ok {
+			return r
+		}
+	}
+	return path
+}
+
+func applySubstitutePath(rules []SubstitutePathRule, path string) (string, bool) {
 	separator := string(os.PathSeparator)
-	for _, r := range conf.SubstitutePath {
+	for _, r := range rules {
+		if r.Regexp {
+			re, err := r.compile()
+			if err != nil {
+				continue
+			}
+			if m := re.FindStringSubmatchIndex(path); m != nil {
+				return path[:m[0]] + string(re.ExpandString(nil, r.To, path, m)) + path[m[1]:], true
+			}
+			continue
+		}
 		from := crossPlatformPath(r.From)
 		to := r.To
 
@@ -129,10 +458,10 @@ func (conf *Configuration) substitutePath(path string) string {
 			to = to + separator
 		}
 		if strings.HasPrefix(path, from) {
-			return strings.Replace(path, from, to, 1)
+			return strings.Replace(path, from, to, 1), true
 		}
 	}
-	return path
+	return path, false
 }
 
 func crossPlatformPath(path string) string {
@@ -3,15 +3,22 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"image"
+	"image/color"
 	"math"
 	"reflect"
+	"regexp"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"go.starlark.net/starlark"
 
 	"github.com/aarzilli/nucular"
+	ncommand "github.com/aarzilli/nucular/command"
 	"github.com/aarzilli/nucular/rect"
+	nstyle "github.com/aarzilli/nucular/style"
 
 	"github.com/aarzilli/gdlv/internal/dlvclient/service/api"
 )
@@ -20,9 +27,28 @@ type formatterFn func(*Variable)
 
 var varFormat = map[uintptr]formatterFn{}
 
+// varTypeFormat remembers, for each signed integer type, whether its values
+// should be displayed in signed or two's complement hexadecimal.
+var varTypeFormat = map[string]formatterFn{}
+
+// targetIntSize is the size in bytes of the int type of the target, 0 if
+// it is not known yet.
+var targetIntSize int32
+
 type detailViewer struct {
 	asyncLoad asyncLoad
 
+	id             int
+	title          string
+	shown          bool // Update was called at least once
+	closeRequested bool
+
+	live    bool // re-evaluate the expression every time the target stops
+	wasRead bool // the expression was evaluated successfully at least once
+
+	history []float64 // values of a numeric expression at the last stops
+	stopped bool      // the next reload happens because the target stopped
+
 	len int
 
 	exprEd nucular.TextEditor
@@ -36,9 +62,17 @@ type detailViewer struct {
 	numberMode numberMode
 	ed         nucular.TextEditor
 
+	plot          bool // show numeric slices as a line plot
+	matrixTree    bool // show two dimensional arrays as a tree instead of a grid
+	matrixCellLen int  // length of the longest cell of a two dimensional array
+
 	mu sync.Mutex
 }
 
+// detailHistoryLen is the number of values of a numeric expression shown
+// in the history sparkline of a detail window.
+const detailHistoryLen = 50
+
 type stringViewerMode int
 
 const (
@@ -47,8 +81,22 @@ const (
 	viewRuneArray
 )
 
+// detailViewers contains the detail windows that are open.
+var detailViewers struct {
+	mu   sync.Mutex
+	next int
+	v    []*detailViewer
+}
+
 func newDetailViewer(mw nucular.MasterWindow, expr string) {
-	r := &detailViewer{}
+	r := &detailViewer{live: true}
+	r.title = fmt.Sprintf("Details %s (goroutine %d, frame %d)", expr, curGid, curFrame)
+
+	detailViewers.mu.Lock()
+	detailViewers.next++
+	r.id = detailViewers.next
+	detailViewers.v = append(detailViewers.v, r)
+	detailViewers.mu.Unlock()
 
 	r.asyncLoad.load = r.load
 	r.ed.Flags = nucular.EditReadOnly | nucular.EditMultiline | nucular.EditSelectable | nucular.EditClipboard
@@ -57,14 +105,69 @@ func newDetailViewer(mw nucular.MasterWindow, expr string) {
 	r.exprEd.Buffer = []rune(expr)
 	r.len = 64
 
-	mw.PopupOpen("Details", popupFlags|nucular.WindowNonmodal|nucular.WindowScalable|nucular.WindowClosable, rect.Rect{100, 100, 550, 400}, true, r.Update)
+	mw.PopupOpen(r.title, popupFlags|nucular.WindowNonmodal|nucular.WindowScalable|nucular.WindowClosable, rect.Rect{100, 100, 550, 400}, true, r.Update)
+}
+
+// openDetailViewers returns the detail windows that are still open.
+func openDetailViewers() []*detailViewer {
+	open := map[*asyncLoad]bool{}
+	wnd.Walk(func(title string, data interface{}, docked bool, splitSize int, rect rect.Rect) {
+		if l, ok := data.(*asyncLoad); ok {
+			open[l] = true
+		}
+	})
+
+	detailViewers.mu.Lock()
+	defer detailViewers.mu.Unlock()
+	r := detailViewers.v[:0]
+	for _, dv := range detailViewers.v {
+		if !dv.shown || open[&dv.asyncLoad] {
+			r = append(r, dv)
+		}
+	}
+	detailViewers.v = r
+	return append([]*detailViewer{}, r...)
+}
+
+// detailViewerIsLive returns true if l belongs to a detail window that
+// should be reloaded when the target stops.
+func detailViewerIsLive(l *asyncLoad) bool {
+	detailViewers.mu.Lock()
+	defer detailViewers.mu.Unlock()
+	for _, dv := range detailViewers.v {
+		if &dv.asyncLoad == l {
+			return dv.live
+		}
+	}
+	return true
+}
+
+// detailViewerStopped records that the detail window l is being reloaded
+// because the target stopped, so that the new value is added to its
+// history.
+func detailViewerStopped(l *asyncLoad) {
+	detailViewers.mu.Lock()
+	defer detailViewers.mu.Unlock()
+	for _, dv := range detailViewers.v {
+		if &dv.asyncLoad == l {
+			dv.stopped = true
+		}
+	}
 }
 
 func (dv *detailViewer) load(p *asyncLoad) {
+	detailViewers.mu.Lock()
+	stopped := dv.stopped
+	dv.stopped = false
+	detailViewers.mu.Unlock()
+
 	expr := string(dv.exprEd.Buffer)
 	dv.v = nil
 	dv.loadErr = nil
-	v, err := client.EvalVariable(currentEvalScope(), expr, api.LoadConfig{false, 0, dv.len, dv.len, -1})
+	cfg := getVariableLoadConfig()
+	cfg.MaxStringLen = dv.len
+	cfg.MaxArrayValues = dv.len
+	v, err := client.EvalVariable(currentEvalScope(), expr, cfg)
 	if err != nil {
 		dv.loadErr = err
 		if p != nil {
@@ -74,6 +177,12 @@ func (dv *detailViewer) load(p *asyncLoad) {
 	}
 
 	dv.v = wrapApiVariable(v, v.Name, v.Name, true)
+	if dv.v.Unreadable == "" {
+		dv.wasRead = true
+	}
+	if x, ok := numericValue(v); ok && (stopped || len(dv.history) == 0) {
+		dv.history = appendHistory(dv.history, x, detailHistoryLen)
+	}
 
 	switch dv.v.Type {
 	case "string":
@@ -161,11 +270,44 @@ func (dv *detailViewer) setupView() {
 		size := int(math.Ceil((math.Log(float64(max)) / math.Log(2)) / 8))
 		dv.ed.Buffer = []rune(formatArray(array, dv.numberMode != decMode, dv.numberMode, false, size, 10))
 
+	case "[]float32", "[]float64":
+		var buf bytes.Buffer
+		idxfmt := fmt.Sprintf("[%%%dd]  %%s\n", digits(len(dv.v.Children)))
+		for i := range dv.v.Children {
+			fmt.Fprintf(&buf, idxfmt, i, dv.v.Children[i].Value)
+		}
+		dv.ed.Buffer = []rune(buf.String())
+
 	default:
+		if isMatrixType(dv.v.Type) {
+			dv.matrixCellLen = 1
+			for _, row := range dv.v.Children {
+				for _, cell := range row.Children {
+					if n := len([]rune(matrixCellValue(cell))); n > dv.matrixCellLen {
+						dv.matrixCellLen = n
+					}
+				}
+			}
+			return
+		}
 		dv.ed.Buffer = []rune(fmt.Sprintf("unsupported type %s", dv.v.Type))
 	}
 }
 
+// matrixTypeRe matches the types of two dimensional arrays and slices.
+var matrixTypeRe = regexp.MustCompile(`^\[\d*\]\[\d*\][^\[\]]+$`)
+
+func isMatrixType(typ string) bool {
+	return matrixTypeRe.MatchString(typ)
+}
+
+func matrixCellValue(v *Variable) string {
+	if v.Value != "" {
+		return v.Value
+	}
+	return v.SinglelineString(false, false)
+}
+
 func (dv *detailViewer) viewStringAsByteArray(bytes []byte) {
 	array := make([]int64, len(bytes))
 	for i := range bytes {
@@ -246,21 +388,36 @@ func formatArray(array []int64, hexaddr bool, mode numberMode, canonical bool, s
 }
 
 func (dv *detailViewer) Update(container *nucular.Window) {
+	if dv.closeRequested {
+		container.Close()
+		return
+	}
+	dv.shown = true
 	w := dv.asyncLoad.showRequest(container)
 	if w == nil {
 		return
 	}
 
-	w.Row(30).Static(100, 0, 80, 150)
+	w.Row(30).Static(100, 0, 80, 60, 150)
 	w.Label("Expression: ", "LC")
 	active := dv.exprEd.Edit(w)
 	if active&nucular.EditCommitted != 0 {
+		dv.wasRead = false
+		dv.history = nil
 		dv.load(nil)
 	}
 	if w.ButtonText("Set") {
+		dv.wasRead = false
+		dv.history = nil
 		dv.load(nil)
 	}
-	if dv.v != nil {
+	detailViewers.mu.Lock()
+	liveChanged := w.CheckboxText("Live", &dv.live)
+	detailViewers.mu.Unlock()
+	if liveChanged && dv.live {
+		dv.load(nil)
+	}
+	if dv.v != nil && (dv.v.Kind == reflect.String || dv.v.Kind == reflect.Array || dv.v.Kind == reflect.Slice) {
 		if w.PropertyInt("Length:", 1, &dv.len, int(dv.v.Len), 16, 16) {
 			dv.load(nil)
 		}
@@ -270,12 +427,12 @@ func (dv *detailViewer) Update(container *nucular.Window) {
 
 	if dv.loadErr != nil {
 		w.Row(30).Dynamic(1)
-		w.Label(dv.loadErr.Error(), "LC")
+		dv.errorBanner(w, dv.loadErr.Error())
 		return
 	}
 	if dv.v.Unreadable != "" {
 		w.Row(30).Dynamic(1)
-		w.Label(fmt.Sprintf("Unreadable %s", dv.v.Unreadable), "LC")
+		dv.errorBanner(w, fmt.Sprintf("Unreadable %s", dv.v.Unreadable))
 		return
 	}
 
@@ -283,14 +440,151 @@ func (dv *detailViewer) Update(container *nucular.Window) {
 	w.Label("Showing: ", "LC")
 	w.Label(dv.loaded, "LC")
 
+	if _, ok := numericValue(dv.v.Variable); ok && len(dv.history) > 0 {
+		dv.historyUpdate(w)
+	}
+
 	switch dv.v.Type {
 	case "string", "[]uint8", "[]int32":
 		dv.stringUpdate(w)
 	case "[]int", "[]int8", "[]int16", "[]int64", "[]uint", "[]uint16", "[]uint32", "[]uint64":
 		dv.intArrayUpdate(w)
+	case "[]float32", "[]float64":
+		dv.floatArrayUpdate(w)
 	default:
-		w.Row(30).Dynamic(1)
-		w.Label(fmt.Sprintf("Unsupported type %s", dv.v.Type), "LC")
+		if isMatrixType(dv.v.Type) {
+			dv.matrixUpdate(w)
+			return
+		}
+		w.Row(0).Dynamic(1)
+		if w := w.GroupBegin("details-tree", 0); w != nil {
+			showVariable(w, 0, false, false, -1, dv.v)
+			w.GroupEnd()
+		}
+	}
+}
+
+// errorBanner shows msg, highlighting it if the expression was evaluated
+// successfully before and stopped resolving while stepping.
+func (dv *detailViewer) errorBanner(w *nucular.Window, msg string) {
+	if !dv.wasRead {
+		w.Label(msg, "LC")
+		return
+	}
+	w.LabelColored(fmt.Sprintf("Expression no longer resolves: %s", msg), "LC", color.RGBA{0xff, 0x00, 0x00, 0xff})
+}
+
+// historyUpdate draws a sparkline of the values that a numeric expression
+// had at the last stops.
+func (dv *detailViewer) historyUpdate(w *nucular.Window) {
+	min, max, _, _ := floatStats(dv.history)
+	w.Row(30).Static(100, 0, 250)
+	w.Label("History: ", "LC")
+	bounds, out := w.Custom(nstyle.WidgetStateInactive)
+	if out != nil {
+		strokePlot(w, bounds, out, dv.history, min, max)
+	}
+	w.Label(fmt.Sprintf("%d stops, min: %g max: %g", len(dv.history), min, max), "LC")
+}
+
+// numericValue returns the value of v as a float64 if v is a number.
+func numericValue(v *api.Variable) (float64, bool) {
+	if v == nil || v.Unreadable != "" {
+		return 0, false
+	}
+	switch v.Kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr, reflect.Float32, reflect.Float64:
+		x, err := strconv.ParseFloat(v.Value, 64)
+		return x, err == nil
+	}
+	return 0, false
+}
+
+// appendHistory appends x to history, dropping the oldest values so that
+// at most n are kept.
+func appendHistory(history []float64, x float64, n int) []float64 {
+	history = append(history, x)
+	if len(history) > n {
+		history = append(history[:0], history[len(history)-n:]...)
+	}
+	return history
+}
+
+// matrixUpdate shows a two dimensional array or slice as a grid, more rows
+// (or columns) are loaded when the end of the grid (or of a row) becomes
+// visible.
+func (dv *detailViewer) matrixUpdate(w *nucular.Window) {
+	dv.mu.Lock()
+	defer dv.mu.Unlock()
+
+	w.Row(20).Static(100, 100)
+	w.Label("View as:", "LC")
+	mode := 0
+	if dv.matrixTree {
+		mode = 1
+	}
+	dv.matrixTree = w.ComboSimple([]string{"grid", "tree"}, mode, 20) == 1
+
+	w.Row(0).Dynamic(1)
+	if dv.matrixTree {
+		if w := w.GroupBegin("details-tree", 0); w != nil {
+			showVariable(w, 0, false, false, -1, dv.v)
+			w.GroupEnd()
+		}
+		return
+	}
+
+	w = w.GroupBegin("details-grid", 0)
+	if w == nil {
+		return
+	}
+	defer w.GroupEnd()
+
+	style := w.Master().Style()
+	pad := 2 * style.Text.Padding.X
+	idxw := nucular.FontWidth(style.Font, fmt.Sprintf("[%d]", dv.v.Len)) + pad
+	cellw := nucular.FontWidth(style.Font, "0")*dv.matrixCellLen + pad
+
+	ncols := 0
+	for _, row := range dv.v.Children {
+		if len(row.Children) > ncols {
+			ncols = len(row.Children)
+		}
+	}
+
+	w.Row(varRowHeight).Static()
+	w.LayoutSetWidthScaled(idxw)
+	w.Spacing(1)
+	for j := 0; j < ncols; j++ {
+		w.LayoutSetWidthScaled(cellw)
+		w.Label(fmt.Sprintf("[%d]", j), "RC")
+	}
+
+	for i, row := range dv.v.Children {
+		w.Row(varRowHeight).Static()
+		w.LayoutSetWidthScaled(idxw)
+		w.Label(fmt.Sprintf("[%d]", i), "LC")
+		for _, cell := range row.Children {
+			w.LayoutSetWidthScaled(cellw)
+			w.Label(matrixCellValue(cell), "RC")
+		}
+		if int(row.Len) > len(row.Children) {
+			w.LayoutSetWidthScaled(cellw)
+			if bounds, out := w.Custom(nstyle.WidgetStateInactive); out != nil {
+				// the end of the row is visible, load more columns
+				out.DrawText(bounds, "...", style.Font, style.Text.Color)
+				go dv.loadMoreOf(row)
+			}
+		}
+	}
+
+	if len(dv.v.Children) < int(dv.v.Len) {
+		w.Row(varRowHeight).Dynamic(1)
+		if bounds, out := w.Custom(nstyle.WidgetStateInactive); out != nil {
+			// the last row is visible, load more
+			out.DrawText(bounds, "Loading...", style.Font, style.Text.Color)
+			go dv.loadMore()
+		}
 	}
 }
 
@@ -336,31 +630,45 @@ func (dv *detailViewer) length() int {
 }
 
 func (dv *detailViewer) loadMore() {
+	dv.loadMoreOf(dv.v)
+}
+
+// loadMoreOf loads more of the contents of v, which is either the variable
+// shown by dv or one of the rows of a two dimensional array.
+func (dv *detailViewer) loadMoreOf(v *Variable) {
 	additionalLoadMu.Lock()
 	defer additionalLoadMu.Unlock()
 	if !additionalLoadRunning {
 		additionalLoadRunning = true
 		go func() {
-			expr := fmt.Sprintf("(*(*%q)(%#x))[%d:]", dv.v.RealType, dv.v.Addr, dv.length())
+			dv.mu.Lock()
+			loaded := len(v.Children)
+			if v.Kind == reflect.String {
+				loaded = len(v.Value)
+			}
+			expr := fmt.Sprintf("(*(*%q)(%#x))[%d:]", v.RealType, v.Addr, loaded)
+			dv.mu.Unlock()
 			lv, err := client.EvalVariable(currentEvalScope(), expr, LongArrayLoadConfig)
+			dv.mu.Lock()
 			if err != nil {
 				out := editorWriter{&scrollbackEditor, true}
-				fmt.Fprintf(&out, "Error loading string contents %s: %v\n", expr, err)
+				fmt.Fprintf(&out, "Error loading contents %s: %v\n", expr, err)
+				// prevent further attempts at loading
+				v.Len = int64(loaded)
 			} else {
-				switch dv.v.Kind {
+				switch v.Kind {
 				case reflect.String:
-					dv.v.Width = 0
-					dv.v.Value += lv.Value
+					v.Width = 0
+					v.Value += lv.Value
 				case reflect.Array, reflect.Slice:
-					dv.v.Children = append(dv.v.Children, wrapApiVariables(lv.Children, dv.v.Kind, len(dv.v.Children), dv.v.Expression, true)...)
+					v.Children = append(v.Children, wrapApiVariables(lv.Children, v.Kind, len(v.Children), v.Expression, true)...)
 				}
 			}
+			dv.setupView()
+			dv.mu.Unlock()
 			additionalLoadMu.Lock()
 			additionalLoadRunning = false
 			additionalLoadMu.Unlock()
-			dv.mu.Lock()
-			dv.setupView()
-			dv.mu.Unlock()
 			wnd.Changed()
 		}()
 	}
@@ -371,7 +679,7 @@ func (dv *detailViewer) intArrayUpdate(w *nucular.Window) {
 		dv.setupView()
 	}
 
-	w.Row(20).Static(100, 120, 120, 120)
+	w.Row(20).Static(100, 120, 120, 120, 120)
 	w.Label("View as:", "LC")
 	mode := dv.numberMode
 	if w.OptionText("Decimal", mode == decMode) {
@@ -388,29 +696,207 @@ func (dv *detailViewer) intArrayUpdate(w *nucular.Window) {
 		dv.setupView()
 	}
 
+	w.CheckboxText("Plot", &dv.plot)
+
+	dv.plotOrEdit(w)
+}
+
+func (dv *detailViewer) floatArrayUpdate(w *nucular.Window) {
+	if dv.len != len(dv.v.Children) {
+		dv.setupView()
+	}
+
+	w.Row(20).Static(100, 120)
+	w.Label("View as:", "LC")
+	w.CheckboxText("Plot", &dv.plot)
+
+	dv.plotOrEdit(w)
+}
+
+func (dv *detailViewer) plotOrEdit(w *nucular.Window) {
+	if !dv.plot {
+		w.Row(0).Dynamic(1)
+		dv.ed.Edit(w)
+		return
+	}
+
+	values := make([]float64, len(dv.v.Children))
+	for i := range dv.v.Children {
+		var err error
+		values[i], err = strconv.ParseFloat(dv.v.Children[i].Variable.Value, 64)
+		if err != nil {
+			values[i] = math.NaN()
+		}
+	}
+	plotValues(w, values)
+}
+
+// floatStats returns the minimum, maximum and mean of the finite values in
+// values and the number of values that are NaN or infinite.
+func floatStats(values []float64) (min, max, mean float64, nonfinite int) {
+	n := 0
+	for _, x := range values {
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			nonfinite++
+			continue
+		}
+		if n == 0 || x < min {
+			min = x
+		}
+		if n == 0 || x > max {
+			max = x
+		}
+		mean += x
+		n++
+	}
+	if n > 0 {
+		mean /= float64(n)
+	}
+	return min, max, mean, nonfinite
+}
+
+// plotValues draws a line plot of values. NaN values interrupt the line and
+// are marked with a vertical line, infinite values are marked at the top
+// (+Inf) or bottom (-Inf) of the plot.
+func plotValues(w *nucular.Window, values []float64) {
+	min, max, mean, nonfinite := floatStats(values)
+	w.Row(20).Dynamic(1)
+	if nonfinite > 0 {
+		w.Label(fmt.Sprintf("min: %g max: %g mean: %g (%d NaN or infinite values)", min, max, mean, nonfinite), "LC")
+	} else {
+		w.Label(fmt.Sprintf("min: %g max: %g mean: %g", min, max, mean), "LC")
+	}
+
 	w.Row(0).Dynamic(1)
-	dv.ed.Edit(w)
+	bounds, out := w.Custom(nstyle.WidgetStateInactive)
+	if out == nil {
+		return
+	}
+	strokePlot(w, bounds, out, values, min, max)
+}
+
+// strokePlot draws the line plot of values inside bounds, min and max are
+// the smallest and largest finite values.
+func strokePlot(w *nucular.Window, bounds rect.Rect, out *ncommand.Buffer, values []float64, min, max float64) {
+	if len(values) == 0 {
+		return
+	}
+	style := w.Master().Style()
+
+	xof := func(i int) int {
+		if len(values) == 1 {
+			return bounds.X + bounds.W/2
+		}
+		return bounds.X + i*(bounds.W-1)/(len(values)-1)
+	}
+	yof := func(x float64) int {
+		if max == min {
+			return bounds.Y + bounds.H/2
+		}
+		return bounds.Y + bounds.H - 1 - int((x-min)/(max-min)*float64(bounds.H-1))
+	}
+
+	if min < 0 && max > 0 {
+		y := yof(0)
+		out.StrokeLine(image.Point{bounds.X, y}, image.Point{bounds.X + bounds.W, y}, 1, style.Tab.Background.Data.Color)
+	}
+
+	var prev image.Point
+	prevok := false
+	for i, x := range values {
+		switch {
+		case math.IsNaN(x):
+			out.StrokeLine(image.Point{xof(i), bounds.Y}, image.Point{xof(i), bounds.Y + bounds.H}, 1, specialFloatColor)
+			prevok = false
+		case math.IsInf(x, 0):
+			y := bounds.Y
+			if x < 0 {
+				y = bounds.Y + bounds.H - 3
+			}
+			out.FillRect(rect.Rect{X: xof(i) - 1, Y: y, W: 3, H: 3}, 0, specialFloatColor)
+			prevok = false
+		default:
+			p := image.Point{xof(i), yof(x)}
+			if prevok {
+				out.StrokeLine(prev, p, 1, style.Text.Color)
+			} else {
+				out.FillRect(rect.Rect{X: p.X, Y: p.Y, W: 1, H: 1}, 0, style.Text.Color)
+			}
+			prev, prevok = p, true
+		}
+	}
 }
 
 type floatViewer struct {
 	v  *Variable
 	ed nucular.TextEditor
+
+	notation int
+	prec     int
 }
 
+// floatNotations are the notations that can be chosen in the float viewer,
+// with their formatting verbs.
+var floatNotations = []string{"Default", "Fixed", "Scientific", "Hexadecimal"}
+var floatNotationVerbs = []byte{'g', 'f', 'e', 'x'}
+
+var floatFmtRe = regexp.MustCompile(`^%(?:\.(\d+))?([gfex])$`)
+
 func newFloatViewer(w *nucular.Window, v *Variable) {
-	vw := &floatViewer{v: v}
+	vw := &floatViewer{v: v, prec: -1}
 	vw.ed.Flags = nucular.EditSelectable | nucular.EditClipboard | nucular.EditSigEnter
 	vw.ed.Buffer = []rune(v.FloatFmt)
+	vw.parseFormat()
 	w.Master().PopupOpen(fmt.Sprintf("Format %s", v.Name), dynamicPopupFlags|nucular.WindowClosable, rect.Rect{20, 100, 480, 500}, true, vw.Update)
 }
 
+// parseFormat sets notation and precision from the format string, if it
+// is one that could have been produced by them.
+func (vw *floatViewer) parseFormat() {
+	m := floatFmtRe.FindStringSubmatch(string(vw.ed.Buffer))
+	if m == nil {
+		return
+	}
+	vw.prec = -1
+	if m[1] != "" {
+		vw.prec, _ = strconv.Atoi(m[1])
+	}
+	for i := range floatNotationVerbs {
+		if floatNotationVerbs[i] == m[2][0] {
+			vw.notation = i
+		}
+	}
+}
+
 func (vw *floatViewer) Update(w *nucular.Window) {
 	w.Row(30).Static(100, 0)
 	w.Label("Value:", "LC")
 	w.Label(vw.v.Value, "LC")
+
+	notation, prec := vw.notation, vw.prec
+	w.Row(30).Static(100, 150, 150)
+	w.Label("Notation:", "LC")
+	notation = w.ComboSimple(floatNotations, notation, 20)
+	w.PropertyInt("Precision:", -1, &prec, 64, 1, 1)
+	if notation != vw.notation || prec != vw.prec {
+		vw.notation, vw.prec = notation, prec
+		switch {
+		case vw.notation == 0 && vw.prec < 0:
+			vw.ed.Buffer = vw.ed.Buffer[:0]
+		case vw.prec < 0:
+			vw.ed.Buffer = []rune(fmt.Sprintf("%%%c", floatNotationVerbs[vw.notation]))
+		default:
+			vw.ed.Buffer = []rune(fmt.Sprintf("%%.%d%c", vw.prec, floatNotationVerbs[vw.notation]))
+		}
+		vw.ed.Cursor = len(vw.ed.Buffer)
+	}
+
+	w.Row(30).Static(100, 0)
 	w.Label("Format:", "LC")
 	if ev := vw.ed.Edit(w); ev&nucular.EditCommitted != 0 {
 		w.Close()
+	} else if ev&nucular.EditActive != 0 {
+		vw.parseFormat()
 	}
 	if newfmt := string(vw.ed.Buffer); newfmt != vw.v.FloatFmt {
 		vw.v.FloatFmt = newfmt
@@ -441,6 +927,29 @@ var intFormatter = map[numberMode]formatterFn{
 		n, _ := strconv.ParseInt(v.Variable.Value, 10, 64)
 		v.Value = fmt.Sprintf("%#o", n)
 	},
+	binMode: func(v *Variable) {
+		v.IntMode = binMode
+		n, _ := strconv.ParseInt(v.Variable.Value, 10, 64)
+		if n < 0 {
+			v.Value = "-" + formatBinary(uint64(-n))
+		} else {
+			v.Value = formatBinary(uint64(n))
+		}
+	},
+	hexTwosComplementMode: func(v *Variable) {
+		v.IntMode = hexTwosComplementMode
+		n, _ := strconv.ParseInt(v.Variable.Value, 10, 64)
+		v.Value = fmt.Sprintf("%#x", twosComplement(n, v.Kind, int(atomic.LoadInt32(&targetIntSize))))
+	},
+	durationMode: func(v *Variable) {
+		v.IntMode = durationMode
+		n, err := strconv.ParseInt(v.Variable.Value, 10, 64)
+		if err != nil {
+			v.Value = v.Variable.Value
+			return
+		}
+		v.Value = time.Duration(n).String()
+	},
 }
 
 var uintFormatter = map[numberMode]formatterFn{
@@ -458,6 +967,59 @@ var uintFormatter = map[numberMode]formatterFn{
 		n, _ := strconv.ParseUint(v.Variable.Value, 10, 64)
 		v.Value = fmt.Sprintf("%#o", n)
 	},
+	binMode: func(v *Variable) {
+		v.IntMode = binMode
+		n, _ := strconv.ParseUint(v.Variable.Value, 10, 64)
+		v.Value = formatBinary(n)
+	},
+}
+
+// formatBinary formats n in base 2 with digits grouped in nibbles, for
+// example 0b1010_0110.
+func formatBinary(n uint64) string {
+	s := strconv.FormatUint(n, 2)
+	var buf bytes.Buffer
+	buf.WriteString("0b")
+	for i := range s {
+		if i > 0 && (len(s)-i)%4 == 0 {
+			buf.WriteByte('_')
+		}
+		buf.WriteByte(s[i])
+	}
+	return buf.String()
+}
+
+// twosComplement returns the two's complement representation of n as a
+// signed integer of the given kind, intSize is the size in bytes of int on
+// the target (0 if unknown, in which case 8 is assumed).
+func twosComplement(n int64, kind reflect.Kind, intSize int) uint64 {
+	var bits uint
+	switch kind {
+	case reflect.Int8:
+		bits = 8
+	case reflect.Int16:
+		bits = 16
+	case reflect.Int32:
+		bits = 32
+	case reflect.Int:
+		if intSize <= 0 || intSize >= 8 {
+			return uint64(n)
+		}
+		bits = uint(intSize) * 8
+	default:
+		return uint64(n)
+	}
+	return uint64(n) & (1<<bits - 1)
+}
+
+// loadTargetIntSize determines the size of int on the target.
+func loadTargetIntSize() {
+	_, sz, err := typeLayout("int")
+	if err != nil {
+		atomic.StoreInt32(&targetIntSize, 0)
+		return
+	}
+	atomic.StoreInt32(&targetIntSize, int32(sz))
 }
 
 func floatFormatter(format string) formatterFn {
@@ -493,7 +1055,9 @@ func (vw *customFmtMaker) Update(w *nucular.Window) {
 	w.Label(fmt.Sprintf("Format string for all variables x of type %s", vw.v.Type), "LC")
 
 	w.Row(30).Dynamic(1)
-	w.Label("Starlark script (current variable is bound to 'x'):", "LC")
+	w.Label("Starlark expression (current variable is bound to 'x'):", "LC")
+	w.Row(30).Dynamic(1)
+	w.Label("or script defining 'def format(x):' that returns a string", "LC")
 
 	w.RowScaled(nucular.FontHeight(w.Master().Style().Font) * 7).Dynamic(1)
 	vw.ed.Edit(w)
@@ -522,10 +1086,23 @@ func newCustomFormatter(fmtstr string) *CustomFormatter {
 	return &CustomFormatter{Fmtstr: fmtstr, IsStarlark: true}
 }
 
+// customFormatterFnName is the name of the function called by custom
+// formatters written as starlark scripts, rather than expressions.
+const customFormatterFnName = "format"
+
+var customFormatterFnRe = regexp.MustCompile(`(?m)^def\s+` + customFormatterFnName + `\s*\(`)
+
 func (c *CustomFormatter) Format(v *Variable) {
-	sv, err := StarlarkEnv.Execute(&editorWriter{&scrollbackEditor, true}, "<expr>", c.Fmtstr, "<expr>", nil, v.Variable)
+	var sv starlark.Value
+	var err error
+	out := &editorWriter{&scrollbackEditor, true}
+	if customFormatterFnRe.MatchString(c.Fmtstr) {
+		sv, err = StarlarkEnv.Execute(out, "<formatter>", c.Fmtstr, customFormatterFnName, []interface{}{StarlarkEnv.VariableValue(v.Variable)}, v.Variable)
+	} else {
+		sv, err = StarlarkEnv.Execute(out, "<expr>", c.Fmtstr, "<expr>", nil, v.Variable)
+	}
 	if err != nil {
-		v.Value = fmt.Sprintf("custom formatter error: %v", err)
+		v.Value = fmt.Sprintf("(formatter error: %v)", err)
 		return
 	}
 	switch sv := sv.(type) {
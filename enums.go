@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/aarzilli/gdlv/internal/dlvclient/service/api"
+)
+
+// enumCache maps a type name to a map from the values of the constants of
+// that type to their names. A nil map means the type has no constants (or
+// they could not be found).
+var enumCache = struct {
+	mu  sync.Mutex
+	m   map[string]map[string]string
+	gen int // incremented every time the cache is cleared
+}{m: make(map[string]map[string]string)}
+
+func clearEnumCache() {
+	enumCache.mu.Lock()
+	enumCache.m = make(map[string]map[string]string)
+	enumCache.gen++
+	enumCache.mu.Unlock()
+}
+
+func isIntegerKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+// enumName returns the name of the constant of v's type that has the same
+// value as v, if there is one.
+func enumName(v *api.Variable) string {
+	if !isIntegerKind(v.Kind) || v.Unreadable != "" || !strings.Contains(v.Type, ".") {
+		return ""
+	}
+	enumCache.mu.Lock()
+	gen := enumCache.gen
+	consts, ok := enumCache.m[v.Type]
+	enumCache.mu.Unlock()
+	if !ok {
+		// loading requires several requests to the backend, it is done
+		// without holding the lock so that other variables can be wrapped
+		// in the meantime.
+		consts = loadEnumConsts(v.Type)
+		enumCache.mu.Lock()
+		if enumCache.gen == gen {
+			enumCache.m[v.Type] = consts
+		}
+		enumCache.mu.Unlock()
+	}
+	return consts[v.Value]
+}
+
+// loadEnumConsts finds the constants of type typ by parsing the source of
+// the package declaring it and evaluating each of them.
+func loadEnumConsts(typ string) map[string]string {
+	dot := strings.LastIndex(typ, ".")
+	pkg, typname := typ[:dot], typ[dot+1:]
+	if e, err := parser.ParseExpr(typname); err != nil || !isIdent(e) || strings.ContainsAny(pkg, "*[]() ") {
+		return nil
+	}
+
+	// find a source file of the package through one of its functions
+	fns, err := client.ListFunctions("^" + regexp.QuoteMeta(pkg) + `\.`)
+	if err != nil || len(fns) == 0 {
+		return nil
+	}
+	locs, err := client.FindLocation(api.EvalScope{-1, 0, 0}, fns[0])
+	if err != nil || len(locs) == 0 || locs[0].File == "" {
+		return nil
+	}
+	file := conf.substitutePath(locs[0].File)
+
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, filepath.Dir(file), nil, 0)
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, p := range pkgs {
+		if p.Files[file] == nil {
+			continue
+		}
+		for _, f := range p.Files {
+			names = append(names, enumConstNames(f, typname)...)
+		}
+	}
+
+	pkgexpr := pkg
+	if strings.ContainsAny(pkg, "./") {
+		pkgexpr = fmt.Sprintf("%q", pkg)
+	}
+
+	var r map[string]string
+	for _, name := range names {
+		cv, err := client.EvalVariable(api.EvalScope{-1, 0, 0}, pkgexpr+"."+name, api.LoadConfig{})
+		if err != nil || cv.Unreadable != "" {
+			continue
+		}
+		value := cv.Value
+		if i := strings.LastIndex(value, "("); i >= 0 && strings.HasSuffix(value, ")") {
+			// the backend may already decorate constants as "Name (value)"
+			value = value[i+1 : len(value)-1]
+		}
+		if r == nil {
+			r = make(map[string]string)
+		}
+		if _, dup := r[value]; !dup {
+			r[value] = name
+		}
+	}
+	return r
+}
+
+// enumConstNames returns the names of the constants of type typname
+// declared in f. Both explicitly typed constants and constants repeating an
+// implicit type (as in iota blocks) are returned, as well as constants
+// initialized with a conversion to typname.
+func enumConstNames(f *ast.File, typname string) []string {
+	var r []string
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.CONST {
+			continue
+		}
+		var typ ast.Expr
+		for _, spec := range gd.Specs {
+			vs := spec.(*ast.ValueSpec)
+			if vs.Type != nil || len(vs.Values) > 0 {
+				typ = vs.Type
+				if typ == nil && len(vs.Values) == 1 {
+					if call, ok := vs.Values[0].(*ast.CallExpr); ok && len(call.Args) == 1 {
+						typ = call.Fun
+					}
+				}
+			}
+			if id, ok := typ.(*ast.Ident); !ok || id.Name != typname {
+				continue
+			}
+			for _, name := range vs.Names {
+				if name.Name != "_" {
+					r = append(r, name.Name)
+				}
+			}
+		}
+	}
+	return r
+}
@@ -11,8 +11,10 @@ import (
 	"os/exec"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/aarzilli/nucular"
 	"github.com/aarzilli/nucular/clipboard"
@@ -22,6 +24,7 @@ import (
 
 	"github.com/aarzilli/gdlv/internal/dlvclient/service/api"
 
+	"golang.org/x/mobile/event/key"
 	"golang.org/x/mobile/event/mouse"
 )
 
@@ -32,16 +35,37 @@ type asyncLoad struct {
 	err     error
 	load    func(*asyncLoad)
 	code    byte
+	// reload is set when the data is cleared while a load is in progress,
+	// the load is restarted once the one in progress finishes so that
+	// rapid successive clears only cause one more load.
+	reload bool
 }
 
 func (l *asyncLoad) clear() {
 	l.mu.Lock()
 	l.loaded = false
+	if l.loading {
+		l.reload = true
+	}
 	l.mu.Unlock()
 }
 
+// superseded returns true if the data being loaded was cleared after the
+// load started, loaders can use it to abandon a load early.
+func (l *asyncLoad) superseded() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.reload
+}
+
 func (l *asyncLoad) done(err error) {
 	l.mu.Lock()
+	if l.reload {
+		l.reload = false
+		l.mu.Unlock()
+		go l.load(l)
+		return
+	}
 	l.err = err
 	l.loading = false
 	l.loaded = true
@@ -125,7 +149,9 @@ var goroutinesPanel = struct {
 	onlyStopped       bool
 	id                int
 	limit             int
+	labelEditor       nucular.TextEditor
 }{
+	labelEditor:       nucular.TextEditor{Filter: spacefilter},
 	goroutineLocation: 1,
 	goroutines:        make([]wrappedGoroutine, 0, 10),
 	limit:             100,
@@ -139,6 +165,7 @@ var stackPanel = struct {
 	showDeferPos bool
 	id           int
 	deferID      int
+	copyFull     bool
 }{
 	depth: 50,
 }
@@ -266,6 +293,35 @@ func loadGoroutines(p *asyncLoad) {
 	p.done(nil)
 }
 
+// formatGoroutineLabels returns the pprof labels of a goroutine as a list
+// of key=value pairs sorted by key.
+func formatGoroutineLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		keys[i] = k + "=" + labels[k]
+	}
+	return strings.Join(keys, " ")
+}
+
+// goroutineHasLabel returns true if g has the label described by filter,
+// either "key=value" or "key" to match any value. An empty filter matches
+// all goroutines.
+func goroutineHasLabel(g *api.Goroutine, filter string) bool {
+	if filter == "" {
+		return true
+	}
+	key, val, hasVal := filter, "", false
+	if i := strings.Index(filter, "="); i >= 0 {
+		key, val, hasVal = filter[:i], filter[i+1:], true
+	}
+	v, ok := g.Labels[key]
+	return ok && (!hasVal || v == val)
+}
+
 func updateGoroutines(container *nucular.Window) {
 	w := goroutinesPanel.asyncLoad.showRequest(container)
 	if w == nil {
@@ -280,6 +336,10 @@ func updateGoroutines(container *nucular.Window) {
 	w.PropertyInt("Limit:", 1, &goroutinesPanel.limit, 1000000000, 1, 1)
 	goroutinesPanel.goroutineLocation = w.ComboSimple(goroutineLocations, goroutinesPanel.goroutineLocation, 22)
 	w.CheckboxText("Only stopped at breakpoint", &goroutinesPanel.onlyStopped)
+	w.Row(20).Static(90, 0)
+	w.Label("Label:", "LC")
+	goroutinesPanel.labelEditor.Edit(w)
+	labelFilter := string(goroutinesPanel.labelEditor.Buffer)
 	w.MenubarEnd()
 
 	d := 1
@@ -300,6 +360,9 @@ func updateGoroutines(container *nucular.Window) {
 		if goroutinesPanel.onlyStopped && !g.atBreakpoint {
 			continue
 		}
+		if !goroutineHasLabel(&g.Goroutine, labelFilter) {
+			continue
+		}
 		w.Row(posRowHeight).Static()
 		selected := curGid == g.ID
 
@@ -328,6 +391,11 @@ func updateGoroutines(container *nucular.Window) {
 			w.SelectableLabel(formatLocation2(g.StartLoc), "LT", &selected)
 		}
 
+		if len(g.Labels) > 0 {
+			w.LayoutFitWidth(goroutinesPanel.id, 100)
+			w.SelectableLabel(formatGoroutineLabels(g.Labels), "LT", &selected)
+		}
+
 		if selected && curGid != g.ID && !client.Running() {
 			go func(gid int) {
 				state, err := client.SwitchGoroutine(gid)
@@ -373,6 +441,27 @@ func loadStacktrace(p *asyncLoad) {
 	p.done(nil)
 }
 
+// copyStacktrace copies the stack of goroutine gid to the clipboard,
+// formatted like the output of the stack command. If full is set
+// arguments and local variables of each frame are included.
+func copyStacktrace(gid, depth int, full bool) {
+	out := editorWriter{&scrollbackEditor, true}
+	var cfg *api.LoadConfig
+	if full {
+		cfg = &ShortLoadConfig
+	}
+	stack, err := client.Stacktrace(gid, depth, false, cfg)
+	if err != nil {
+		fmt.Fprintf(&out, "Could not copy stack trace: %v\n", err)
+		return
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Goroutine %d:\n", gid)
+	printStack(&buf, stack, "")
+	clipboard.Set(buf.String())
+	fmt.Fprintf(&out, "Stack trace of goroutine %d copied to clipboard\n", gid)
+}
+
 func updateStacktrace(container *nucular.Window) {
 	w := stackPanel.asyncLoad.showRequest(container)
 	if w == nil {
@@ -380,13 +469,17 @@ func updateStacktrace(container *nucular.Window) {
 	}
 
 	w.MenubarBegin()
-	w.Row(20).Static(120)
+	w.Row(20).Static(120, 100, 120)
 	if w.PropertyInt("depth:", 1, &stackPanel.depth, 200, 1, 5) {
 		go func() {
 			stackPanel.asyncLoad.clear()
 			wnd.Changed()
 		}()
 	}
+	if w.ButtonText("Copy") {
+		go copyStacktrace(curGid, stackPanel.depth, stackPanel.copyFull)
+	}
+	w.CheckboxText("With locals", &stackPanel.copyFull)
 	w.MenubarEnd()
 
 	stack := stackPanel.stack
@@ -519,7 +612,7 @@ func updateThreads(container *nucular.Window) {
 
 func loadRegs(p *asyncLoad) {
 	regs, err := client.ListRegisters(0, regsPanel.allRegs)
-	regsPanel.regs = expandTabs(regs.String())
+	regsPanel.regs = expandTabs(formatRegisters(regs))
 	regsPanel.lines = 1
 	lineStart := 0
 	maxline := 0
@@ -536,6 +629,28 @@ func loadRegs(p *asyncLoad) {
 	p.done(err)
 }
 
+// formatRegisters formats the list of registers one per line, the values
+// of vector registers (which contain several tab separated interpretations
+// of their contents) are split on multiple lines.
+func formatRegisters(regs api.Registers) string {
+	maxlen := 0
+	for _, reg := range regs {
+		if n := len(reg.Name); n > maxlen {
+			maxlen = n
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, reg := range regs {
+		parts := strings.Split(reg.Value, "\t")
+		fmt.Fprintf(&buf, "%*s = %s\n", maxlen, reg.Name, parts[0])
+		for _, part := range parts[1:] {
+			fmt.Fprintf(&buf, "%*s   %s\n", maxlen, "", part)
+		}
+	}
+	return buf.String()
+}
+
 func updateRegs(container *nucular.Window) {
 	w := regsPanel.asyncLoad.showRequest(container)
 	if w == nil {
@@ -543,10 +658,13 @@ func updateRegs(container *nucular.Window) {
 	}
 
 	w.MenubarBegin()
-	w.Row(varRowHeight).Static(100)
+	w.Row(varRowHeight).Static(100, 100)
 	if w.CheckboxText("Show All", &regsPanel.allRegs) {
 		loadRegs(&regsPanel.asyncLoad)
 	}
+	if w.ButtonText("Copy") {
+		clipboard.Set(regsPanel.regs)
+	}
 	w.MenubarEnd()
 
 	w.Row(20 * regsPanel.lines).Static(regsPanel.width)
@@ -605,6 +723,16 @@ func updateBreakpoints(container *nucular.Window) {
 			name += " "
 		}
 
+		w.LayoutSetWidth(20)
+		enabled := breakpoint.enabled
+		if w.CheckboxText("", &enabled) && !client.Running() {
+			if enabled {
+				go enableBreakpoint(breakpoint.Breakpoint)
+			} else {
+				go disableBreakpoint(breakpoint.Breakpoint)
+			}
+		}
+
 		w.LayoutFitWidth(breakpointsPanel.id, 100)
 		w.SelectableLabel(fmt.Sprintf("%s%s%s (hit count: %d)\nat %s:%d (%#v)", disableMark, name, breakpoint.FunctionName, breakpoint.TotalHitCount, breakpoint.File, breakpoint.Line, breakpoint.Addr), "LT", &selected)
 
@@ -631,6 +759,9 @@ func updateBreakpoints(container *nucular.Window) {
 					if w.MenuItem(label.TA("Disable", "LC")) {
 						go disableBreakpoint(breakpoint.Breakpoint)
 					}
+					if w.MenuItem(label.TA("Reset hit counts", "LC")) {
+						go resetHitCounts(breakpoint.Breakpoint)
+					}
 				} else {
 					if w.MenuItem(label.TA("Enable", "LC")) {
 						go enableBreakpoint(breakpoint.Breakpoint)
@@ -649,7 +780,9 @@ func updateBreakpoints(container *nucular.Window) {
 							_, err := client.ClearBreakpoint(bp.ID)
 							if err != nil {
 								fmt.Fprintf(&scrollbackOut, "Could not clear breakpoint %d: %v\n", bp.ID, err)
+								continue
 							}
+							forgetBreakpoint(bp.ID)
 						}
 						FrozenBreakpoints = nil
 						DisabledBreakpoints = nil
@@ -665,6 +798,71 @@ func updateBreakpoints(container *nucular.Window) {
 				go refreshState(refreshToSameFrame, clearNothing, nil)
 			}
 		}
+
+		if breakpoint.enabled && breakpointsPanel.selected == breakpoint.ID {
+			showHitCountHistogram(w, breakpoint.Breakpoint)
+		}
+	}
+}
+
+// goroutineHits is the number of times a goroutine hit a breakpoint.
+type goroutineHits struct {
+	gid  string
+	hits uint64
+}
+
+// sortedHitCounts returns the hit counts of a breakpoint sorted by
+// decreasing number of hits.
+func sortedHitCounts(hitCount map[string]uint64) []goroutineHits {
+	r := make([]goroutineHits, 0, len(hitCount))
+	for gid, hits := range hitCount {
+		r = append(r, goroutineHits{gid, hits})
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].hits != r[j].hits {
+			return r[i].hits > r[j].hits
+		}
+		gi, _ := strconv.Atoi(r[i].gid)
+		gj, _ := strconv.Atoi(r[j].gid)
+		return gi < gj
+	})
+	return r
+}
+
+const maxHistogramGoroutines = 10
+
+// showHitCountHistogram shows the goroutines that hit bp most often, each
+// with a bar proportional to its number of hits.
+func showHitCountHistogram(w *nucular.Window, bp *api.Breakpoint) {
+	hits := sortedHitCounts(bp.HitCount)
+	if len(hits) == 0 {
+		return
+	}
+	style := w.Master().Style()
+	more := 0
+	if len(hits) > maxHistogramGoroutines {
+		more = len(hits) - maxHistogramGoroutines
+		hits = hits[:maxHistogramGoroutines]
+	}
+	for _, h := range hits {
+		w.Row(posRowHeight/2).Static(20, 120, 150, 60)
+		w.Spacing(1)
+		w.Label(fmt.Sprintf("goroutine %s", h.gid), "LC")
+		if bounds, out := w.Custom(nstyle.WidgetStateInactive); out != nil {
+			bounds.W = int(float64(bounds.W) * float64(h.hits) / float64(hits[0].hits))
+			if bounds.W < 1 {
+				bounds.W = 1
+			}
+			bounds.Y += bounds.H / 4
+			bounds.H /= 2
+			out.FillRect(bounds, 0, style.Text.Color)
+		}
+		w.Label(fmt.Sprintf("%d", h.hits), "LC")
+	}
+	if more > 0 {
+		w.Row(posRowHeight/2).Static(20, 300)
+		w.Spacing(1)
+		w.Label(fmt.Sprintf("%d more goroutines", more), "LC")
 	}
 }
 
@@ -680,6 +878,8 @@ func execClearBreakpoint(id int) {
 	bp, err := client.ClearBreakpoint(id)
 	if err != nil {
 		fmt.Fprintf(&scrollbackOut, "Could not clear breakpoint %d: %v\n", id, err)
+	} else {
+		forgetBreakpoint(id)
 	}
 	removeFrozenBreakpoint(bp)
 	refreshState(refreshToSameFrame, clearBreakpoint, nil)
@@ -708,9 +908,10 @@ func execClearCheckpoint(id int) {
 }
 
 type breakpointEditor struct {
-	bp          *api.Breakpoint
-	printEditor nucular.TextEditor
-	condEditor  nucular.TextEditor
+	bp             *api.Breakpoint
+	printEditor    nucular.TextEditor
+	condEditor     nucular.TextEditor
+	prevCondEditor nucular.TextEditor
 }
 
 func openBreakpointEditor(mw nucular.MasterWindow, bp *api.Breakpoint) {
@@ -725,6 +926,11 @@ func openBreakpointEditor(mw nucular.MasterWindow, bp *api.Breakpoint) {
 	ed.condEditor.Flags = nucular.EditClipboard | nucular.EditSelectable
 	ed.condEditor.Buffer = []rune(ed.bp.Cond)
 
+	ed.prevCondEditor.Flags = nucular.EditClipboard | nucular.EditSelectable
+	if pc := prevConditions[bp.ID]; pc != nil {
+		ed.prevCondEditor.Buffer = []rune(pc.Cond)
+	}
+
 	mw.PopupOpen(fmt.Sprintf("Editing breakpoint %d", breakpointsPanel.selected), dynamicPopupFlags, rect.Rect{100, 100, 400, 700}, true, ed.update)
 }
 
@@ -789,6 +995,12 @@ func (bped *breakpointEditor) update(w *nucular.Window) {
 	w.Label("Condition:", "LC")
 	bped.condEditor.Edit(w)
 
+	w.Row(30).Static(100, 0)
+	w.Label("gdlv condition:", "LC")
+	bped.prevCondEditor.Edit(w)
+	w.Row(20).Dynamic(1)
+	w.Label("Evaluated by gdlv, use prev(expr) for the value of expr at the previous hit", "LC")
+
 	w.Row(20).Static(0, 80, 80)
 	w.Spacing(1)
 	if w.ButtonText("Cancel") {
@@ -797,6 +1009,10 @@ func (bped *breakpointEditor) update(w *nucular.Window) {
 	}
 	if w.ButtonText("OK") {
 		bped.bp.Cond = string(bped.condEditor.Buffer)
+		if err := setPrevCondition(bped.bp.ID, string(bped.prevCondEditor.Buffer)); err != nil {
+			scrollbackOut := editorWriter{&scrollbackEditor, true}
+			fmt.Fprintf(&scrollbackOut, "Invalid gdlv condition: %v\n", err)
+		}
 		bped.bp.Variables = bped.bp.Variables[:0]
 		for _, p := range strings.Split(string(bped.printEditor.Buffer), "\n") {
 			if p == "" {
@@ -979,6 +1195,61 @@ func (p *stringSlicePanel) update(container *nucular.Window) {
 	}
 }
 
+// historyPanel shows the command history, clicking an entry loads it in
+// the command line, double clicking executes it.
+var historyPanel = struct {
+	filterEditor nucular.TextEditor
+	lastClick    time.Time
+	lastClickIdx int
+}{lastClickIdx: -1}
+
+func updateHistory(container *nucular.Window) {
+	container.Row(0).Dynamic(1)
+	w := container.GroupBegin("history", 0)
+	if w == nil {
+		return
+	}
+	defer w.GroupEnd()
+
+	w.MenubarBegin()
+	w.Row(20).Static(90, 0)
+	w.Label("Filter:", "LC")
+	historyPanel.filterEditor.Edit(w)
+	w.MenubarEnd()
+
+	// while searching from the command line use the same needle
+	filter := string(historyPanel.filterEditor.Buffer)
+	if historySearch {
+		filter = historyNeedle
+	}
+
+	for i := len(cmdhistory) - 1; i >= 0; i-- {
+		cmd := cmdhistory[i]
+		if cmd == "" || strings.Index(cmd, filter) < 0 {
+			continue
+		}
+		w.Row(20).Dynamic(1)
+		selected := i == historyShown
+		if w.SelectableLabel(cmd, "LC", &selected) {
+			now := time.Now()
+			doubleClick := i == historyPanel.lastClickIdx && now.Sub(historyPanel.lastClick) < 500*time.Millisecond
+			historyPanel.lastClick, historyPanel.lastClickIdx = now, i
+			historySearch = false
+			historyShown = i
+			commandLineEditor.Buffer = []rune(cmd)
+			commandLineEditor.Cursor = len(commandLineEditor.Buffer)
+			commandLineEditor.CursorFollow = true
+			w.Master().ActivateEditor(&commandLineEditor)
+			if doubleClick && !client.Running() {
+				historyPanel.lastClickIdx = -1
+				commandLineEditor.Buffer = commandLineEditor.Buffer[:0]
+				commandLineEditor.Cursor = 0
+				submitCommandLine(currentPrompt(), cmd)
+			}
+		}
+	}
+}
+
 func funcInteraction(p *stringSlicePanel, w *nucular.Window, clicked bool, idx int) {
 	if clicked {
 		locs, err := client.FindLocation(currentEvalScope(), p.slice[p.selected])
@@ -1111,6 +1382,14 @@ func updateListingPanel(container *nucular.Window) {
 				gl.Center()
 				listingPanel.recenterListing = false
 			}
+		} else if line.lineno == listingPanel.cursorLine {
+			rowbounds := listp.WidgetBounds()
+			rowbounds.X = listp.Bounds.X
+			rowbounds.W = listp.Bounds.W
+
+			cursorColor := style.Selectable.PressedActive.Data.Color
+			darken(&cursorColor)
+			listp.Commands().FillRect(rowbounds, 0, cursorColor)
 		}
 
 		listp.LayoutSetWidth(starw)
@@ -1124,6 +1403,10 @@ func updateListingPanel(container *nucular.Window) {
 			iconFace, style.Font = style.Font, iconFace
 			listp.LabelColored(arrowIconChar, "CC", color.RGBA{0xff, 0xff, 0x00, 0xff})
 			iconFace, style.Font = style.Font, iconFace
+		} else if isBookmarked(listingPanel.file, line.lineno) {
+			iconFace, style.Font = style.Font, iconFace
+			listp.LabelColored(bookmarkIconChar, "CC", color.RGBA{0x40, 0x90, 0xff, 0xff})
+			iconFace, style.Font = style.Font, iconFace
 		} else {
 			listp.Spacing(1)
 		}
@@ -1134,6 +1417,14 @@ func updateListingPanel(container *nucular.Window) {
 		listp.Label(line.text, "LC")
 		textbounds := listp.LastWidgetBounds
 
+		if ann := listingPanel.annotations[line.lineno]; ann != "" && conf.InlineValues {
+			ann = "// " + ann
+			anncolor := style.Text.Color
+			darken(&anncolor)
+			listp.LayoutSetWidthScaled(nucular.FontWidth(style.Font, ann) + style.Text.Padding.X*2)
+			listp.LabelColored(ann, "LC", anncolor)
+		}
+
 		if centerline && listingPanel.recenterListing {
 			listingPanel.recenterListing = false
 			gl.Center()
@@ -1144,6 +1435,10 @@ func updateListingPanel(container *nucular.Window) {
 			ctxtbounds := bpbounds
 			ctxtbounds.W = (textbounds.X + textbounds.W) - ctxtbounds.X
 
+			if listp.Input().Mouse.Clicked(mouse.ButtonLeft, ctxtbounds) {
+				listingPanel.cursorLine = line.lineno
+			}
+
 			if listp.Input().Mouse.Clicked(mouse.ButtonMiddle, ctxtbounds) {
 				if line.bp != nil {
 					if line.bpenabled {
@@ -1189,6 +1484,18 @@ func updateListingPanel(container *nucular.Window) {
 					if w.MenuItem(label.TA("Set breakpoint", "LC")) {
 						go listingSetBreakpoint(listingPanel.file, line.lineno)
 					}
+					if w.MenuItem(label.TA("Set conditional breakpoint...", "LC")) {
+						openConditionalBreakpointPrompt(w.Master(), listingPanel.file, line.lineno)
+					}
+				}
+				if isBookmarked(listingPanel.file, line.lineno) {
+					if w.MenuItem(label.TA("Remove bookmark", "LC")) {
+						toggleBookmark(listingPanel.file, line.lineno)
+					}
+				} else {
+					if w.MenuItem(label.TA("Add bookmark", "LC")) {
+						toggleBookmark(listingPanel.file, line.lineno)
+					}
 				}
 				if isCurrentLine {
 					if listingPanel.stepIntoInfo.Valid {
@@ -1223,11 +1530,129 @@ func updateListingPanel(container *nucular.Window) {
 	}
 }
 
+// listingCursor returns the line of the listing panel last clicked by the
+// user or, if there isn't one, the pinned location.
+func listingCursor() (string, int, bool) {
+	if listingPanel.file != "" && listingPanel.cursorLine > 0 {
+		return listingPanel.file, listingPanel.cursorLine, true
+	}
+	if loc := listingPanel.pinnedLoc; loc != nil && loc.File != "" {
+		return loc.File, loc.Line, true
+	}
+	return "", 0, false
+}
+
+// listingCursorOrPC is like listingCursor but falls back to the current
+// line.
+func listingCursorOrPC() (string, int, bool) {
+	if file, lineno, ok := listingCursor(); ok {
+		return file, lineno, true
+	}
+	for _, line := range listingPanel.listing {
+		if line.pc {
+			return listingPanel.file, line.lineno, true
+		}
+	}
+	return "", 0, false
+}
+
+// toggleListingBreakpoint clears the breakpoint on the selected line of the
+// listing panel (or on the current line if no line is selected) or sets one
+// if there isn't one.
+func toggleListingBreakpoint() {
+	out := editorWriter{&scrollbackEditor, true}
+	file, lineno, ok := listingCursorOrPC()
+	if !ok {
+		fmt.Fprintf(&out, "No line selected\n")
+		return
+	}
+
+	if curThread < 0 {
+		spec := fmt.Sprintf("B%s:%d", file, lineno)
+		for i := range ScheduledBreakpoints {
+			if ScheduledBreakpoints[i] == spec {
+				ScheduledBreakpoints = append(ScheduledBreakpoints[:i], ScheduledBreakpoints[i+1:]...)
+				fmt.Fprintf(&out, "Breakpoint will no longer be set on restart\n")
+				return
+			}
+		}
+		ScheduledBreakpoints = append(ScheduledBreakpoints, spec)
+		fmt.Fprintf(&out, "Breakpoint will be set on restart\n")
+		return
+	}
+
+	for i := range DisabledBreakpoints {
+		if bp := &DisabledBreakpoints[i].Bp; bp.File == file && bp.Line == lineno {
+			execClearBreakpoint(bp.ID)
+			return
+		}
+	}
+	bps, err := client.ListBreakpoints()
+	if err != nil {
+		fmt.Fprintf(&out, "Could not list breakpoints: %v\n", err)
+		return
+	}
+	for _, bp := range bps {
+		if bp.ID >= 0 && bp.File == file && bp.Line == lineno {
+			if err := clear(&out, strconv.Itoa(bp.ID)); err != nil {
+				fmt.Fprintf(&out, "Could not clear breakpoint %d: %v\n", bp.ID, err)
+			}
+			refreshState(refreshToSameFrame, clearBreakpoint, nil)
+			return
+		}
+	}
+	listingSetBreakpoint(file, lineno)
+}
+
 func listingSetBreakpoint(file string, line int) {
-	setBreakpointEx(&editorWriter{&scrollbackEditor, true}, &api.Breakpoint{File: file, Line: line})
+	listingSetConditionalBreakpoint(file, line, "")
+}
+
+func listingSetConditionalBreakpoint(file string, line int, cond string) {
+	setBreakpointEx(&editorWriter{&scrollbackEditor, true}, &api.Breakpoint{File: file, Line: line, Cond: cond})
 	refreshState(refreshToSameFrame, clearBreakpoint, nil)
 }
 
+// openConditionalBreakpointPrompt asks for a condition and then creates a
+// breakpoint with it at the specified line.
+func openConditionalBreakpointPrompt(mw nucular.MasterWindow, file string, line int) {
+	var ed nucular.TextEditor
+	ed.Flags = nucular.EditClipboard | nucular.EditSelectable | nucular.EditSigEnter
+	ed.Active = true
+
+	mw.PopupOpen(fmt.Sprintf("Breakpoint at %s:%d", ShortenFilePath(file), line), dynamicPopupFlags, rect.Rect{100, 100, 400, 700}, true, func(w *nucular.Window) {
+		ok, cancel := false, false
+		for _, e := range w.Input().Keyboard.Keys {
+			if e.Code == key.CodeEscape {
+				cancel = true
+			}
+		}
+
+		w.Row(30).Static(100, 0)
+		w.Label("Condition:", "LC")
+		if ev := ed.Edit(w); ev&nucular.EditCommitted != 0 {
+			ok = true
+		}
+
+		w.Row(20).Static(0, 80, 80)
+		w.Spacing(1)
+		if w.ButtonText("Cancel") {
+			cancel = true
+		}
+		if w.ButtonText("OK") {
+			ok = true
+		}
+
+		switch {
+		case cancel:
+			w.Close()
+		case ok:
+			go listingSetConditionalBreakpoint(file, line, strings.TrimSpace(string(ed.Buffer)))
+			w.Close()
+		}
+	})
+}
+
 func updateDisassemblyPanel(container *nucular.Window) {
 	container = disassemblyPanel.asyncLoad.showRequest(container)
 	if container == nil {
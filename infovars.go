@@ -2,9 +2,14 @@ package main
 
 import (
 	"fmt"
+	"go/parser"
 	"image"
 	"image/color"
+	"math"
+	"math/big"
+	"math/bits"
 	"reflect"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -12,6 +17,8 @@ import (
 	"time"
 
 	"golang.org/x/image/font"
+	"golang.org/x/mobile/event/key"
+	"golang.org/x/mobile/event/mouse"
 
 	"github.com/aarzilli/nucular"
 	"github.com/aarzilli/nucular/clipboard"
@@ -29,6 +36,9 @@ const (
 	decMode numberMode = iota
 	hexMode
 	octMode
+	durationMode
+	hexTwosComplementMode
+	binMode
 )
 
 type Variable struct {
@@ -44,7 +54,18 @@ type Variable struct {
 	DisplayName string
 	Expression  string
 
+	// belowTypeLimits is true if v was loaded with smaller limits than
+	// the ones configured for its type.
+	belowTypeLimits bool
+
 	Children []*Variable
+
+	// rangeChildren contains the elements of an array or slice loaded with
+	// the index range editor.
+	rangeEd       *nucular.TextEditor
+	rangeChildren []*Variable
+
+	treeStateRestored bool
 }
 
 // SinglelineString returns a representation of v on a single line.
@@ -67,6 +88,8 @@ func wrapApiVariable(v *api.Variable, name, expr string, customFormatters bool)
 	r.Expression = expr
 	if f := varFormat[v.Addr]; f != nil {
 		f(r)
+	} else if f := varTypeFormat[v.Type]; f != nil && isIntegerKind(v.Kind) {
+		f(r)
 	} else if (v.Kind == reflect.Int || v.Kind == reflect.Uint) && ((v.Type == "uint8") || (v.Type == "int32")) {
 		n, _ := strconv.Atoi(v.Value)
 		if n >= ' ' && n <= '~' {
@@ -76,6 +99,18 @@ func wrapApiVariable(v *api.Variable, name, expr string, customFormatters bool)
 		f.Format(r)
 	} else if v.Type == "time.Time" {
 		r.Value = formatTime(v)
+	} else if v.Type == "time.Duration" {
+		intFormatter[durationMode](r)
+	} else if v.Type == "math/big.Int" {
+		r.Value = formatBigInt(v)
+	} else if v.Type == "math/big.Rat" {
+		r.Value = formatBigRat(v)
+	} else if v.Type == "math/big.Float" {
+		r.Value = formatBigFloat(v)
+	} else if conf.ShowEnumNames {
+		if name := enumName(v); name != "" {
+			r.Value = fmt.Sprintf("%s (%s)", name, v.Value)
+		}
 	}
 
 	if name != "" {
@@ -89,6 +124,7 @@ func wrapApiVariable(v *api.Variable, name, expr string, customFormatters bool)
 	r.Varname = r.DisplayName
 
 	r.Children = wrapApiVariables(v.Children, v.Kind, 0, r.Expression, customFormatters)
+	r.belowTypeLimits = belowTypeLoadLimits(v)
 
 	if v.Kind == reflect.Interface {
 		if len(r.Children) > 0 && r.Children[0].Kind == reflect.Ptr {
@@ -100,6 +136,73 @@ func wrapApiVariable(v *api.Variable, name, expr string, customFormatters bool)
 	return r
 }
 
+// floatSpecial returns a description of the value of v if it is a special
+// floating point value (NaN, +Inf, -Inf or a denormal number) or the empty
+// string otherwise.
+func floatSpecial(v *api.Variable) string {
+	minNormal := 2.2250738585072014e-308 // smallest normal float64
+	switch v.Kind {
+	case reflect.Float32:
+		minNormal = 1.1754943508222875e-38 // smallest normal float32
+	case reflect.Float64:
+		// ok
+	default:
+		return ""
+	}
+	f, err := strconv.ParseFloat(v.Value, 64)
+	if err != nil {
+		return ""
+	}
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case f != 0 && math.Abs(f) < minNormal:
+		return "denormal"
+	}
+	return ""
+}
+
+// findSpecialFloats returns the paths of all special floating point values
+// (see floatSpecial) contained in v, along with a description of each of
+// them.
+func findSpecialFloats(v *api.Variable, path string, r []string) []string {
+	if special := floatSpecial(v); special != "" {
+		return append(r, fmt.Sprintf("%s = %s (%s)", path, v.Value, special))
+	}
+	switch v.Kind {
+	case reflect.Array, reflect.Slice:
+		for i := range v.Children {
+			r = findSpecialFloats(&v.Children[i], fmt.Sprintf("%s[%d]", path, i), r)
+		}
+	case reflect.Struct:
+		for i := range v.Children {
+			r = findSpecialFloats(&v.Children[i], fmt.Sprintf("%s.%s", path, v.Children[i].Name), r)
+		}
+	case reflect.Ptr:
+		if len(v.Children) > 0 {
+			r = findSpecialFloats(&v.Children[0], fmt.Sprintf("(*%s)", path), r)
+		}
+	case reflect.Interface:
+		if len(v.Children) > 0 {
+			r = findSpecialFloats(&v.Children[0], fmt.Sprintf("%s.(%s)", path, v.Children[0].Type), r)
+		}
+	case reflect.Map:
+		for i := 0; i+1 < len(v.Children); i += 2 {
+			r = findSpecialFloats(&v.Children[i+1], fmt.Sprintf("%s[%s]", path, prettyprint.Singleline(&v.Children[i], false, false)), r)
+		}
+	case reflect.Complex64, reflect.Complex128:
+		if len(v.Children) == 2 {
+			r = findSpecialFloats(&v.Children[0], fmt.Sprintf("real(%s)", path), r)
+			r = findSpecialFloats(&v.Children[1], fmt.Sprintf("imag(%s)", path), r)
+		}
+	}
+	return r
+}
+
 func formatTime(v *api.Variable) string {
 	const (
 		timeTimeWallHasMonotonicBit uint64        = (1 << 63)                                                  // hasMonotonic bit of time.Time.wall
@@ -139,6 +242,119 @@ func formatTime(v *api.Variable) string {
 	}
 }
 
+// bigNat converts a variable of type math/big.nat to a big.Int, returns
+// false if its value wasn't completely loaded.
+func bigNat(v *api.Variable) (*big.Int, bool) {
+	if v == nil || v.Unreadable != "" || v.Kind != reflect.Slice || int64(len(v.Children)) != v.Len {
+		return nil, false
+	}
+	// words are stored in little-endian order
+	r := new(big.Int)
+	for i := len(v.Children) - 1; i >= 0; i-- {
+		w, err := strconv.ParseUint(v.Children[i].Value, 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		r.Lsh(r, bits.UintSize)
+		r.Or(r, new(big.Int).SetUint64(w))
+	}
+	return r, true
+}
+
+// bigInt converts a variable of type math/big.Int to a big.Int, returns
+// false if its value could not be read.
+func bigInt(v *api.Variable) (*big.Int, bool) {
+	if v == nil || v.Unreadable != "" {
+		return nil, false
+	}
+	negv := fieldVariable(v, "neg")
+	if negv == nil {
+		return nil, false
+	}
+	r, ok := bigNat(fieldVariable(v, "abs"))
+	if !ok {
+		return nil, false
+	}
+	if negv.Value == "true" {
+		r.Neg(r)
+	}
+	return r, true
+}
+
+func formatBigInt(v *api.Variable) string {
+	n, ok := bigInt(v)
+	if !ok {
+		return v.Value
+	}
+	return n.String()
+}
+
+func formatBigRat(v *api.Variable) string {
+	a, ok := bigInt(fieldVariable(v, "a"))
+	if !ok {
+		return v.Value
+	}
+	b, ok := bigInt(fieldVariable(v, "b"))
+	if !ok {
+		return v.Value
+	}
+	if b.Sign() == 0 {
+		// the zero value of b is interpreted as 1
+		b.SetInt64(1)
+	}
+	return new(big.Rat).SetFrac(a, b).RatString()
+}
+
+func formatBigFloat(v *api.Variable) string {
+	const (
+		formZero   = 0
+		formFinite = 1
+		formInf    = 2
+	)
+
+	precv, formv, negv, expv := fieldVariable(v, "prec"), fieldVariable(v, "form"), fieldVariable(v, "neg"), fieldVariable(v, "exp")
+	if precv == nil || formv == nil || negv == nil || expv == nil {
+		return v.Value
+	}
+	prec, err1 := strconv.ParseUint(precv.Value, 10, 32)
+	form, err2 := strconv.ParseUint(formv.Value, 10, 8)
+	exp, err3 := strconv.ParseInt(expv.Value, 10, 32)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return v.Value
+	}
+	neg := negv.Value == "true"
+
+	switch form {
+	case formZero:
+		if neg {
+			return "-0"
+		}
+		return "0"
+	case formInf:
+		if neg {
+			return "-Inf"
+		}
+		return "+Inf"
+	case formFinite:
+		mantv := fieldVariable(v, "mant")
+		mant, ok := bigNat(mantv)
+		if !ok {
+			return v.Value
+		}
+		// the mantissa is interpreted as a value in [0.5, 1)
+		f := new(big.Float).SetInt(mant)
+		f.SetMantExp(f, int(exp)-len(mantv.Children)*bits.UintSize)
+		if prec > 0 {
+			f.SetPrec(uint(prec))
+		}
+		if neg {
+			f.Neg(f)
+		}
+		return f.Text('g', -1)
+	}
+	return v.Value
+}
+
 func fieldVariable(v *api.Variable, name string) *api.Variable {
 	for i := range v.Children {
 		if v.Children[i].Name == name {
@@ -222,19 +438,34 @@ func wrapApiVariables(vs []api.Variable, kind reflect.Kind, start int, expr stri
 var globalsPanel = struct {
 	asyncLoad    asyncLoad
 	filterEditor nucular.TextEditor
+	filterRegexp bool
+	lastFilter   string
+	pkgEditor    nucular.TextEditor
 	showAddr     bool
 	fullTypes    bool
 	globals      []*Variable
+	// loaded contains the names of the globals that were fully loaded,
+	// all other globals are loaded with globalsNameLoadConfig.
+	loaded map[string]bool
 }{
 	filterEditor: nucular.TextEditor{Filter: spacefilter},
+	pkgEditor:    nucular.TextEditor{Filter: spacefilter, Flags: nucular.EditSigEnter},
 }
 
+// globalsNameLoadConfig is used to list package variables, it loads the
+// values of scalars but not the contents of composite types, which are
+// only loaded when expanded.
+var globalsNameLoadConfig = api.LoadConfig{FollowPointers: false, MaxVariableRecurse: 0, MaxStringLen: 64, MaxArrayValues: 0, MaxStructFields: 0}
+
 var localsPanel = struct {
 	asyncLoad    asyncLoad
 	filterEditor nucular.TextEditor
+	filterRegexp bool
+	lastFilter   string
 	showAddr     bool
 	fullTypes    bool
 	locals       []*Variable
+	returns      []*Variable // values returned by the last 'stepout -ret'
 
 	expressions []Expr
 	selected    int
@@ -250,15 +481,90 @@ type Expr struct {
 	Expr                         string
 	maxArrayValues, maxStringLen int
 	traced                       bool
+
+	// watched expressions are evaluated every time the target stops, the
+	// last maxWatchHistory distinct values are kept in history.
+	watched bool
+	history []watchValue
+
+	// pinFunc is the function of the frame the expression was pinned to, it
+	// is used to find the frame again when its offset changes.
+	pinFunc string
+}
+
+const maxWatchHistory = 10
+
+type watchValue struct {
+	when  time.Time
+	value string
+}
+
+// recordValue appends value to the history of e, unless it is the same as
+// the last recorded value. Returns true if value was recorded.
+func (e *Expr) recordValue(when time.Time, value string) bool {
+	if n := len(e.history); n > 0 && e.history[n-1].value == value {
+		return false
+	}
+	if len(e.history) >= maxWatchHistory {
+		copy(e.history, e.history[1:])
+		e.history = e.history[:len(e.history)-1]
+	}
+	e.history = append(e.history, watchValue{when, value})
+	return true
+}
+
+// packageFilter returns a regular expression matching the names of the
+// package variables of pkg, pkg can be a full package path or its last
+// component.
+func packageFilter(pkg string) string {
+	if pkg == "" {
+		return ""
+	}
+	return "(^|/)" + regexp.QuoteMeta(pkg) + `\.[^./]+$`
 }
 
 func loadGlobals(p *asyncLoad) {
-	globals, err := client.ListPackageVariables("", getVariableLoadConfig())
-	globalsPanel.globals = wrapApiVariables(globals, 0, 0, "", true)
-	sort.Sort(variablesByName(globalsPanel.globals))
+	apiglobals, err := client.ListPackageVariables(packageFilter(string(globalsPanel.pkgEditor.Buffer)), globalsNameLoadConfig)
+	globals := wrapApiVariables(apiglobals, 0, 0, "", true)
+	loaded := map[string]bool{}
+	sort.Sort(variablesByName(globals))
+	for i, v := range globals {
+		if isCompositeKind(v.Kind) && isVarTreeOpen(v.Expression) {
+			globals[i] = loadOneGlobal(v)
+			loaded[v.Name] = true
+		}
+	}
+	additionalLoadMu.Lock()
+	globalsPanel.globals = globals
+	globalsPanel.loaded = loaded
+	additionalLoadMu.Unlock()
 	p.done(err)
 }
 
+// globalIsLazy returns true if v is a composite variable that was not
+// fully loaded yet.
+// Must be called with additionalLoadMu held.
+func globalIsLazy(v *Variable) bool {
+	return !globalsPanel.loaded[v.Name] && isCompositeKind(v.Kind)
+}
+
+func isCompositeKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Struct, reflect.Array, reflect.Slice, reflect.Map, reflect.Ptr, reflect.Interface, reflect.Chan:
+		return true
+	}
+	return false
+}
+
+// loadOneGlobal returns the fully loaded value of the global variable v.
+func loadOneGlobal(v *Variable) *Variable {
+	lv, err := client.EvalVariable(currentEvalScope(), v.Name, getVariableLoadConfigForType(v.Type))
+	if err != nil {
+		lv = &api.Variable{Name: v.Name, Type: v.Type, Kind: v.Kind, Unreadable: err.Error()}
+	}
+	return wrapApiVariable(lv, v.Name, v.Expression, true)
+}
+
 func updateGlobals(container *nucular.Window) {
 	w := globalsPanel.asyncLoad.showRequest(container)
 	if w == nil {
@@ -269,19 +575,54 @@ func updateGlobals(container *nucular.Window) {
 	defer additionalLoadMu.Unlock()
 
 	w.MenubarBegin()
-	w.Row(varRowHeight).Static(90, 0, 100, 100)
+	w.Row(varRowHeight).Static(90, 0, 100, 100, 100)
 	w.Label("Filter:", "LC")
 	globalsPanel.filterEditor.Edit(w)
 	filter := string(globalsPanel.filterEditor.Buffer)
+	w.CheckboxText("Regexp", &globalsPanel.filterRegexp)
 	w.CheckboxText("Full Types", &globalsPanel.fullTypes)
 	w.CheckboxText("Address", &globalsPanel.showAddr)
+	w.Row(varRowHeight).Static(90, 0)
+	w.Label("Package:", "LC")
+	if globalsPanel.pkgEditor.Edit(w)&nucular.EditCommitted != 0 {
+		globalsPanel.asyncLoad.clear()
+	}
 	w.MenubarEnd()
 
 	globals := globalsPanel.globals
 
+	match := makeVarFilter(filter, globalsPanel.filterRegexp)
+	expand := filter != globalsPanel.lastFilter
+	globalsPanel.lastFilter = filter
+
 	for i := range globals {
-		if strings.Index(globals[i].Name, filter) >= 0 {
+		if match != nil && !filterVariable(globals[i], match, expand) {
+			continue
+		}
+		if !globalIsLazy(globals[i]) {
 			showVariable(w, 0, globalsPanel.showAddr, globalsPanel.fullTypes, -1, globals[i])
+			continue
+		}
+		w.Row(varRowHeight).Static()
+		w.LayoutSetWidthScaled(maxVariableHeaderWidth)
+		if w.TreePushNamed(nucular.TreeNode, globals[i].Varname, fmt.Sprintf("%s %s", globals[i].DisplayName, getDisplayType(globals[i], globalsPanel.fullTypes)), false) {
+			setVarTreeOpen(globals[i].Expression, true)
+			if !globals[i].loading {
+				globals[i].loading = true
+				go func(i int, v *Variable) {
+					lv := loadOneGlobal(v)
+					additionalLoadMu.Lock()
+					if i < len(globalsPanel.globals) && globalsPanel.globals[i] == v {
+						globalsPanel.globals[i] = lv
+						globalsPanel.loaded[v.Name] = true
+					}
+					additionalLoadMu.Unlock()
+					wnd.Changed()
+				}(i, globals[i])
+			}
+			w.Row(varRowHeight).Dynamic(1)
+			w.Label("Loading...", "LC")
+			w.TreePop()
 		}
 	}
 }
@@ -292,8 +633,85 @@ func (vars variablesByName) Len() int           { return len(vars) }
 func (vars variablesByName) Swap(i, j int)      { vars[i], vars[j] = vars[j], vars[i] }
 func (vars variablesByName) Less(i, j int) bool { return vars[i].Name < vars[j].Name }
 
+// varTreeOpen is the set of expressions of variables whose tree node is
+// open, it is used to keep nodes open when variables are reloaded.
+var varTreeOpen = map[string]bool{}
+var varTreeOpenMu sync.Mutex
+
+func isVarTreeOpen(expr string) bool {
+	varTreeOpenMu.Lock()
+	defer varTreeOpenMu.Unlock()
+	return varTreeOpen[expr]
+}
+
+func setVarTreeOpen(expr string, open bool) {
+	varTreeOpenMu.Lock()
+	defer varTreeOpenMu.Unlock()
+	if open {
+		varTreeOpen[expr] = true
+	} else {
+		delete(varTreeOpen, expr)
+	}
+}
+
+// varTreeRoots returns the expressions of the root nodes of the local
+// variables panel.
+func varTreeRoots() map[string]bool {
+	r := map[string]bool{}
+	for _, v := range localsPanel.locals {
+		r[v.Expression] = true
+	}
+	for i := range localsPanel.expressions {
+		r[localsPanel.expressions[i].Expr] = true
+	}
+	return r
+}
+
+// exprHasRoot returns true if expr is root or the expression of one of
+// its descendants.
+func exprHasRoot(expr, root string) bool {
+	for strings.HasPrefix(expr, "(*(") {
+		expr = expr[len("(*("):]
+	}
+	if !strings.HasPrefix(expr, root) {
+		return false
+	}
+	if len(expr) == len(root) {
+		return true
+	}
+	switch expr[len(root)] {
+	case '.', '[', ')':
+		return true
+	}
+	return false
+}
+
+// pruneVarTreeOpen removes from varTreeOpen all the expressions that
+// belonged to a root in oldRoots that no longer exists.
+// Must be called with additionalLoadMu held.
+func pruneVarTreeOpen(oldRoots map[string]bool) {
+	newRoots := varTreeRoots()
+	varTreeOpenMu.Lock()
+	defer varTreeOpenMu.Unlock()
+	for expr := range varTreeOpen {
+		for root := range oldRoots {
+			if !newRoots[root] && exprHasRoot(expr, root) {
+				delete(varTreeOpen, expr)
+				break
+			}
+		}
+	}
+}
+
 func loadLocals(p *asyncLoad) {
+	additionalLoadMu.Lock()
+	oldRoots := varTreeRoots()
+	additionalLoadMu.Unlock()
 	args, errloc := client.ListFunctionArgs(currentEvalScope(), getVariableLoadConfig())
+	if p.superseded() {
+		p.done(nil)
+		return
+	}
 	localsPanel.locals = wrapApiVariables(args, 0, 0, "", true)
 	locals, errarg := client.ListLocalVariables(currentEvalScope(), getVariableLoadConfig())
 	for i := range locals {
@@ -318,13 +736,55 @@ func loadLocals(p *asyncLoad) {
 		varmap[varname] = d
 	}
 
+	if p.superseded() {
+		p.done(nil)
+		return
+	}
+
+	// Expressions are evaluated concurrently, the results are wrapped
+	// sequentially because custom formatters can not run concurrently.
+	additionalLoadMu.Lock()
+	exprs := append([]Expr(nil), localsPanel.expressions...)
+	additionalLoadMu.Unlock()
+	exprvs := make([]*api.Variable, len(exprs))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentExprLoads)
+	for i := range exprvs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, e Expr) {
+			defer wg.Done()
+			exprvs[i] = evalScopedExpr(e.Expr, exprLoadConfig(&e))
+			<-sem
+		}(i, exprs[i])
+	}
+	wg.Wait()
+
+	additionalLoadMu.Lock()
 	var scrollbackOut = editorWriter{&scrollbackEditor, true}
-	for i := range localsPanel.expressions {
-		loadOneExpr(i)
+	for i := range exprvs {
+		if i >= len(localsPanel.expressions) || i >= len(localsPanel.v) {
+			break
+		}
+		if localsPanel.expressions[i].Expr != exprs[i].Expr {
+			// the expression was removed or edited while it was being
+			// evaluated, the result belongs to a different expression.
+			go func(i int) {
+				additionalLoadMu.Lock()
+				defer additionalLoadMu.Unlock()
+				if i < len(localsPanel.expressions) && i < len(localsPanel.v) {
+					loadOneExpr(i)
+				}
+				wnd.Changed()
+			}(i)
+			continue
+		}
+		setExprVariable(i, exprvs[i])
 		if localsPanel.expressions[i].traced {
 			fmt.Fprintf(&scrollbackOut, "%s = %s\n", localsPanel.v[i].Name, localsPanel.v[i].SinglelineString(true, false))
 		}
 	}
+	additionalLoadMu.Unlock()
 
 	if LogOutputNice != nil {
 		logf("Local variables (%#v):\n", currentEvalScope())
@@ -336,6 +796,10 @@ func loadLocals(p *asyncLoad) {
 		}
 	}
 
+	additionalLoadMu.Lock()
+	pruneVarTreeOpen(oldRoots)
+	additionalLoadMu.Unlock()
+
 	for _, err := range []error{errarg, errloc} {
 		if err != nil {
 			p.done(err)
@@ -345,6 +809,42 @@ func loadLocals(p *asyncLoad) {
 	p.done(nil)
 }
 
+const maxAnnotationValueLen = 40
+
+// loadListingAnnotations loads the values of the variables of the current
+// frame that are shown next to their declaration in the listing panel.
+func loadListingAnnotations() {
+	listingPanel.annotations = nil
+	if !conf.InlineValues || listingPanel.pinnedLoc != nil || curThread < 0 {
+		return
+	}
+	args, _ := client.ListFunctionArgs(currentEvalScope(), ShortLoadConfig)
+	locals, _ := client.ListLocalVariables(currentEvalScope(), ShortLoadConfig)
+	listingPanel.annotations = formatAnnotations(append(args, locals...))
+}
+
+// formatAnnotations returns, for each declaration line, the list of
+// variables declared on it with their values.
+func formatAnnotations(vars []api.Variable) map[int]string {
+	r := map[int]string{}
+	for i := range vars {
+		v := &vars[i]
+		if v.DeclLine <= 0 || v.Unreadable != "" || v.Flags&api.VariableShadowed != 0 {
+			continue
+		}
+		val := prettyprint.Singleline(v, false, false)
+		if rval := []rune(val); len(rval) > maxAnnotationValueLen {
+			val = string(rval[:maxAnnotationValueLen]) + "..."
+		}
+		s := fmt.Sprintf("%s = %s", v.Name, val)
+		if r[int(v.DeclLine)] != "" {
+			s = r[int(v.DeclLine)] + ", " + s
+		}
+		r[int(v.DeclLine)] = s
+	}
+	return r
+}
+
 const (
 	varRowHeight    = 20
 	varEditorHeight = 25
@@ -362,16 +862,26 @@ func updateLocals(container *nucular.Window) {
 	defer additionalLoadMu.Unlock()
 
 	w.MenubarBegin()
-	w.Row(varRowHeight).Static(90, 0, 100, 100)
+	w.Row(varRowHeight).Static(90, 0, 100, 100, 100)
 	w.Label("Filter:", "LC")
 	localsPanel.filterEditor.Edit(w)
 	filter := string(localsPanel.filterEditor.Buffer)
+	w.CheckboxText("Regexp", &localsPanel.filterRegexp)
 	w.CheckboxText("Full Types", &localsPanel.fullTypes)
 	w.CheckboxText("Address", &localsPanel.showAddr)
 	w.MenubarEnd()
 
 	locals := localsPanel.locals
 
+	if len(localsPanel.returns) > 0 {
+		if w.TreePush(nucular.TreeTab, "Values returned", true) {
+			for i := range localsPanel.returns {
+				showVariable(w, 0, localsPanel.showAddr, localsPanel.fullTypes, -1, localsPanel.returns[i])
+			}
+			w.TreePop()
+		}
+	}
+
 	if len(localsPanel.expressions) > 0 {
 		if w.TreePush(nucular.TreeTab, "Expression", true) {
 			for i := 0; i < len(localsPanel.expressions); i++ {
@@ -391,9 +901,12 @@ func updateLocals(container *nucular.Window) {
 	}
 
 	if len(locals) > 0 {
+		match := makeVarFilter(filter, localsPanel.filterRegexp)
+		expand := filter != localsPanel.lastFilter
+		localsPanel.lastFilter = filter
 		if w.TreePush(nucular.TreeTab, "Local variables and arguments", true) {
 			for i := range locals {
-				if strings.Index(locals[i].Name, filter) >= 0 {
+				if match == nil || filterVariable(locals[i], match, expand) {
 					showVariable(w, 0, localsPanel.showAddr, localsPanel.fullTypes, -1, locals[i])
 				}
 			}
@@ -402,23 +915,156 @@ func updateLocals(container *nucular.Window) {
 	}
 }
 
+// makeVarFilter returns a case insensitive matching function for filter,
+// or nil if all variables should be shown.
+func makeVarFilter(filter string, isRegexp bool) func(string) bool {
+	if filter == "" {
+		return nil
+	}
+	if isRegexp {
+		re, err := regexp.Compile("(?i)" + filter)
+		if err != nil {
+			return nil
+		}
+		return re.MatchString
+	}
+	filter = strings.ToLower(filter)
+	return func(s string) bool {
+		return strings.Contains(strings.ToLower(s), filter)
+	}
+}
+
+// filterVariable returns true if the name or value of v, or of any of its
+// loaded descendants, matches. If expand is set the tree nodes leading to
+// descendants that match are opened.
+func filterVariable(v *Variable, match func(string) bool, expand bool) bool {
+	found := match(v.Name) || (v.Value != "" && match(v.Value))
+	nested := false
+	for _, c := range v.Children {
+		if c != nil && filterVariable(c, match, expand) {
+			nested = true
+		}
+	}
+	if nested && expand && v.Expression != "" {
+		setVarTreeOpen(v.Expression, true)
+		v.treeStateRestored = false
+	}
+	return found || nested
+}
+
 func isPinned(expr string) bool {
 	return expr[0] == '['
 }
 
-func loadOneExpr(i int) {
+func exprLoadConfig(e *Expr) api.LoadConfig {
 	cfg := getVariableLoadConfig()
-	if localsPanel.expressions[i].maxArrayValues > 0 {
-		cfg.MaxArrayValues = localsPanel.expressions[i].maxArrayValues
-		cfg.MaxStringLen = localsPanel.expressions[i].maxStringLen
+	if e.maxArrayValues > 0 {
+		cfg.MaxArrayValues = e.maxArrayValues
+		cfg.MaxStringLen = e.maxStringLen
 	}
+	return cfg
+}
+
+// maxConcurrentExprLoads is the maximum number of expressions evaluated
+// concurrently by loadLocals.
+const maxConcurrentExprLoads = 8
 
-	v := evalScopedExpr(localsPanel.expressions[i].Expr, cfg)
+func loadOneExpr(i int) {
+	setExprVariable(i, evalScopedExpr(localsPanel.expressions[i].Expr, exprLoadConfig(&localsPanel.expressions[i])))
+}
+
+// setExprVariable sets v as the value of the i-th expression of the
+// variables panel.
+func setExprVariable(i int, v *api.Variable) {
 	v.Name = localsPanel.expressions[i].Expr
 
 	localsPanel.v[i] = wrapApiVariable(v, v.Name, v.Name, true)
 }
 
+// repinExpressions updates the frame offset of expressions pinned to a
+// frame whose offset changed, for example because the stack of the
+// goroutine was moved, so that they keep referring to the same call of the
+// function they were pinned to.
+func repinExpressions() {
+	stacks := map[int][]api.Stackframe{}
+	for i := range localsPanel.expressions {
+		e := &localsPanel.expressions[i]
+		if e.pinFunc == "" {
+			continue
+		}
+		se := ParseScopedExpr(e.Expr)
+		if se.Kind != FrameOffsetScopeExpr || se.Gid < 0 {
+			continue
+		}
+		frames, ok := stacks[se.Gid]
+		if !ok {
+			frames, _ = client.Stacktrace(se.Gid, 100, false, nil)
+			stacks[se.Gid] = frames
+		}
+		if off, ok := repinFrameOffset(frames, e.pinFunc, int64(se.Foff)); ok && off != int64(se.Foff) {
+			e.Expr = fmt.Sprintf("@g%df%dd%d %s", se.Gid, off, se.DeferredCall, se.EvalExpr)
+		}
+	}
+}
+
+// repinFrameOffset returns the frame offset of the frame of fn that an
+// expression pinned to the frame at offset off should use: off itself if
+// the frame is still there, otherwise the offset of the innermost frame
+// of fn.
+func repinFrameOffset(frames []api.Stackframe, fn string, off int64) (int64, bool) {
+	for i := range frames {
+		if frames[i].FrameOffset == off && frames[i].Function.Name() == fn {
+			return off, true
+		}
+	}
+	for i := range frames {
+		if frames[i].Function.Name() == fn {
+			return frames[i].FrameOffset, true
+		}
+	}
+	return 0, false
+}
+
+// loadWatches evaluates all watched expressions and records their values.
+func loadWatches() {
+	now := time.Now()
+	for i := range localsPanel.expressions {
+		e := &localsPanel.expressions[i]
+		if !e.watched {
+			continue
+		}
+		v := evalScopedExpr(e.Expr, exprLoadConfig(e))
+		e.recordValue(now, prettyprint.Singleline(v, false, false))
+	}
+}
+
+func updateWatches(w *nucular.Window) {
+	empty := true
+	for i := range localsPanel.expressions {
+		e := &localsPanel.expressions[i]
+		if !e.watched {
+			continue
+		}
+		empty = false
+		cur := ""
+		if n := len(e.history); n > 0 {
+			cur = e.history[n-1].value
+		}
+		if w.TreePushNamed(nucular.TreeTab, fmt.Sprintf("watch%d", i), fmt.Sprintf("%s = %s", e.Expr, cur), true) {
+			for j := len(e.history) - 1; j >= 0; j-- {
+				w.Row(varRowHeight).Static(100, 0)
+				w.Label(e.history[j].when.Format("15:04:05.000"), "LC")
+				w.Label(e.history[j].value, "LC")
+			}
+			w.TreePop()
+		}
+	}
+	if empty {
+		w.Row(varRowHeight).Dynamic(1)
+		w.Label("No watched expressions, check \"Watched\" in the menu of an expression in the Variables window.", "LC")
+	}
+}
+
 func exprsEditor(w *nucular.Window) {
 	w.Row(varEditorHeight).Dynamic(1)
 	active := localsPanel.ed.Edit(w)
@@ -449,6 +1095,27 @@ func addExpression(newexpr string) {
 	}(i)
 }
 
+// MonitoredExpressions is the list of expressions that are automatically
+// added to the variables panel every time the target process is restarted.
+var MonitoredExpressions []string
+
+// restoreMonitoredExpressions adds to the variables panel all monitored
+// expressions that aren't already displayed.
+func restoreMonitoredExpressions() {
+	for _, expr := range MonitoredExpressions {
+		found := false
+		for i := range localsPanel.expressions {
+			if localsPanel.expressions[i].Expr == expr {
+				found = true
+				break
+			}
+		}
+		if !found {
+			addExpression(expr)
+		}
+	}
+}
+
 func showExprMenu(parentw *nucular.Window, exprMenuIdx int, v *Variable, clipb []byte) {
 	if client.Running() {
 		return
@@ -468,6 +1135,20 @@ func showExprMenu(parentw *nucular.Window, exprMenuIdx int, v *Variable, clipb [
 		clipboard.Set(string(clipb))
 	}
 
+	if w.MenuItem(label.TA("Copy value", "LC")) {
+		if v.Value != "" {
+			clipboard.Set(v.Value)
+		} else {
+			clipboard.Set(v.SinglelineString(false, false))
+		}
+	}
+
+	if v.Addr != 0 {
+		if w.MenuItem(label.TA("Copy address", "LC")) {
+			clipboard.Set(fmt.Sprintf("%#x", v.Addr))
+		}
+	}
+
 	if exprMenuIdx >= 0 && exprMenuIdx < len(localsPanel.expressions) {
 		pinned := exprIsScoped(localsPanel.expressions[exprMenuIdx].Expr)
 		if w.MenuItem(label.TA("Edit expression", "LC")) {
@@ -494,11 +1175,13 @@ func showExprMenu(parentw *nucular.Window, exprMenuIdx int, v *Variable, clipb [
 		if w.CheckboxText("Pin to frame", &pinned) {
 			if pinned && curFrame < len(stackPanel.stack) {
 				localsPanel.expressions[exprMenuIdx].Expr = fmt.Sprintf("@g%df%dd%d %s", curGid, stackPanel.stack[curFrame].FrameOffset, curDeferredCall, localsPanel.expressions[exprMenuIdx].Expr)
+				localsPanel.expressions[exprMenuIdx].pinFunc = stackPanel.stack[curFrame].Function.Name()
 			} else {
 				se := ParseScopedExpr(localsPanel.expressions[exprMenuIdx].Expr)
 				if se.Kind != InvalidScopeExpr {
 					localsPanel.expressions[exprMenuIdx].Expr = se.EvalExpr
 				}
+				localsPanel.expressions[exprMenuIdx].pinFunc = ""
 			}
 			go func(i int) {
 				additionalLoadMu.Lock()
@@ -508,6 +1191,14 @@ func showExprMenu(parentw *nucular.Window, exprMenuIdx int, v *Variable, clipb [
 		}
 		if exprMenuIdx < len(localsPanel.expressions) {
 			w.CheckboxText("Traced", &localsPanel.expressions[exprMenuIdx].traced)
+			if w.CheckboxText("Watched", &localsPanel.expressions[exprMenuIdx].watched) {
+				go func() {
+					wnd.Lock()
+					loadWatches()
+					wnd.Unlock()
+					wnd.Changed()
+				}()
+			}
 		}
 	} else if v.Expression != "" {
 		if w.MenuItem(label.TA("Add as expression", "LC")) {
@@ -516,6 +1207,23 @@ func showExprMenu(parentw *nucular.Window, exprMenuIdx int, v *Variable, clipb [
 		}
 	}
 
+	if v.Expression != "" {
+		if w.MenuItem(label.TA("Snapshot", "LC")) {
+			go takeVarSnapshot(v.Expression)
+		}
+		if hasVarSnapshot(v.Expression) {
+			if w.MenuItem(label.TA("Compare with snapshot", "LC")) {
+				newVarDiffViewer(w.Master(), v.Expression)
+			}
+		}
+	}
+
+	if v.Kind == reflect.Ptr && len(v.Children) > 0 && v.Children[0].Addr != 0 {
+		if w.MenuItem(label.TA("Follow pointer in new window", "LC")) {
+			newDetailViewer(w.Master(), fmt.Sprintf("*(*%q)(%#x)", v.Children[0].Type, v.Children[0].Addr))
+		}
+	}
+
 	if v.Kind == reflect.Func {
 		if w.MenuItem(label.TA("Go to definition", "LC")) {
 			locs, err := client.FindLocation(currentEvalScope(), fmt.Sprintf("*%#x", v.Base))
@@ -533,15 +1241,29 @@ func showExprMenu(parentw *nucular.Window, exprMenuIdx int, v *Variable, clipb [
 		if w.OptionText("Hexadecimal", mode == hexMode) {
 			mode = hexMode
 		}
+		if w.OptionText("Hexadecimal (two's complement)", mode == hexTwosComplementMode) {
+			mode = hexTwosComplementMode
+		}
 		if w.OptionText("Octal", mode == octMode) {
 			mode = octMode
 		}
+		if w.OptionText("Binary", mode == binMode) {
+			mode = binMode
+		}
 		if w.OptionText("Decimal", mode == decMode) {
 			mode = decMode
 		}
+		if v.Type == "time.Duration" {
+			if w.OptionText("Duration", mode == durationMode) {
+				mode = durationMode
+			}
+		}
 		if mode != oldmode {
 			f := intFormatter[mode]
 			varFormat[v.Addr] = f
+			if mode == hexMode || mode == hexTwosComplementMode {
+				varTypeFormat[v.Type] = f
+			}
 			f(v)
 			v.Width = 0
 		}
@@ -555,6 +1277,9 @@ func showExprMenu(parentw *nucular.Window, exprMenuIdx int, v *Variable, clipb [
 		if w.OptionText("Octal", mode == octMode) {
 			mode = octMode
 		}
+		if w.OptionText("Binary", mode == binMode) {
+			mode = binMode
+		}
 		if w.OptionText("Decimal", mode == decMode) {
 			mode = decMode
 		}
@@ -593,9 +1318,30 @@ func showExprMenu(parentw *nucular.Window, exprMenuIdx int, v *Variable, clipb [
 		}
 	}
 
+	if n := len(structFields); n > 0 && structFields[n-1].v == v {
+		typ := structFields[n-1].typ
+		prefs := conf.StructFieldPrefs[typ]
+		hideLbl, pinLbl := "Hide field", "Pin field"
+		if hasFieldName(prefs.Hidden, v.Name) {
+			hideLbl = "Unhide field"
+		}
+		if hasFieldName(prefs.Pinned, v.Name) {
+			pinLbl = "Unpin field"
+		}
+		if w.MenuItem(label.TA(hideLbl, "LC")) {
+			toggleStructFieldPref(typ, v.Name, func(p *StructFieldPrefs) *[]string { return &p.Hidden })
+		}
+		if w.MenuItem(label.TA(pinLbl, "LC")) {
+			toggleStructFieldPref(typ, v.Name, func(p *StructFieldPrefs) *[]string { return &p.Pinned })
+		}
+	}
+
 	if w.MenuItem(label.TA("Location...", "LC")) {
-		out := editorWriter{&scrollbackEditor, false}
-		fmt.Fprintf(&out, "location of %q at %#x: %s\n", v.Name, curPC, v.LocationExpr)
+		go func(name, locexpr string, pc uint64) {
+			out := editorWriter{&scrollbackEditor, false}
+			fmt.Fprintf(&out, "location of %q at %#x: %s\n", name, pc, locexpr)
+			fmt.Fprintf(&out, "\t%s\n", describeLocationExpr(locexpr, targetDwarfRegs()))
+		}(v.Name, v.LocationExpr, curPC)
 	}
 }
 
@@ -605,7 +1351,20 @@ func variableHeader(w *nucular.Window, addr, fullTypes bool, exprMenu int, v *Va
 	style := w.Master().Style()
 
 	w.LayoutSetWidthScaled(maxVariableHeaderWidth)
-	lblrect, out, isopen := w.TreePushCustom(nucular.TreeNode, v.Varname, false)
+	if v.Expression != "" && !v.treeStateRestored {
+		// The variable was just (re)loaded, restore the state of its tree node
+		// using its expression instead of relying on its display name.
+		v.treeStateRestored = true
+		if isVarTreeOpen(v.Expression) {
+			w.TreeOpen(v.Varname)
+		} else {
+			w.TreeClose(v.Varname)
+		}
+	}
+	lblrect, out, isopen := w.TreePushCustom(nucular.TreeNode, v.Varname, isVarTreeOpen(v.Expression))
+	if v.Expression != "" {
+		setVarTreeOpen(v.Expression, isopen)
+	}
 	if out == nil {
 		return isopen
 	}
@@ -663,6 +1422,11 @@ func variableNoHeader(w *nucular.Window, addr, fullTypes bool, exprMenu int, v *
 	w.Spacing(1)
 	w.LayoutSetWidthScaled(maxVariableHeaderWidth)
 
+	if inlineEdit.expr != "" && inlineEdit.expr == v.Expression {
+		showInlineEditor(w)
+		return
+	}
+
 	//w.Label(fmt.Sprintf("%s %s = %s", v.DisplayName, v.Type, value), "LC")
 
 	lblrect, out := w.Custom(nstyle.WidgetStateActive)
@@ -670,6 +1434,14 @@ func variableNoHeader(w *nucular.Window, addr, fullTypes bool, exprMenu int, v *
 		return
 	}
 
+	if !client.Running() && w.Input().Mouse.Clicked(mouse.ButtonLeft, lblrect) && canEditInline(v) {
+		now := time.Now()
+		if inlineEdit.lastClickExpr == v.Expression && now.Sub(inlineEdit.lastClick) < 500*time.Millisecond {
+			startInlineEdit(w, v, value)
+		}
+		inlineEdit.lastClick, inlineEdit.lastClickExpr = now, v.Expression
+	}
+
 	lblrect.Y += style.Text.Padding.Y
 
 	clipb := []byte{}
@@ -693,6 +1465,68 @@ func variableNoHeader(w *nucular.Window, addr, fullTypes bool, exprMenu int, v *
 	showExprMenu(w, exprMenu, v, clipb)
 }
 
+// inlineEdit is the state of the editor used to change the value of a
+// variable from the variables panels, a variable is edited by double
+// clicking its value.
+var inlineEdit = struct {
+	expr          string
+	ed            nucular.TextEditor
+	lastClick     time.Time
+	lastClickExpr string
+}{}
+
+// canEditInline returns true if v has a kind that can be changed with
+// setVarExpr and an expression that can be used to assign to it.
+func canEditInline(v *Variable) bool {
+	switch v.Kind {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr, reflect.Float32, reflect.Float64, reflect.Ptr, reflect.UnsafePointer, reflect.String:
+	default:
+		return false
+	}
+	if v.Expression == "" || v.Unreadable != "" {
+		return false
+	}
+	_, err := parser.ParseExpr(v.Expression)
+	return err == nil
+}
+
+func startInlineEdit(w *nucular.Window, v *Variable, value string) {
+	if v.Kind != reflect.String && v.Kind != reflect.Ptr && v.Kind != reflect.UnsafePointer {
+		// use the value as returned by delve, instead of the one formatted
+		// for display
+		value = v.Variable.Value
+	}
+	inlineEdit.expr = v.Expression
+	inlineEdit.lastClickExpr = ""
+	inlineEdit.ed.Flags = nucular.EditSelectable | nucular.EditClipboard | nucular.EditSigEnter
+	inlineEdit.ed.Buffer = []rune(value)
+	inlineEdit.ed.SelectAll()
+	w.Master().ActivateEditor(&inlineEdit.ed)
+}
+
+func showInlineEditor(w *nucular.Window) {
+	for _, e := range w.Input().Keyboard.Keys {
+		if e.Modifiers == 0 && e.Code == key.CodeEscape {
+			inlineEdit.expr = ""
+			return
+		}
+	}
+	if inlineEdit.ed.Edit(w)&nucular.EditCommitted == 0 {
+		return
+	}
+	expr, value := inlineEdit.expr, string(inlineEdit.ed.Buffer)
+	inlineEdit.expr = ""
+	go func() {
+		out := editorWriter{&scrollbackEditor, true}
+		if err := setVarExpr(currentEvalScope(), expr, value); err != nil {
+			fmt.Fprintf(&out, "Could not set %s: %v\n", expr, err)
+		}
+		localsPanel.asyncLoad.clear()
+		globalsPanel.asyncLoad.clear()
+		wnd.Changed()
+	}()
+}
+
 func getDisplayType(v *Variable, fullTypes bool) string {
 	if fullTypes {
 		return v.Type
@@ -700,6 +1534,10 @@ func getDisplayType(v *Variable, fullTypes bool) string {
 	return v.ShortType
 }
 
+// specialFloatColor is the color used to display NaN, Inf and denormal
+// floating point values.
+var specialFloatColor = color.RGBA{0xff, 0x00, 0x00, 0xff}
+
 func darken(p *color.RGBA) {
 	const darken = 0.5
 	p.A = uint8(float64(p.A) * darken)
@@ -708,9 +1546,36 @@ func darken(p *color.RGBA) {
 	p.B = uint8(float64(p.B) * darken)
 }
 
+// varAncestor identifies a variable by address and type.
+type varAncestor struct {
+	addr uintptr
+	typ  string
+}
+
+// varAncestors contains the variables currently being displayed by
+// showVariable, from the root to the current node, and is used to detect
+// cycles in self-referential data structures.
+var varAncestors []varAncestor
+
+func isVarAncestor(v *Variable) bool {
+	for _, a := range varAncestors {
+		if a.addr == v.Addr && a.typ == v.Type {
+			return true
+		}
+	}
+	return false
+}
+
 func showVariable(w *nucular.Window, depth int, addr, fullTypes bool, exprMenu int, v *Variable) {
 	style := w.Master().Style()
 
+	if v.Addr != 0 {
+		varAncestors = append(varAncestors, varAncestor{v.Addr, v.Type})
+		defer func() {
+			varAncestors = varAncestors[:len(varAncestors)-1]
+		}()
+	}
+
 	if v.Flags&api.VariableShadowed != 0 || v.Unreadable != "" {
 		savedStyle := *style
 		defer func() {
@@ -740,6 +1605,7 @@ func showVariable(w *nucular.Window, depth int, addr, fullTypes bool, exprMenu i
 
 	w.Row(varRowHeight).Static()
 	if v.Unreadable != "" {
+		setVarTreeOpen(v.Expression, false)
 		cblblfmt("(unreadable %s)", v.Unreadable)
 		return
 	}
@@ -765,9 +1631,16 @@ func showVariable(w *nucular.Window, depth int, addr, fullTypes bool, exprMenu i
 			cblbl("?")
 		} else if v.Type == "" || v.Children[0].Addr == 0 {
 			cblbl("nil")
+		} else if isVarAncestor(v.Children[0]) {
+			cblblfmt("↻ cycle to %#x", v.Children[0].Addr)
 		} else {
 			if hdr() {
-				if v.Children[0].OnlyAddr {
+				if v.Children[0].OnlyAddr && depth >= conf.MaxVariableDepth {
+					w.Row(varRowHeight).Static(moreBtnWidth)
+					if w.ButtonText("Load") {
+						loadMoreStruct(v.Children[0])
+					}
+				} else if v.Children[0].OnlyAddr {
 					loadMoreStruct(v.Children[0])
 					dynlbl("Loading...")
 				} else {
@@ -779,6 +1652,10 @@ func showVariable(w *nucular.Window, depth int, addr, fullTypes bool, exprMenu i
 	case reflect.UnsafePointer:
 		cblblfmt("unsafe.Pointer(%#x)", v.Children[0].Addr)
 	case reflect.String:
+		if v.belowTypeLimits && !v.loading {
+			v.loading = true
+			loadMoreStruct(v)
+		}
 		if v.Len == int64(len(v.Value)) {
 			cblblfmt("%q", v.Value)
 		} else {
@@ -814,7 +1691,7 @@ func showVariable(w *nucular.Window, depth int, addr, fullTypes bool, exprMenu i
 		}
 	case reflect.Map:
 		if hdr() {
-			if depth < 10 && !v.loading && len(v.Children) > 0 && autoloadMore(v.Children[0]) {
+			if depth < conf.MaxVariableDepth && !v.loading && len(v.Children) > 0 && autoloadMore(v.Children[0]) {
 				v.loading = true
 				loadMoreStruct(v)
 			}
@@ -840,7 +1717,18 @@ func showVariable(w *nucular.Window, depth int, addr, fullTypes bool, exprMenu i
 	case reflect.Complex64, reflect.Complex128:
 		cblblfmt("(%s + %si)", v.Children[0].Value, v.Children[1].Value)
 	case reflect.Float32, reflect.Float64:
-		cblbl(v.Value)
+		if special := floatSpecial(v.Variable); special != "" {
+			savedColor := style.Text.Color
+			style.Text.Color = specialFloatColor
+			if special == "denormal" {
+				cblblfmt("%s (denormal)", v.Value)
+			} else {
+				cblblfmt("%s (!)", v.Value)
+			}
+			style.Text.Color = savedColor
+		} else {
+			cblbl(v.Value)
+		}
 	default:
 		if v.Value != "" {
 			cblbl(v.Value)
@@ -851,7 +1739,7 @@ func showVariable(w *nucular.Window, depth int, addr, fullTypes bool, exprMenu i
 }
 
 func showArrayOrSliceContents(w *nucular.Window, depth int, addr, fullTypes bool, v *Variable) {
-	if depth < 10 && !v.loading && len(v.Children) > 0 && autoloadMore(v.Children[0]) {
+	if depth < conf.MaxVariableDepth && !v.loading && (v.belowTypeLimits || (len(v.Children) > 0 && autoloadMore(v.Children[0]))) {
 		v.loading = true
 		loadMoreStruct(v)
 	}
@@ -863,7 +1751,59 @@ func showArrayOrSliceContents(w *nucular.Window, depth int, addr, fullTypes bool
 		if w.ButtonText(fmt.Sprintf("%d more", int(v.Len)-len(v.Children))) {
 			loadMoreArrayOrSlice(v)
 		}
+		showIndexRangeEditor(w, v)
+		for i := range v.rangeChildren {
+			showVariable(w, depth+1, addr, fullTypes, -1, v.rangeChildren[i])
+		}
+	}
+}
+
+// showIndexRangeEditor shows an editor that can be used to load an
+// arbitrary range of elements of the array or slice v.
+func showIndexRangeEditor(w *nucular.Window, v *Variable) {
+	if v.rangeEd == nil {
+		v.rangeEd = &nucular.TextEditor{}
+		v.rangeEd.Flags = nucular.EditSelectable | nucular.EditClipboard | nucular.EditSigEnter
+	}
+	w.Row(varRowHeight).Static(moreBtnWidth, 150)
+	w.Label("Range:", "LC")
+	if v.rangeEd.Edit(w)&nucular.EditCommitted == 0 {
+		return
+	}
+	start, end, err := parseIndexRange(string(v.rangeEd.Buffer), v.Len)
+	if err != nil {
+		out := editorWriter{&scrollbackEditor, true}
+		fmt.Fprintf(&out, "Invalid index range: %v\n", err)
+		return
 	}
+	loadArrayOrSliceRange(v, start, end)
+}
+
+// parseIndexRange parses an index range with the syntax 'start:end' for an
+// array or slice of length n, either start or end can be omitted.
+func parseIndexRange(s string, n int64) (int64, int64, error) {
+	colon := strings.Index(s, ":")
+	if colon < 0 {
+		return 0, 0, fmt.Errorf("%q is not a range, use start:end", s)
+	}
+	start, end := int64(0), n
+	var err error
+	if str := strings.TrimSpace(s[:colon]); str != "" {
+		start, err = strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	if str := strings.TrimSpace(s[colon+1:]); str != "" {
+		end, err = strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	if start < 0 || end > n || start >= end {
+		return 0, 0, fmt.Errorf("range %d:%d out of bounds [0:%d]", start, end, n)
+	}
+	return start, end, nil
 }
 
 func autoloadMore(v *Variable) bool {
@@ -879,12 +1819,106 @@ func autoloadMore(v *Variable) bool {
 	return false
 }
 
+// structField identifies a field of a struct being displayed, so that
+// showExprMenu can change the preferences for it.
+type structField struct {
+	typ string
+	v   *Variable
+}
+
+// structFields contains the struct fields currently being displayed by
+// showStructContents.
+var structFields []structField
+
 func showStructContents(w *nucular.Window, depth int, addr, fullTypes bool, v *Variable) {
-	for i := range v.Children {
-		showVariable(w, depth+1, addr, fullTypes, -1, v.Children[i])
+	visible, hidden := orderStructFields(v.Children, conf.StructFieldPrefs[v.Type])
+	show := func(fields []*Variable) {
+		for _, c := range fields {
+			structFields = append(structFields, structField{v.Type, c})
+			showVariable(w, depth+1, addr, fullTypes, -1, c)
+			structFields = structFields[:len(structFields)-1]
+		}
+	}
+	show(visible)
+	if len(hidden) > 0 {
+		w.Row(varRowHeight).Static()
+		if w.TreePushNamed(nucular.TreeNode, v.Expression+"/hidden", fmt.Sprintf("Show hidden (%d fields)", len(hidden)), false) {
+			show(hidden)
+			w.TreePop()
+		}
 	}
 }
 
+// orderStructFields splits the fields of a struct into visible fields, with
+// pinned fields first, and hidden fields.
+func orderStructFields(children []*Variable, prefs StructFieldPrefs) (visible, hidden []*Variable) {
+	if len(prefs.Hidden) == 0 && len(prefs.Pinned) == 0 {
+		return children, nil
+	}
+	isHidden := map[string]bool{}
+	for _, name := range prefs.Hidden {
+		isHidden[name] = true
+	}
+	isPinned := map[string]bool{}
+	for _, name := range prefs.Pinned {
+		if isHidden[name] {
+			continue
+		}
+		isPinned[name] = true
+		for _, c := range children {
+			if c.Name == name {
+				visible = append(visible, c)
+				break
+			}
+		}
+	}
+	for _, c := range children {
+		switch {
+		case isHidden[c.Name]:
+			hidden = append(hidden, c)
+		case !isPinned[c.Name]:
+			visible = append(visible, c)
+		}
+	}
+	return visible, hidden
+}
+
+// toggleStructFieldPref adds name to the list of fields of typ selected by
+// sel if it isn't there and removes it otherwise.
+func toggleStructFieldPref(typ, name string, sel func(*StructFieldPrefs) *[]string) {
+	if conf.StructFieldPrefs == nil {
+		conf.StructFieldPrefs = make(map[string]StructFieldPrefs)
+	}
+	prefs := conf.StructFieldPrefs[typ]
+	names := sel(&prefs)
+	found := false
+	for i := range *names {
+		if (*names)[i] == name {
+			*names = append((*names)[:i], (*names)[i+1:]...)
+			found = true
+			break
+		}
+	}
+	if !found {
+		*names = append(*names, name)
+	}
+	if len(prefs.Hidden) == 0 && len(prefs.Pinned) == 0 {
+		delete(conf.StructFieldPrefs, typ)
+	} else {
+		conf.StructFieldPrefs[typ] = prefs
+	}
+	saveConfiguration()
+}
+
+func hasFieldName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
 func showInterfaceContents(w *nucular.Window, depth int, addr, fullTypes bool, v *Variable) {
 	if len(v.Children) <= 0 {
 		return
@@ -919,11 +1953,41 @@ func showInterfaceContents(w *nucular.Window, depth int, addr, fullTypes bool, v
 var additionalLoadMu sync.Mutex
 var additionalLoadRunning bool
 
+// mapSliceExpr returns an expression that evaluates to the entries of the
+// map of type typ at addr, starting with the start-th entry.
+func mapSliceExpr(typ string, addr uintptr, start int) string {
+	return fmt.Sprintf("(*(*%q)(%#x))[%d:]", typ, addr, start)
+}
+
+// maxFullMapLen is the maximum number of entries loaded by loadFullMap.
+const maxFullMapLen = 10000
+
+// loadFullMap loads all the entries of map v, which must have been loaded
+// using a configuration with a limit on the number of entries, up to
+// maxFullMapLen. Returns true if the map was truncated.
+func loadFullMap(v *api.Variable) (bool, error) {
+	for int64(len(v.Children)/2) < v.Len {
+		if len(v.Children)/2 >= maxFullMapLen {
+			v.Children = v.Children[:2*maxFullMapLen]
+			return true, nil
+		}
+		lv, err := client.EvalVariable(currentEvalScope(), mapSliceExpr(v.Type, v.Addr, len(v.Children)/2), LongArrayLoadConfig)
+		if err != nil {
+			return false, err
+		}
+		if len(lv.Children) == 0 {
+			return false, fmt.Errorf("could not load entries of %s", v.Name)
+		}
+		v.Children = append(v.Children, lv.Children...)
+	}
+	return false, nil
+}
+
 func loadMoreMap(v *Variable) {
 	if !additionalLoadRunning {
 		additionalLoadRunning = true
 		go func() {
-			expr := fmt.Sprintf("(*(*%q)(%#x))[%d:]", v.Type, v.Addr, len(v.Children)/2)
+			expr := mapSliceExpr(v.Type, v.Addr, len(v.Children)/2)
 			lv, err := client.EvalVariable(currentEvalScope(), expr, LongArrayLoadConfig)
 			if err != nil {
 				out := editorWriter{&scrollbackEditor, true}
@@ -963,11 +2027,41 @@ func loadMoreArrayOrSlice(v *Variable) {
 	}
 }
 
+// maxIndexRangeLen is the maximum number of elements loaded by the index
+// range editor, longer ranges are truncated.
+const maxIndexRangeLen = 1000
+
+func loadArrayOrSliceRange(v *Variable, start, end int64) {
+	if !additionalLoadRunning {
+		additionalLoadRunning = true
+		go func() {
+			out := editorWriter{&scrollbackEditor, true}
+			if end-start > maxIndexRangeLen {
+				fmt.Fprintf(&out, "Range %d:%d is too long, only loading %d:%d\n", start, end, start, start+maxIndexRangeLen)
+				end = start + maxIndexRangeLen
+			}
+			cfg := LongArrayLoadConfig
+			cfg.MaxArrayValues = int(end - start)
+			expr := fmt.Sprintf("(*(*%q)(%#x))[%d:%d]", v.Type, v.Addr, start, end)
+			lv, err := client.EvalVariable(currentEvalScope(), expr, cfg)
+			if err != nil {
+				fmt.Fprintf(&out, "Error loading array contents %s: %v\n", expr, err)
+			} else {
+				v.rangeChildren = wrapApiVariables(lv.Children, v.Kind, int(start), v.Expression, true)
+			}
+			additionalLoadMu.Lock()
+			additionalLoadRunning = false
+			additionalLoadMu.Unlock()
+			wnd.Changed()
+		}()
+	}
+}
+
 func loadMoreStruct(v *Variable) {
 	if !additionalLoadRunning {
 		additionalLoadRunning = true
 		go func() {
-			lv, err := client.EvalVariable(currentEvalScope(), fmt.Sprintf("*(*%q)(%#x)", v.Type, v.Addr), getVariableLoadConfig())
+			lv, err := client.EvalVariable(currentEvalScope(), fmt.Sprintf("*(*%q)(%#x)", v.Type, v.Addr), getVariableLoadConfigForType(v.Type))
 			if err != nil {
 				v.Unreadable = err.Error()
 			} else {
@@ -997,6 +2091,11 @@ func detailsAvailable(v *Variable) openDetailsWindowFn {
 		return newDetailViewer
 	case "[]int", "[]int8", "[]int16", "[]int64", "[]uint", "[]uint16", "[]uint32", "[]uint64":
 		return newDetailViewer
+	case "[]float32", "[]float64":
+		return newDetailViewer
+	}
+	if isMatrixType(v.Type) {
+		return newDetailViewer
 	}
 	return nil
 }
@@ -268,6 +268,8 @@ type Goroutine struct {
 	StartLoc Location `json:"startLoc"`
 	// ID of the associated thread for running goroutines
 	ThreadID int `json:"threadID"`
+	// pprof labels of the goroutine, only sent by newer versions of delve
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 // DebuggerCommand is a command which changes the debugger's execution state.
@@ -337,6 +339,8 @@ const (
 	SwitchGoroutine = "switchGoroutine"
 	// Halt suspends the process.
 	Halt = "halt"
+	// Call resumes process execution injecting a function call.
+	Call = "call"
 )
 
 type AssemblyFlavour int
@@ -425,3 +429,14 @@ type Image struct {
 	Path    string
 	Address uint64
 }
+
+// DumpState describes the state of a core dump in progress
+type DumpState struct {
+	Dumping bool
+	AllDone bool
+
+	ThreadsDone, ThreadsTotal int
+	MemDone, MemTotal         uint64
+
+	Err string
+}
@@ -174,6 +174,16 @@ func (c *RPCClient) StepInstruction() (*api.DebuggerState, error) {
 	return c.exitedToError(&out, err)
 }
 
+// Call injects a function call in the current goroutine and resumes
+// execution until the call returns. The return values of the call are
+// loaded using cfg and stored in the ReturnValues field of the current
+// thread.
+func (c *RPCClient) Call(expr string, cfg *api.LoadConfig, unsafe bool) (*api.DebuggerState, error) {
+	var out CommandOut
+	err := c.call("Command", api.DebuggerCommand{Name: api.Call, ReturnInfoLoadConfig: cfg, Expr: expr, UnsafeCall: unsafe}, &out)
+	return c.exitedToError(&out, err)
+}
+
 func (c *RPCClient) SwitchThread(threadID int) (*api.DebuggerState, error) {
 	var out CommandOut
 	cmd := api.DebuggerCommand{
@@ -459,3 +469,31 @@ func (c *RPCClient) GetStateNonBlocking() (*api.DebuggerState, error) {
 	err := c.call("State", StateIn{NonBlocking: true}, &out)
 	return out.State, err
 }
+
+// CoreDumpStart starts writing a core dump of the target process to dest.
+func (c *RPCClient) CoreDumpStart(dest string) (api.DumpState, error) {
+	var out DumpStartOut
+	err := c.call("DumpStart", DumpStartIn{Destination: dest}, &out)
+	return out.State, err
+}
+
+// CoreDumpWait waits up to msec milliseconds for the core dump in progress
+// to finish and returns its state.
+func (c *RPCClient) CoreDumpWait(msec int) api.DumpState {
+	var out DumpWaitOut
+	c.call("DumpWait", DumpWaitIn{Wait: msec}, &out)
+	return out.State
+}
+
+// CoreDumpCancel cancels the core dump in progress.
+func (c *RPCClient) CoreDumpCancel() error {
+	var out DumpCancelOut
+	return c.call("DumpCancel", DumpCancelIn{}, &out)
+}
+
+// ExamineMemory reads length bytes of memory starting at address.
+func (c *RPCClient) ExamineMemory(address uint64, length int) ([]byte, error) {
+	var out ExaminedMemoryOut
+	err := c.call("ExamineMemory", ExamineMemoryIn{Address: address, Length: length}, &out)
+	return out.Mem, err
+}
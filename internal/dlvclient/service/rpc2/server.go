@@ -319,3 +319,39 @@ type ListDynamicLibrariesIn struct {
 type ListDynamicLibrariesOut struct {
 	List []api.Image
 }
+
+type DumpStartIn struct {
+	// Destination is the path of the core dump to write
+	Destination string
+}
+
+type DumpStartOut struct {
+	State api.DumpState
+}
+
+type DumpWaitIn struct {
+	// Wait is the number of milliseconds to wait for the dump to finish
+	Wait int
+}
+
+type DumpWaitOut struct {
+	State api.DumpState
+}
+
+type DumpCancelIn struct {
+}
+
+type DumpCancelOut struct {
+}
+
+type ExamineMemoryIn struct {
+	// Address is the start of the memory region to read
+	Address uint64
+	// Length is the number of bytes to read
+	Length int
+}
+
+type ExaminedMemoryOut struct {
+	Mem            []byte
+	IsLittleEndian bool
+}
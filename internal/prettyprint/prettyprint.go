@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"sync"
 	"unicode"
 	
 	"github.com/aarzilli/gdlv/internal/dlvclient/service/api"
@@ -408,14 +409,37 @@ func getDisplayType(v *api.Variable, fullTypes bool) string {
 	return ShortenType(v.Type)
 }
 
+// shortTypeCache memoizes the results of ShortenType.
+var shortTypeCache = struct {
+	mu sync.Mutex
+	m  map[string]string
+}{m: make(map[string]string)}
+
 func ShortenType(typ string) string {
-	out, ok := shortenTypeEx(typ)
+	shortTypeCache.mu.Lock()
+	out, ok := shortTypeCache.m[typ]
+	shortTypeCache.mu.Unlock()
+	if ok {
+		return out
+	}
+	out, ok = shortenTypeEx(typ)
 	if !ok {
-		return typ
+		out = typ
 	}
+	shortTypeCache.mu.Lock()
+	shortTypeCache.m[typ] = out
+	shortTypeCache.mu.Unlock()
 	return out
 }
 
+// ClearShortenTypeCache empties the cache used by ShortenType, it should be
+// called when the target process is restarted.
+func ClearShortenTypeCache() {
+	shortTypeCache.mu.Lock()
+	shortTypeCache.m = make(map[string]string)
+	shortTypeCache.mu.Unlock()
+}
+
 func shortenTypeEx(typ string) (string, bool) {
 	switch {
 	case strings.HasPrefix(typ, "[]"):
@@ -62,6 +62,8 @@ func (env *Env) interfaceToStarlarkValue(v interface{}) starlark.Value {
 		return &r
 	case nil:
 		return starlark.None
+	case starlark.Value:
+		return v
 	case error:
 		return starlark.String(v.Error())
 	default:
@@ -282,6 +284,12 @@ type structVariableAsStarlarkValue struct {
 	env *Env
 }
 
+// VariableValue returns v as a starlark value, the same way it is bound to
+// 'x' by Execute.
+func (env *Env) VariableValue(v *api.Variable) starlark.Value {
+	return structVariableAsStarlarkValue{v, env}
+}
+
 var _ starlark.HasAttrs = structVariableAsStarlarkValue{}
 var _ starlark.Mapping = structVariableAsStarlarkValue{}
 
@@ -47,6 +47,9 @@ type Context interface {
 	CallCommand(cmdstr string) error
 	Scope() api.EvalScope
 	LoadConfig() api.LoadConfig
+	CreateBreakpoint(bp *api.Breakpoint) (*api.Breakpoint, error)
+	ClearBreakpoint(id int, name string) (*api.Breakpoint, error)
+	EvalScopedExpr(expr string) *api.Variable
 }
 
 // Env is the environment used to evaluate starlark scripts.
@@ -115,9 +118,106 @@ func New(ctx Context) *Env {
 	env.env[defaultLoadConfigBuiltinName] = starlark.NewBuiltin(defaultLoadConfigBuiltinName, func(_ *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 		return env.interfaceToStarlarkValue(env.ctx.LoadConfig()), nil
 	})
+	env.breakpointBuiltins()
+	env.scopedEvalBuiltin()
 	return env
 }
 
+// scopedEvalBuiltin extends eval so that, when it is called with a single
+// string argument, the argument is evaluated as a scoped expression (for
+// example "@g2f8 x") in the current scope.
+func (env *Env) scopedEvalBuiltin() {
+	rawEval := env.env["eval"].(*starlark.Builtin)
+	env.env["eval"] = starlark.NewBuiltin("eval", func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if len(args) == 1 && len(kwargs) == 0 {
+			if expr, ok := args[0].(starlark.String); ok {
+				if err := isCancelled(thread); err != nil {
+					return starlark.None, decorateError(thread, err)
+				}
+				return env.interfaceToStarlarkValue(rpc2.EvalOut{Variable: env.ctx.EvalScopedExpr(string(expr))}), nil
+			}
+		}
+		return rawEval.CallInternal(thread, args, kwargs)
+	})
+}
+
+// breakpointBuiltins replaces the create_breakpoint and clear_breakpoint
+// API calls with versions that go through the debugger context, so that
+// breakpoints created by scripts are frozen like the ones created by
+// commands.
+func (env *Env) breakpointBuiltins() {
+	env.env["create_breakpoint"] = starlark.NewBuiltin("create_breakpoint", func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if err := isCancelled(thread); err != nil {
+			return starlark.None, decorateError(thread, err)
+		}
+		var rpcArgs rpc2.CreateBreakpointIn
+		var rpcRet rpc2.CreateBreakpointOut
+		if len(args) > 0 && args[0] != starlark.None {
+			err := unmarshalStarlarkValue(args[0], &rpcArgs.Breakpoint, "Breakpoint")
+			if err != nil {
+				return starlark.None, decorateError(thread, err)
+			}
+		}
+		for _, kv := range kwargs {
+			var err error
+			switch kv[0].(starlark.String) {
+			case "Breakpoint":
+				err = unmarshalStarlarkValue(kv[1], &rpcArgs.Breakpoint, "Breakpoint")
+			default:
+				err = fmt.Errorf("unknown argument %q", kv[0])
+			}
+			if err != nil {
+				return starlark.None, decorateError(thread, err)
+			}
+		}
+		bp, err := env.ctx.CreateBreakpoint(&rpcArgs.Breakpoint)
+		if err != nil {
+			return starlark.None, err
+		}
+		rpcRet.Breakpoint = *bp
+		return env.interfaceToStarlarkValue(rpcRet), nil
+	})
+	env.env["clear_breakpoint"] = starlark.NewBuiltin("clear_breakpoint", func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if err := isCancelled(thread); err != nil {
+			return starlark.None, decorateError(thread, err)
+		}
+		var rpcArgs rpc2.ClearBreakpointIn
+		var rpcRet rpc2.ClearBreakpointOut
+		if len(args) > 0 && args[0] != starlark.None {
+			err := unmarshalStarlarkValue(args[0], &rpcArgs.Id, "Id")
+			if err != nil {
+				return starlark.None, decorateError(thread, err)
+			}
+		}
+		if len(args) > 1 && args[1] != starlark.None {
+			err := unmarshalStarlarkValue(args[1], &rpcArgs.Name, "Name")
+			if err != nil {
+				return starlark.None, decorateError(thread, err)
+			}
+		}
+		for _, kv := range kwargs {
+			var err error
+			switch kv[0].(starlark.String) {
+			case "Id":
+				err = unmarshalStarlarkValue(kv[1], &rpcArgs.Id, "Id")
+			case "Name":
+				err = unmarshalStarlarkValue(kv[1], &rpcArgs.Name, "Name")
+			default:
+				err = fmt.Errorf("unknown argument %q", kv[0])
+			}
+			if err != nil {
+				return starlark.None, decorateError(thread, err)
+			}
+		}
+		bp, err := env.ctx.ClearBreakpoint(rpcArgs.Id, rpcArgs.Name)
+		if err != nil {
+			return starlark.None, err
+		}
+		rpcRet.Breakpoint = bp
+		return env.interfaceToStarlarkValue(rpcRet), nil
+	})
+}
+
 // Execute executes a script. Path is the name of the file to execute and
 // source is the source code to execute.
 // Source can be either a []byte, a string or a io.Reader. If source is nil
@@ -180,6 +280,21 @@ func (env *Env) Execute(out io.Writer, path string, source interface{}, mainFnNa
 	return env.callMain(thread, globals, mainFnName, args)
 }
 
+// SetGlobal binds the value of v to name in the global namespace, making
+// it available to all subsequently executed scripts.
+func (env *Env) SetGlobal(name string, v *api.Variable) error {
+	sv, err := env.variableValueToStarlarkValue(v, true)
+	if err != nil {
+		return err
+	}
+	if sv == nil {
+		// no direct conversion for this kind, expose the api.Variable itself
+		sv = env.interfaceToStarlarkValue(*v)
+	}
+	env.env[name] = sv
+	return nil
+}
+
 // Cancel cancels the execution of a currently running script or function.
 func (env *Env) Cancel() {
 	if env == nil {
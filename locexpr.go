@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// dwarfRegs describes the DWARF registers of an architecture.
+type dwarfRegs struct {
+	names []string        // register names, indexed by DWARF register number
+	stack map[string]bool // registers pointing into the stack
+}
+
+var amd64DwarfRegs = &dwarfRegs{
+	names: []string{
+		"rax", "rdx", "rcx", "rbx", "rsi", "rdi", "rbp", "rsp",
+		"r8", "r9", "r10", "r11", "r12", "r13", "r14", "r15",
+		"rip",
+		"xmm0", "xmm1", "xmm2", "xmm3", "xmm4", "xmm5", "xmm6", "xmm7",
+		"xmm8", "xmm9", "xmm10", "xmm11", "xmm12", "xmm13", "xmm14", "xmm15",
+	},
+	stack: map[string]bool{"rsp": true, "rbp": true},
+}
+
+var arm64DwarfRegs = &dwarfRegs{
+	names: []string{
+		"x0", "x1", "x2", "x3", "x4", "x5", "x6", "x7",
+		"x8", "x9", "x10", "x11", "x12", "x13", "x14", "x15",
+		"x16", "x17", "x18", "x19", "x20", "x21", "x22", "x23",
+		"x24", "x25", "x26", "x27", "x28", "x29", "x30", "sp",
+		"pc",
+	},
+	stack: map[string]bool{"sp": true, "x29": true},
+}
+
+// targetDwarfRegs returns the DWARF registers of the architecture of the
+// target, guessed from the names of its registers, or nil if the
+// architecture is not known.
+func targetDwarfRegs() *dwarfRegs {
+	regs, err := client.ListRegisters(0, false)
+	if err != nil {
+		return nil
+	}
+	for _, reg := range regs {
+		switch strings.ToLower(reg.Name) {
+		case "rip":
+			return amd64DwarfRegs
+		case "x0":
+			return arm64DwarfRegs
+		}
+	}
+	return nil
+}
+
+// name returns the name of DWARF register n, regs can be nil if the
+// architecture of the target is not known.
+func (regs *dwarfRegs) name(n int64) string {
+	if regs != nil && n >= 0 && n < int64(len(regs.names)) {
+		return regs.names[n]
+	}
+	return fmt.Sprintf("with DWARF number %d", n)
+}
+
+type locOp struct {
+	name string
+	args []int64
+}
+
+// parseLocationExpr parses a location expression as formatted by delve,
+// for example "[block] DW_OP_fbreg -0x18 ".
+func parseLocationExpr(s string) ([]locOp, error) {
+	var ops []locOp
+	for _, tok := range strings.Fields(s) {
+		if strings.HasPrefix(tok, "[") {
+			continue
+		}
+		if strings.HasPrefix(tok, "DW_OP_") {
+			if i := strings.Index(tok, "("); i >= 0 {
+				tok = tok[:i]
+			}
+			ops = append(ops, locOp{name: tok[len("DW_OP_"):]})
+			continue
+		}
+		if len(ops) == 0 {
+			return nil, fmt.Errorf("unexpected %q", tok)
+		}
+		n, err := strconv.ParseInt(tok, 0, 64)
+		if err != nil {
+			u, err2 := strconv.ParseUint(tok, 0, 64)
+			if err2 != nil {
+				return nil, fmt.Errorf("could not parse argument %q of DW_OP_%s", tok, ops[len(ops)-1].name)
+			}
+			n = int64(u)
+		}
+		ops[len(ops)-1].args = append(ops[len(ops)-1].args, n)
+	}
+	return ops, nil
+}
+
+// describeLocationExpr returns a human readable description of the
+// location expression s, registers are named according to regs.
+func describeLocationExpr(s string, regs *dwarfRegs) string {
+	ops, err := parseLocationExpr(s)
+	if err != nil {
+		return fmt.Sprintf("could not decode location expression: %v", err)
+	}
+	if len(ops) == 0 {
+		return "no location (optimized out)"
+	}
+
+	var pieces []string
+	var cur []locOp
+	off := int64(0)
+	for _, op := range ops {
+		if op.name != "piece" {
+			cur = append(cur, op)
+			continue
+		}
+		sz := int64(0)
+		if len(op.args) > 0 {
+			sz = op.args[0]
+		}
+		pieces = append(pieces, fmt.Sprintf("bytes %d-%d %s", off, off+sz-1, describeLocationOps(cur, regs)))
+		off += sz
+		cur = nil
+	}
+	if pieces == nil {
+		return describeLocationOps(cur, regs)
+	}
+	if len(cur) > 0 {
+		pieces = append(pieces, describeLocationOps(cur, regs))
+	}
+	return strings.Join(pieces, ", ")
+}
+
+func describeLocationOps(ops []locOp, regs *dwarfRegs) string {
+	arg := func(op locOp) int64 {
+		if len(op.args) > 0 {
+			return op.args[0]
+		}
+		return 0
+	}
+
+	if len(ops) == 0 {
+		return "optimized out"
+	}
+	if ops[len(ops)-1].name == "stack_value" {
+		return "not in memory, its value is computed"
+	}
+
+	switch {
+	case len(ops) == 1 && strings.HasPrefix(ops[0].name, "reg") && ops[0].name != "regx":
+		n, err := strconv.Atoi(ops[0].name[len("reg"):])
+		if err == nil {
+			return "in register " + regs.name(int64(n))
+		}
+	case len(ops) == 1 && ops[0].name == "regx":
+		return "in register " + regs.name(arg(ops[0]))
+	case len(ops) == 1 && ops[0].name == "fbreg":
+		return fmt.Sprintf("on the stack at frame base%+d", arg(ops[0]))
+	case len(ops) == 1 && ops[0].name == "call_frame_cfa":
+		return "on the stack at CFA"
+	case len(ops) == 3 && ops[0].name == "call_frame_cfa" && ops[1].name == "consts" && ops[2].name == "plus":
+		return fmt.Sprintf("on the stack at CFA%+d", arg(ops[1]))
+	case len(ops) == 1 && ops[0].name == "addr":
+		return fmt.Sprintf("in static memory at %#x", uint64(arg(ops[0])))
+	case len(ops) == 1 && strings.HasPrefix(ops[0].name, "breg") && ops[0].name != "bregx":
+		n, err := strconv.Atoi(ops[0].name[len("breg"):])
+		if err == nil {
+			reg := regs.name(int64(n))
+			if regs != nil && regs.stack[reg] {
+				return fmt.Sprintf("on the stack at %s%+d", reg, arg(ops[0]))
+			}
+			return fmt.Sprintf("in memory at %s%+d", reg, arg(ops[0]))
+		}
+	}
+
+	v := make([]string, len(ops))
+	for i, op := range ops {
+		v[i] = "DW_OP_" + op.name
+		for _, a := range op.args {
+			v[i] += fmt.Sprintf(" %#x", a)
+		}
+	}
+	return "computed by " + strings.Join(v, " ")
+}
@@ -43,6 +43,7 @@ var boldFace font.Face
 const (
 	arrowIconChar      = "\uf061"
 	breakpointIconChar = "\uf28d"
+	bookmarkIconChar   = "\uf02e"
 
 	interruptIconChar = "\uf04c"
 	continueIconChar  = "\uf04b"
@@ -154,14 +155,28 @@ var listingPanel struct {
 	text                api.AsmInstructions
 	framePC             uint64
 	pinnedLoc           *api.Location
+	cursorLine          int // last line clicked by the user, 0 if none
 	stale               bool
 	optimized           bool
 	id                  int
 
 	stepIntoInfo   stepIntoInfo
 	stepIntoFilled bool
+
+	annotations map[int]string // values of the variables declared on each line
+
+	tabs    []listingTab // recently viewed files
+	tabUses int
 }
 
+type listingTab struct {
+	file string
+	line int
+	used int
+}
+
+const maxListingTabs = 8
+
 var wnd nucular.MasterWindow
 
 var nextInProgress bool
@@ -203,16 +218,42 @@ func guiUpdate(w *nucular.Window) {
 			setupStyle()
 
 		case (e.Modifiers == key.ModControl) && (e.Code == key.CodeF):
+			scrollbackFind.open(mw)
+
+		case (e.Modifiers == key.ModControl|key.ModShift) && (e.Code == key.CodeF):
 			mw.SetPerf(!mw.GetPerf())
 
 		case (e.Modifiers == 0) && (e.Code == key.CodeEscape):
 			mw.ActivateEditor(&commandLineEditor)
 
+		case (e.Modifiers == 0) && (e.Code == key.CodeF2):
+			jumpToBookmark(+1)
+
+		case (e.Modifiers == key.ModShift) && (e.Code == key.CodeF2):
+			jumpToBookmark(-1)
+
+		case (e.Modifiers == key.ModControl) && (e.Code == key.CodeF2):
+			if file, lineno, ok := listingCursorOrPC(); ok {
+				toggleBookmark(file, lineno)
+			}
+
+		case (e.Modifiers == 0) && (e.Code == key.CodeF4):
+			if !client.Running() && client != nil {
+				if file, line, ok := listingCursor(); ok {
+					go continueToLine(file, line)
+				}
+			}
+
 		case (e.Modifiers == 0) && (e.Code == key.CodeF5):
 			if !client.Running() && client != nil {
 				doCommand("continue")
 			}
 
+		case (e.Modifiers == 0) && (e.Code == key.CodeF9):
+			if client != nil {
+				go toggleListingBreakpoint()
+			}
+
 		case (e.Modifiers == 0) && (e.Code == key.CodeF10):
 			fallthrough
 		case (e.Modifiers == key.ModAlt) && (e.Code == key.CodeRightArrow):
@@ -227,6 +268,11 @@ func guiUpdate(w *nucular.Window) {
 				doCommand("step")
 			}
 
+		case (e.Modifiers == key.ModControl) && (e.Code == key.CodeF11):
+			if !client.Running() && client != nil {
+				openStepIntoChooser(mw)
+			}
+
 		case (e.Modifiers == key.ModShift) && (e.Code == key.CodeF11):
 			fallthrough
 		case (e.Modifiers == key.ModAlt) && (e.Code == key.CodeUpArrow):
@@ -234,6 +280,11 @@ func guiUpdate(w *nucular.Window) {
 				doCommand("stepout")
 			}
 
+		case (e.Modifiers == key.ModControl|key.ModShift) && (e.Code == key.CodeF5):
+			if client != nil {
+				doCommand("interrupt -cancel")
+			}
+
 		case (e.Modifiers == key.ModShift) && (e.Code == key.CodeF5):
 			fallthrough
 		case (e.Modifiers == key.ModControl) && (e.Code == key.CodeDeleteForward):
@@ -337,12 +388,34 @@ func updateCommandPanel(w *nucular.Window) {
 	style := w.Master().Style()
 
 	w.Row(headerRow).Static()
-	w.LayoutReserveRow(commandLineHeight, 1)
+	if scrollbackFind.active {
+		w.LayoutReserveRow(commandLineHeight, 2)
+	} else {
+		w.LayoutReserveRow(commandLineHeight, 1)
+	}
 	commandToolbar(w)
 
+	if scrollbackEditor.Active {
+		// Ctrl-F opens the find bar instead of the editor's find popup
+		kbd := &w.Input().Keyboard
+		keys := kbd.Keys[:0]
+		for _, k := range kbd.Keys {
+			if k.Modifiers != key.ModControl || k.Code != key.CodeF {
+				keys = append(keys, k)
+			}
+		}
+		kbd.Keys = keys
+	}
+
 	w.Row(0).Dynamic(1)
+	firstcmd := len(w.Commands().Commands)
 	scrollbackEditor.Edit(w)
 	scrollbackEditorRect = w.LastWidgetBounds
+	colorScrollback(w, firstcmd, scrollbackEditorRect)
+
+	if scrollbackFind.active {
+		findBar(w)
+	}
 
 	p := currentPrompt()
 	p2 := p
@@ -420,31 +493,7 @@ func updateCommandPanel(w *nucular.Window) {
 	active := commandLineEditor.Edit(w)
 	if active&nucular.EditCommitted != 0 {
 		historySearch = false
-		var scrollbackOut = editorWriter{&scrollbackEditor, false}
-		cmd := string(commandLineEditor.Buffer)
-		if scriptRunning {
-			fmt.Fprintf(&scrollbackOut, "a script is running\n")
-		} else if starlarkMode != nil {
-			cmdhistory = append(cmdhistory, cmd)
-			fmt.Fprintf(&scrollbackOut, "%s %s\n", p, cmd)
-			starlarkMode <- cmd
-		} else if canExecuteCmd(cmd) && !client.Running() {
-			if cmd == "" {
-				fmt.Fprintf(&scrollbackOut, "%s %s\n", p, cmdhistory[len(cmdhistory)-1])
-			} else {
-				cmdhistory = append(cmdhistory, cmd)
-				fmt.Fprintf(&scrollbackOut, "%s %s\n", p, cmd)
-			}
-			historyShown = len(cmdhistory)
-			go executeCommand(cmd)
-		} else if client.Running() && client != nil && BackendServer.stdinChan != nil && curThread >= 0 {
-			select {
-			case BackendServer.stdinChan <- cmd + "\n":
-			default:
-			}
-		} else {
-			fmt.Fprintf(&scrollbackOut, "Only quit and restart available when not connected to delve\n")
-		}
+		submitCommandLine(p, string(commandLineEditor.Buffer))
 		commandLineEditor.Buffer = commandLineEditor.Buffer[:0]
 		commandLineEditor.Cursor = 0
 		commandLineEditor.CursorFollow = true
@@ -452,6 +501,36 @@ func updateCommandPanel(w *nucular.Window) {
 	}
 }
 
+// submitCommandLine handles cmd as a line entered in the command line with
+// prompt p: it is sent to the starlark REPL, executed as a command or
+// written to the standard input of the running target.
+func submitCommandLine(p, cmd string) {
+	var scrollbackOut = editorWriter{&scrollbackEditor, false}
+	if scriptRunning {
+		fmt.Fprintf(&scrollbackOut, "a script is running\n")
+	} else if starlarkMode != nil {
+		cmdhistory = append(cmdhistory, cmd)
+		fmt.Fprintf(&scrollbackOut, "%s %s\n", p, cmd)
+		starlarkMode <- cmd
+	} else if canExecuteCmd(cmd) && !client.Running() {
+		if cmd == "" {
+			fmt.Fprintf(&scrollbackOut, "%s %s\n", p, cmdhistory[len(cmdhistory)-1])
+		} else {
+			cmdhistory = append(cmdhistory, cmd)
+			fmt.Fprintf(&scrollbackOut, "%s %s\n", p, cmd)
+		}
+		historyShown = len(cmdhistory)
+		go executeCommand(cmd)
+	} else if client.Running() && client != nil && BackendServer.stdinChan != nil && curThread >= 0 {
+		select {
+		case BackendServer.stdinChan <- cmd + "\n":
+		default:
+		}
+	} else {
+		fmt.Fprintf(&scrollbackOut, "Only quit and restart available when not connected to delve\n")
+	}
+}
+
 func searchHistory() {
 	if historyShown < 0 || historyShown >= len(cmdhistory) {
 		historyShown = len(cmdhistory) - 1
@@ -574,6 +653,7 @@ func refreshState(toframe refreshToFrame, clearKind clearKind, state *api.Debugg
 			listingPanel.id++
 			if clearKind != clearBreakpoint {
 				loadListing(listingPanel.pinnedLoc, failstate)
+				loadListingAnnotations()
 			}
 
 			wnd.Unlock()
@@ -617,9 +697,11 @@ func refreshState(toframe refreshToFrame, clearKind clearKind, state *api.Debugg
 		listingPanel.pinnedLoc = nil
 	case clearStop:
 		localsPanel.asyncLoad.clear()
+		localsPanel.returns = nil
 		regsPanel.asyncLoad.clear()
 		goroutinesPanel.asyncLoad.clear()
 		stackPanel.asyncLoad.clear()
+		stackTreePanel.asyncLoad.clear()
 		threadsPanel.asyncLoad.clear()
 		globalsPanel.asyncLoad.clear()
 		breakpointsPanel.asyncLoad.clear()
@@ -727,13 +809,22 @@ func refreshState(toframe refreshToFrame, clearKind clearKind, state *api.Debugg
 
 	if clearKind != clearBreakpoint {
 		loadListing(loc, failstate)
+		loadListingAnnotations()
+	}
+
+	if clearKind == clearStop {
+		repinExpressions()
+		loadWatches()
 	}
 
 	applyBreakpoints(failstate)
 
 	wnd.Walk(func(title string, data interface{}, docked bool, splitSize int, rect rect.Rect) {
 		if asyncLoad, ok := data.(*asyncLoad); ok && asyncLoad != nil {
-			if title == "Details" && clearKind != clearNothing && clearKind != clearBreakpoint {
+			if ((cleanWindowTitle(title) == "Details" && detailViewerIsLive(asyncLoad)) || title == memWatchTitle) && clearKind != clearNothing && clearKind != clearBreakpoint {
+				if clearKind == clearStop && cleanWindowTitle(title) == "Details" {
+					detailViewerStopped(asyncLoad)
+				}
 				asyncLoad.clear()
 			}
 			asyncLoad.startLoad()
@@ -768,6 +859,29 @@ func loadDisassembly(p *asyncLoad) {
 	p.done(nil)
 }
 
+// addListingTab adds file to the tabs of the listing panel, evicting the
+// least recently viewed tab if there are too many.
+func addListingTab(file string, line int) {
+	listingPanel.tabUses++
+	for i := range listingPanel.tabs {
+		if listingPanel.tabs[i].file == file {
+			listingPanel.tabs[i].line = line
+			listingPanel.tabs[i].used = listingPanel.tabUses
+			return
+		}
+	}
+	if len(listingPanel.tabs) >= maxListingTabs {
+		lru := 0
+		for i := range listingPanel.tabs {
+			if listingPanel.tabs[i].used < listingPanel.tabs[lru].used {
+				lru = i
+			}
+		}
+		listingPanel.tabs = append(listingPanel.tabs[:lru], listingPanel.tabs[lru+1:]...)
+	}
+	listingPanel.tabs = append(listingPanel.tabs, listingTab{file, line, listingPanel.tabUses})
+}
+
 func loadListing(loc *api.Location, failstate func(string, error)) {
 	listingPanel.listing = listingPanel.listing[:0]
 	listingPanel.recenterListing = true
@@ -783,6 +897,9 @@ func loadListing(loc *api.Location, failstate func(string, error)) {
 		return
 	}
 
+	if loc.File != listingPanel.file {
+		listingPanel.cursorLine = 0
+	}
 	listingPanel.file = loc.File
 	listingPanel.abbrevFile = abbrevFileName(loc.File)
 
@@ -790,6 +907,8 @@ func loadListing(loc *api.Location, failstate func(string, error)) {
 		return
 	}
 
+	addListingTab(loc.File, loc.Line)
+
 	fh, err := os.Open(conf.substitutePath(loc.File))
 	if err != nil {
 		failstate("Open()", err)
@@ -906,6 +1025,8 @@ Executes "gdlv run" using mozilla rr has a backend.
 Options must appear before the command and include:
 
 	-d <dir>	builds inside the specified directory instead of the current directory (for debug and test)
+	-init <file>	executes the commands in file, one per line, after connecting to the target
+	-continue-on-error	keeps executing the -init file after a command fails
 `)
 	os.Exit(1)
 }
@@ -925,6 +1046,16 @@ optionsLoop:
 			}
 			opts.buildDir = args[i]
 			i++
+		case "-init":
+			i++
+			if i >= len(args) {
+				usage("wrong number of arguments after -init")
+			}
+			opts.initScript = args[i]
+			i++
+		case "-continue-on-error":
+			opts.continueOnError = true
+			i++
 		default:
 			break optionsLoop
 		}
@@ -952,11 +1083,13 @@ optionsLoop:
 }
 
 type commandLineOptions struct {
-	cmd            string
-	cmdArgs        []string
-	backend        string
-	defaultBackend bool
-	buildDir       string
+	cmd             string
+	cmdArgs         []string
+	backend         string
+	defaultBackend  bool
+	buildDir        string
+	initScript      string
+	continueOnError bool
 }
 
 func main() {
@@ -966,6 +1099,9 @@ func main() {
 	}
 
 	loadConfiguration()
+	loadEnvSubstitutePath()
+	loadHistory()
+	go loadGoRoots()
 
 	if profileEnabled {
 		if f, err := os.Create("cpu.pprof"); err == nil {
@@ -991,6 +1127,9 @@ func main() {
 		FrozenBreakpoints = append(FrozenBreakpoints[:0], conf.FrozenBreakpoints[BackendServer.debugid]...)
 		DisabledBreakpoints = append(DisabledBreakpoints[:0], conf.DisabledBreakpoints[BackendServer.debugid]...)
 	}
+	if BackendServer.debugid != "" && conf.MonitoredExpressions != nil {
+		MonitoredExpressions = append(MonitoredExpressions[:0], conf.MonitoredExpressions[BackendServer.debugid]...)
+	}
 
 	loadPanelDescrToplevel(conf.Layouts["default"].Layout)
 
@@ -1017,5 +1156,6 @@ under certain conditions; see COPYING for details.
 
 	wnd.Main()
 
+	saveHistory()
 	BackendServer.Close()
 }
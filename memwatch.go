@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/aarzilli/nucular"
+	"github.com/aarzilli/nucular/rect"
+
+	"github.com/aarzilli/gdlv/internal/dlvclient/service/api"
+)
+
+const (
+	memWatchTitle          = "Memory"
+	memWatchDefaultLength  = 64
+	memWatchMaxLength      = 4096
+	memWatchMaxRead        = 1000 // maximum length accepted by ExamineMemory
+	memWatchBytesPerLine   = 16
+	memWatchAddrWidth      = 140
+	memWatchByteWidth      = 24
+	memWatchPrintableWidth = 160
+)
+
+var memWatchChangedColor = color.RGBA{0xff, 0x80, 0x00, 0xff}
+
+// memWatch is a window showing a region of memory, the region is read
+// again every time the target stops and the bytes that changed since the
+// last stop are highlighted.
+type memWatch struct {
+	asyncLoad asyncLoad
+
+	exprEd nucular.TextEditor
+	length int
+
+	addr uint64
+	mem  []byte
+	prev []byte
+	err  error
+}
+
+func memwatchCommand(out io.Writer, args string) error {
+	argv := strings.Fields(args)
+	if len(argv) < 1 || len(argv) > 2 {
+		return errors.New("wrong number of arguments: memwatch <expr> [<len>]")
+	}
+	length := memWatchDefaultLength
+	if len(argv) == 2 {
+		var err error
+		length, err = strconv.Atoi(argv[1])
+		if err != nil {
+			return fmt.Errorf("could not parse length: %v", err)
+		}
+	}
+	newMemWatch(wnd, argv[0], length)
+	return nil
+}
+
+func newMemWatch(mw nucular.MasterWindow, expr string, length int) {
+	m := &memWatch{length: length}
+	if m.length <= 0 || m.length > memWatchMaxLength {
+		m.length = memWatchDefaultLength
+	}
+	m.asyncLoad.load = m.load
+	m.exprEd.Flags = nucular.EditSelectable | nucular.EditClipboard | nucular.EditSigEnter
+	m.exprEd.Buffer = []rune(expr)
+	mw.PopupOpen(memWatchTitle, popupFlags|nucular.WindowNonmodal|nucular.WindowScalable|nucular.WindowClosable, rect.Rect{100, 100, 800, 400}, true, m.Update)
+}
+
+// variableAddress returns the address described by v: the value of
+// pointers and integers, the address of the backing array of slices and
+// strings and the address of v itself for everything else.
+func variableAddress(v *api.Variable) (uint64, error) {
+	if v.Unreadable != "" {
+		return 0, errors.New(v.Unreadable)
+	}
+	switch v.Kind {
+	case reflect.Ptr, reflect.UnsafePointer:
+		if len(v.Children) > 0 {
+			return uint64(v.Children[0].Addr), nil
+		}
+		return 0, errors.New("could not read pointer value")
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.ParseUint(v.Value, 0, 64)
+	case reflect.Slice, reflect.String:
+		return uint64(v.Base), nil
+	default:
+		if v.Addr == 0 {
+			return 0, fmt.Errorf("%s does not have an address", v.Name)
+		}
+		return uint64(v.Addr), nil
+	}
+}
+
+func (m *memWatch) load(p *asyncLoad) {
+	v := evalScopedExpr(string(m.exprEd.Buffer), api.LoadConfig{})
+	addr, err := variableAddress(v)
+	var mem []byte
+	if err == nil {
+		mem, err = examineMemory(addr, m.length)
+	}
+	if err == nil && addr == m.addr && len(m.mem) == len(mem) {
+		m.prev = m.mem
+	} else {
+		m.prev = nil
+	}
+	m.addr, m.mem, m.err = addr, mem, err
+	if p != nil {
+		p.done(nil)
+	}
+}
+
+// examineMemory reads length bytes starting at addr, using as many calls
+// to ExamineMemory as needed.
+func examineMemory(addr uint64, length int) ([]byte, error) {
+	mem := make([]byte, 0, length)
+	for len(mem) < length {
+		n := length - len(mem)
+		if n > memWatchMaxRead {
+			n = memWatchMaxRead
+		}
+		buf, err := client.ExamineMemory(addr+uint64(len(mem)), n)
+		if err != nil {
+			return nil, err
+		}
+		if len(buf) == 0 {
+			break
+		}
+		mem = append(mem, buf...)
+	}
+	return mem, nil
+}
+
+func (m *memWatch) Update(container *nucular.Window) {
+	w := m.asyncLoad.showRequest(container)
+	if w == nil {
+		return
+	}
+
+	w.Row(30).Static(100, 0, 150, 80)
+	w.Label("Address: ", "LC")
+	active := m.exprEd.Edit(w)
+	if active&nucular.EditCommitted != 0 {
+		m.load(nil)
+	}
+	if w.PropertyInt("Length:", 1, &m.length, memWatchMaxLength, memWatchBytesPerLine, memWatchBytesPerLine) {
+		m.load(nil)
+	}
+	if w.ButtonText("Reload") {
+		m.load(nil)
+	}
+
+	if m.err != nil {
+		w.Row(30).Dynamic(1)
+		w.Label(m.err.Error(), "LC")
+		return
+	}
+
+	widths := []int{memWatchAddrWidth}
+	for i := 0; i < memWatchBytesPerLine; i++ {
+		widths = append(widths, memWatchByteWidth)
+	}
+	widths = append(widths, memWatchPrintableWidth)
+
+	for start := 0; start < len(m.mem); start += memWatchBytesPerLine {
+		w.Row(varRowHeight).Static(widths...)
+		w.Label(fmt.Sprintf("%#x", m.addr+uint64(start)), "LC")
+		printable := make([]byte, 0, memWatchBytesPerLine)
+		for i := start; i < start+memWatchBytesPerLine; i++ {
+			if i >= len(m.mem) {
+				w.Spacing(1)
+				continue
+			}
+			b := m.mem[i]
+			if m.prev != nil && m.prev[i] != b {
+				w.LabelColored(fmt.Sprintf("%02x", b), "LC", memWatchChangedColor)
+			} else {
+				w.Label(fmt.Sprintf("%02x", b), "LC")
+			}
+			if b >= 0x20 && b < 0x7f {
+				printable = append(printable, b)
+			} else {
+				printable = append(printable, '.')
+			}
+		}
+		w.Label(string(printable), "LC")
+	}
+}
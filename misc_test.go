@@ -1,12 +1,25 @@
 package main
 
 import (
+	"encoding/json"
+	"go/parser"
+	"go/token"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
 	"testing"
+	"time"
+
+	"github.com/aarzilli/gdlv/internal/dlvclient/service/api"
+	"github.com/aarzilli/gdlv/internal/prettyprint"
 )
 
 func TestShortenType(t *testing.T) {
 	c := func(src, tgt string) {
-		out := shortenType(src)
+		out := prettyprint.ShortenType(src)
 		if out != tgt {
 			t.Errorf("for %q expected %q got %q", src, tgt, out)
 		} else {
@@ -56,3 +69,1050 @@ func TestAutowrap(t *testing.T) {
 	c("something\nsomething1111", "blah", 10, "something\nsomething1111\nblah")
 	c("something\nsomething1111", "", 10, "something\nsomething1111")
 }
+
+func TestExprHasRoot(t *testing.T) {
+	c := func(expr, root string, tgt bool) {
+		if o := exprHasRoot(expr, root); o != tgt {
+			t.Errorf("for %q (root %q) expected %v got %v", expr, root, tgt, o)
+		}
+	}
+
+	c("a", "a", true)
+	c("a.b", "a", true)
+	c("a[2].c", "a", true)
+	c("(*(a.p)).x", "a", true)
+	c("ab", "a", false)
+	c("b.a", "a", false)
+}
+
+func TestFloatSpecial(t *testing.T) {
+	c := func(kind reflect.Kind, value, tgt string) {
+		if o := floatSpecial(&api.Variable{Kind: kind, Value: value}); o != tgt {
+			t.Errorf("for %q (%v) expected %q got %q", value, kind, tgt, o)
+		}
+	}
+
+	c(reflect.Float64, "1.5", "")
+	c(reflect.Float64, "0", "")
+	c(reflect.Float64, "NaN", "NaN")
+	c(reflect.Float64, "+Inf", "+Inf")
+	c(reflect.Float64, "-Inf", "-Inf")
+	c(reflect.Float64, "5e-324", "denormal")
+	c(reflect.Float64, "1e-39", "")
+	c(reflect.Float32, "1e-39", "denormal")
+	c(reflect.Int, "NaN", "")
+}
+
+func TestSyscallName(t *testing.T) {
+	c := func(kind string, fns []string, tgt string) {
+		frames := make([]api.Stackframe, len(fns))
+		for i := range fns {
+			frames[i].Function = &api.Function{Name_: fns[i]}
+		}
+		if o := syscallName(kind, frames); o != tgt {
+			t.Errorf("for %v (%s) expected %q got %q", fns, kind, tgt, o)
+		}
+	}
+
+	c("syscall", []string{"syscall.Syscall", "syscall.read", "syscall.Read", "internal/poll.(*FD).Read", "os.(*File).Read"}, "syscall.Read")
+	c("cgo", []string{"runtime.cgocall", "main._Cfunc_sleep", "main.main"}, "sleep")
+	c("cgo", []string{"runtime.cgocall", "main.main"}, "?")
+}
+
+func TestSplitAssignment(t *testing.T) {
+	c := func(src, tgtl, tgtr string) {
+		l, r, err := splitAssignment(src)
+		if tgtl == "" {
+			if err == nil {
+				t.Errorf("for %q expected error got %q %q", src, l, r)
+			}
+			return
+		}
+		if err != nil {
+			t.Errorf("for %q unexpected error %v", src, err)
+			return
+		}
+		if l != tgtl || r != tgtr {
+			t.Errorf("for %q expected %q %q got %q %q", src, tgtl, tgtr, l, r)
+		}
+	}
+
+	c("a = 1", "a", "1")
+	c("b = x == y", "b", "x == y")
+	c("arr[2] = 7", "arr[2]", "7")
+	c("s.f = m[\"a=b\"]", "s.f", "m[\"a=b\"]")
+	c("a == b", "", "")
+	c("a = ", "", "")
+	c("a != b", "", "")
+}
+
+func TestFormatBig(t *testing.T) {
+	nat := func(words ...string) api.Variable {
+		v := api.Variable{Name: "abs", Kind: reflect.Slice, Len: int64(len(words))}
+		for _, w := range words {
+			v.Children = append(v.Children, api.Variable{Kind: reflect.Uint, Value: w})
+		}
+		return v
+	}
+	bigint := func(name string, neg bool, words ...string) api.Variable {
+		return api.Variable{Name: name, Type: "math/big.Int", Kind: reflect.Struct, Children: []api.Variable{
+			{Name: "neg", Kind: reflect.Bool, Value: strconv.FormatBool(neg)},
+			nat(words...),
+		}}
+	}
+
+	x := bigint("", true, "1", "1")
+	if o, tgt := formatBigInt(&x), "-18446744073709551617"; o != tgt {
+		t.Errorf("big.Int: expected %q got %q", tgt, o)
+	}
+
+	r := api.Variable{Type: "math/big.Rat", Kind: reflect.Struct, Children: []api.Variable{bigint("a", false, "3"), bigint("b", false, "4")}}
+	if o, tgt := formatBigRat(&r), "3/4"; o != tgt {
+		t.Errorf("big.Rat: expected %q got %q", tgt, o)
+	}
+
+	f := api.Variable{Type: "math/big.Float", Kind: reflect.Struct, Children: []api.Variable{
+		{Name: "prec", Value: "53"},
+		{Name: "form", Value: "1"},
+		{Name: "neg", Value: "false"},
+		nat("13835058055282163712"), // 0xc000000000000000
+		{Name: "exp", Value: "2"},
+	}}
+	f.Children[3].Name = "mant"
+	if o, tgt := formatBigFloat(&f), "3"; o != tgt {
+		t.Errorf("big.Float: expected %q got %q", tgt, o)
+	}
+}
+
+func TestEnumConstNames(t *testing.T) {
+	const src = `package p
+
+type State int
+
+const (
+	StateIdle State = iota
+	StateRunning
+	_
+	StateDone
+	Other = 3
+	StateUnknown State = -1
+)
+
+const StateStopped = State(10)
+
+const NotAState = int(2)
+`
+	f, err := parser.ParseFile(token.NewFileSet(), "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tgt := []string{"StateIdle", "StateRunning", "StateDone", "StateUnknown", "StateStopped"}
+	if o := enumConstNames(f, "State"); !reflect.DeepEqual(o, tgt) {
+		t.Errorf("expected %v got %v", tgt, o)
+	}
+}
+
+func TestTwosComplement(t *testing.T) {
+	c := func(n int64, kind reflect.Kind, tgt uint64) {
+		if o := twosComplement(n, kind, 8); o != tgt {
+			t.Errorf("for %d (%v) expected %#x got %#x", n, kind, tgt, o)
+		}
+	}
+
+	c(-1, reflect.Int8, 0xff)
+	c(-128, reflect.Int8, 0x80)
+	c(-1, reflect.Int16, 0xffff)
+	c(-2, reflect.Int32, 0xfffffffe)
+	c(-1, reflect.Int64, 0xffffffffffffffff)
+	c(-1, reflect.Int, 0xffffffffffffffff)
+	c(42, reflect.Int32, 42)
+
+	if o := twosComplement(-1, reflect.Int, 4); o != 0xffffffff {
+		t.Errorf("for -1 (int, 32bit) expected 0xffffffff got %#x", o)
+	}
+	if o := twosComplement(-1, reflect.Int, 0); o != 0xffffffffffffffff {
+		t.Errorf("for -1 (int, unknown size) expected 0xffffffffffffffff got %#x", o)
+	}
+}
+
+func TestFormatBinary(t *testing.T) {
+	c := func(n uint64, tgt string) {
+		if o := formatBinary(n); o != tgt {
+			t.Errorf("for %d expected %q got %q", n, tgt, o)
+		}
+	}
+
+	c(0, "0b0")
+	c(10, "0b1010")
+	c(0xa6, "0b1010_0110")
+	c(0x1a6, "0b1_1010_0110")
+}
+
+func TestTypeMethods(t *testing.T) {
+	fns := []string{"main.main", "main.T.String", "main.(*T).Set", "main.(*T).Set.func1", "main.TT.Other", "sync.(*Mutex).Lock", "sync.(*Mutex).Unlock"}
+	c := func(typ string, tgtm, tgtp []string) {
+		m, p := typeMethods(fns, typ)
+		if !reflect.DeepEqual(m, tgtm) || !reflect.DeepEqual(p, tgtp) {
+			t.Errorf("for %q expected %v %v got %v %v", typ, tgtm, tgtp, m, p)
+		}
+	}
+
+	c("main.T", []string{"String"}, []string{"Set"})
+	c("*main.T", []string{"String"}, []string{"Set"})
+	c("sync.Mutex", nil, []string{"Lock", "Unlock"})
+	c("int", nil, nil)
+}
+
+func TestIsEmbeddedField(t *testing.T) {
+	c := func(name, typ string, tgt bool) {
+		if o := isEmbeddedField(&api.Variable{Name: name, Type: typ}); o != tgt {
+			t.Errorf("for %s %s expected %v got %v", name, typ, tgt, o)
+		}
+	}
+
+	c("Mutex", "sync.Mutex", true)
+	c("Buffer", "*bytes.Buffer", true)
+	c("List", "github.com/x/y.List[int]", true)
+	c("mu", "sync.Mutex", false)
+	c("int", "int", true)
+}
+
+func TestFormatRegisters(t *testing.T) {
+	regs := api.Registers{
+		{Name: "Rip", Value: "0x0000000000401000"},
+		{Name: "XMM0", Value: "0x3ff0000000000000\tv2_float={1 0}\tv4_float={0 1.875 0 0}"},
+	}
+	tgt := ` Rip = 0x0000000000401000
+XMM0 = 0x3ff0000000000000
+       v2_float={1 0}
+       v4_float={0 1.875 0 0}
+`
+	if o := formatRegisters(regs); o != tgt {
+		t.Errorf("expected:\n%s\ngot:\n%s", tgt, o)
+	}
+}
+
+func TestSubstitutePathList(t *testing.T) {
+	sep := string(os.PathListSeparator)
+	rules, err := parseSubstitutePathList("/a=/b" + sep + "/c=/d" + sep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tgt := []SubstitutePathRule{{From: "/a", To: "/b"}, {From: "/c", To: "/d"}}
+	if !reflect.DeepEqual(rules, tgt) {
+		t.Errorf("expected %v got %v", tgt, rules)
+	}
+	if _, err := parseSubstitutePathList("/a"); err == nil {
+		t.Errorf("expected error for malformed rule")
+	}
+
+	merged := mergeSubstitutePath([]SubstitutePathRule{{From: "/a", To: "/x"}, {From: "/e", To: "/f"}}, rules)
+	tgt = []SubstitutePathRule{{From: "/a", To: "/b"}, {From: "/e", To: "/f"}, {From: "/c", To: "/d"}}
+	if !reflect.DeepEqual(merged, tgt) {
+		t.Errorf("expected %v got %v", tgt, merged)
+	}
+}
+
+func TestSubstitutePathRegexp(t *testing.T) {
+	rules := []SubstitutePathRule{
+		{From: `^/root/go/pkg/mod/(github\.com/[^/]+/[^/@]+)@v[^/]+/`, To: "/src/$1/", Regexp: true},
+		{From: "/build", To: "/home/user/src"},
+	}
+	c := func(path, tgt string) {
+		o, ok := applySubstitutePath(rules, path)
+		if !ok {
+			o = path
+		}
+		if o != tgt {
+			t.Errorf("for %q expected %q got %q", path, tgt, o)
+		}
+	}
+
+	c("/root/go/pkg/mod/github.com/a/b@v1.2.3/c/d.go", "/src/github.com/a/b/c/d.go")
+	c("/build/main.go", "/home/user/src/main.go")
+	c("/other/main.go", "/other/main.go")
+}
+
+func TestShortenFilePath(t *testing.T) {
+	roots := goRoots{goroot: "/usr/local/go", gopath: "/home/user/go", modcache: "/home/user/go/pkg/mod"}
+	c := func(path, tgt string) {
+		if o := shortenFilePath(path, "/home/user/project", roots); o != tgt {
+			t.Errorf("for %q expected %q got %q", path, tgt, o)
+		}
+	}
+
+	c("/usr/local/go/src/runtime/proc.go", "$GOROOT/src/runtime/proc.go")
+	c("/home/user/go/pkg/mod/github.com/!burnt!sushi/xgb@v1.0.0/xgb.go", "github.com/BurntSushi/xgb@v1.0.0/xgb.go")
+	c("/home/user/go/src/example.com/a/a.go", "$GOPATH/src/example.com/a/a.go")
+	c("/home/user/project/main.go", "./main.go")
+	c("/home/user/project2/main.go", "/home/user/project2/main.go")
+	c("/tmp/x.go", "/tmp/x.go")
+}
+
+func TestSubstitutePrev(t *testing.T) {
+	c := func(cond string, vals map[string]string, tgt string, tgtargs []string) {
+		o, args, err := substitutePrev(cond, vals)
+		if tgtargs == nil {
+			if err == nil {
+				t.Errorf("for %q expected error", cond)
+			}
+			return
+		}
+		if err != nil {
+			t.Errorf("for %q unexpected error %v", cond, err)
+			return
+		}
+		if o != tgt || !reflect.DeepEqual(args, tgtargs) {
+			t.Errorf("for %q expected %q %v got %q %v", cond, tgt, tgtargs, o, args)
+		}
+	}
+
+	c("x >= 2*prev(x)", map[string]string{"x": "21"}, "x >= 2*(21)", []string{"x"})
+	c("s.n != prev(s.n) && prev(len(a)) < len(a)", map[string]string{"s.n": "1", "len(a)": "3"}, "s.n != (1) && (3) < len(a)", []string{"s.n", "len(a)"})
+	c("x >= 2*prev(x)", nil, "", []string{"x"})
+	c("x > 2", nil, "", nil)
+	c("x >", nil, "", nil)
+}
+
+func TestPtypeTypeExpr(t *testing.T) {
+	c := func(typ, tgt string) {
+		if out := ptypeTypeExpr(typ); out != tgt {
+			t.Errorf("for %q expected %q got %q", typ, tgt, out)
+		}
+	}
+
+	c("int", "int")
+	c("main.T", "main.T")
+	c("github.com/aarzilli/gdlv/internal/dlvclient/service/api.Variable", `"github.com/aarzilli/gdlv/internal/dlvclient/service/api".Variable`)
+	c("go/ast.File", `"go/ast".File`)
+	c("[]main.T", "[]main.T")
+}
+
+func TestParseIndexRange(t *testing.T) {
+	c := func(s string, n int64, tgtstart, tgtend int64, tgterr bool) {
+		start, end, err := parseIndexRange(s, n)
+		if tgterr {
+			if err == nil {
+				t.Errorf("for %q expected error", s)
+			}
+			return
+		}
+		if err != nil {
+			t.Errorf("for %q unexpected error %v", s, err)
+			return
+		}
+		if start != tgtstart || end != tgtend {
+			t.Errorf("for %q expected %d:%d got %d:%d", s, tgtstart, tgtend, start, end)
+		}
+	}
+
+	c("5000:5010", 10000, 5000, 5010, false)
+	c(" 10 : ", 100, 10, 100, false)
+	c(":20", 100, 0, 20, false)
+	c("20", 100, 0, 0, true)
+	c("20:10", 100, 0, 0, true)
+	c("90:110", 100, 0, 0, true)
+	c("a:b", 100, 0, 0, true)
+}
+
+func TestIsMatrixType(t *testing.T) {
+	for _, typ := range []string{"[][]float64", "[3][4]int", "[2][]main.T", "[][8]uint8"} {
+		if !isMatrixType(typ) {
+			t.Errorf("expected %q to be a matrix", typ)
+		}
+	}
+	for _, typ := range []string{"[]float64", "[][][]int", "[]map[string]int", "[][]map[string]int", "string"} {
+		if isMatrixType(typ) {
+			t.Errorf("expected %q not to be a matrix", typ)
+		}
+	}
+}
+
+func TestFloatStats(t *testing.T) {
+	min, max, mean, nonfinite := floatStats([]float64{1, math.NaN(), 3, math.Inf(1), -1, math.Inf(-1)})
+	if min != -1 || max != 3 || mean != 1 || nonfinite != 3 {
+		t.Errorf("unexpected stats %g %g %g %d", min, max, mean, nonfinite)
+	}
+	min, max, mean, nonfinite = floatStats([]float64{math.NaN()})
+	if min != 0 || max != 0 || mean != 0 || nonfinite != 1 {
+		t.Errorf("unexpected stats %g %g %g %d", min, max, mean, nonfinite)
+	}
+}
+
+func TestSortedHitCounts(t *testing.T) {
+	out := sortedHitCounts(map[string]uint64{"1": 3, "10": 7, "2": 3, "5": 1})
+	tgt := []goroutineHits{{"10", 7}, {"1", 3}, {"2", 3}, {"5", 1}}
+	if !reflect.DeepEqual(out, tgt) {
+		t.Errorf("expected %v got %v", tgt, out)
+	}
+}
+
+func TestLogpoint(t *testing.T) {
+	c := func(args, tgtfmt string, tgtexprs []string, tgtrest string) {
+		format, exprs, rest, err := parseLogpoint(args)
+		if tgtrest == "" {
+			if err == nil {
+				t.Errorf("for %q expected error", args)
+			}
+			return
+		}
+		if err != nil {
+			t.Errorf("for %q unexpected error %v", args, err)
+			return
+		}
+		if format != tgtfmt || !reflect.DeepEqual(exprs, tgtexprs) || rest != tgtrest {
+			t.Errorf("for %q expected %q %v %q got %q %v %q", args, tgtfmt, tgtexprs, tgtrest, format, exprs, rest)
+		}
+	}
+
+	c(`"x=%v y=%v" x y main.go:10`, "x=%v y=%v", []string{"x", "y"}, "main.go:10")
+	c(`"100%% done" mylog main.main`, "100%% done", nil, "mylog main.main")
+	c(`"x=%v y=%v" x main.go:10`, "", nil, "")
+	c(`x=%v x main.go:10`, "", nil, "")
+
+	if out := formatLogMessage("x=%v y=%5.2f 100%%", []string{"1", "2.5"}); out != "x=1 y=2.5 100%" {
+		t.Errorf("unexpected message %q", out)
+	}
+	if out := formatLogMessage("x=%v y=%v", []string{"1"}); out != "x=1 y=%!(MISSING)" {
+		t.Errorf("unexpected message %q", out)
+	}
+}
+
+func TestTimestampLines(t *testing.T) {
+	tm := time.Date(2020, 1, 2, 15, 4, 5, 6000000, time.UTC)
+	c := func(s string, atLineStart bool, tgt string) {
+		if out := timestampLines(s, atLineStart, tm); out != tgt {
+			t.Errorf("for %q expected %q got %q", s, tgt, out)
+		}
+	}
+
+	c("a\nb\n", true, "15:04:05.006 a\n15:04:05.006 b\n")
+	c("rest\nnext", false, "rest\n15:04:05.006 next")
+	c("\n", true, "15:04:05.006 \n")
+	c("", true, "")
+}
+
+func TestParseANSI(t *testing.T) {
+	c := func(s string, tgt []ansiSegment, tgtrest string) {
+		segs, _, rest := parseANSI(s, ansiAttr{})
+		if !reflect.DeepEqual(segs, tgt) || rest != tgtrest {
+			t.Errorf("for %q expected %v %q got %v %q", s, tgt, tgtrest, segs, rest)
+		}
+	}
+
+	c("plain", []ansiSegment{{"plain", ansiAttr{}}}, "")
+	c("a\x1b[31mred\x1b[0m b", []ansiSegment{{"a", ansiAttr{}}, {"red", ansiAttr{fg: 2}}, {" b", ansiAttr{}}}, "")
+	c("\x1b[1;94mx\x1b[22my\x1b[mz", []ansiSegment{{"x", ansiAttr{fg: 13, bold: true}}, {"y", ansiAttr{fg: 13}}, {"z", ansiAttr{}}}, "")
+	c("\x1b[2Ka\x1b]0;title\ab\x1b[38;5;200mc", []ansiSegment{{"a", ansiAttr{}}, {"b", ansiAttr{}}, {"c", ansiAttr{}}}, "")
+	c("a\x1b[3", []ansiSegment{{"a", ansiAttr{}}}, "\x1b[3")
+
+	var st ansiState
+	st.addSpan(0, 5, ansiAttr{fg: 1})
+	st.addSpan(5, 10, ansiAttr{fg: 1})
+	st.addSpan(12, 20, ansiAttr{bold: true})
+	st.shift(8)
+	if !reflect.DeepEqual(st.spans, []ansiSpan{{0, 2, ansiAttr{fg: 1}}, {4, 12, ansiAttr{bold: true}}}) {
+		t.Errorf("wrong spans after shift: %v", st.spans)
+	}
+}
+
+func TestFindMatches(t *testing.T) {
+	c := func(buf, needle string, tgt []int) {
+		if out := findMatches([]rune(buf), []rune(needle)); !reflect.DeepEqual(out, tgt) {
+			t.Errorf("for %q in %q expected %v got %v", needle, buf, tgt, out)
+		}
+	}
+
+	c("hit main.go:10\nHIT main.go:12\n", "hit", []int{0, 15})
+	c("aaaa", "aa", []int{0, 2})
+	c("abc", "", nil)
+	c("abc", "abcd", nil)
+
+	f := scrollbackFinder{matches: []int{2, 10}, n: 3}
+	for _, tc := range []struct {
+		idx   int
+		in    bool
+		limit int
+	}{{0, false, 2}, {3, true, 5}, {5, false, 10}, {12, true, 13}, {13, false, -1}} {
+		if in, limit := f.matchAt(tc.idx); in != tc.in || limit != tc.limit {
+			t.Errorf("matchAt(%d): expected %v %d got %v %d", tc.idx, tc.in, tc.limit, in, limit)
+		}
+	}
+}
+
+func TestCheckLayout(t *testing.T) {
+	for _, in := range []string{"|300_250LC_180Sl", "$1200,800$0|300_250LC_180Sl", "$640,480$0C,10,20,300,400G,1,2,3,4l"} {
+		if err := checkLayout(in); err != nil {
+			t.Errorf("unexpected error for %q: %v", in, err)
+		}
+	}
+	for _, in := range []string{"", "|300_250LC", "|300_250LC_180Sx", "_abcLC", "0C,10,20L", "0C,10,20,30,40", "0CG"} {
+		if err := checkLayout(in); err == nil {
+			t.Errorf("expected error for %q", in)
+		}
+	}
+}
+
+func TestAddListingTab(t *testing.T) {
+	defer func() { listingPanel.tabs, listingPanel.tabUses = nil, 0 }()
+	for i := 0; i < maxListingTabs; i++ {
+		addListingTab(strconv.Itoa(i), 1)
+	}
+	addListingTab("0", 20)
+	addListingTab("new", 1)
+	if len(listingPanel.tabs) != maxListingTabs {
+		t.Fatalf("wrong number of tabs %d", len(listingPanel.tabs))
+	}
+	if listingPanel.tabs[0].file != "0" || listingPanel.tabs[0].line != 20 {
+		t.Errorf("recently used tab evicted or not updated: %#v", listingPanel.tabs[0])
+	}
+	if listingPanel.tabs[1].file != "2" || listingPanel.tabs[len(listingPanel.tabs)-1].file != "new" {
+		t.Errorf("wrong tab evicted: %#v", listingPanel.tabs)
+	}
+}
+
+func TestNextBookmark(t *testing.T) {
+	bookmarks := map[string][]int{"/a.go": {10, 20}, "/b.go": {5}}
+	c := func(file string, lineno, dir int, tgtfile string, tgtline int) {
+		f, l, ok := nextBookmark(bookmarks, file, lineno, dir)
+		if !ok || f != tgtfile || l != tgtline {
+			t.Errorf("from %s:%d (%d) expected %s:%d got %s:%d", file, lineno, dir, tgtfile, tgtline, f, l)
+		}
+	}
+
+	c("/a.go", 1, +1, "/a.go", 10)
+	c("/a.go", 10, +1, "/a.go", 20)
+	c("/a.go", 20, +1, "/b.go", 5)
+	c("/b.go", 5, +1, "/a.go", 10)
+	c("/a.go", 15, -1, "/a.go", 10)
+	c("/a.go", 10, -1, "/b.go", 5)
+	c("/c.go", 1, -1, "/b.go", 5)
+
+	if _, _, ok := nextBookmark(nil, "/a.go", 1, +1); ok {
+		t.Errorf("found bookmark in empty set")
+	}
+}
+
+func TestFormatAnnotations(t *testing.T) {
+	vars := []api.Variable{
+		{Name: "x", Kind: reflect.Int, Value: "3", DeclLine: 10},
+		{Name: "y", Kind: reflect.Int, Value: "4", DeclLine: 10},
+		{Name: "z", Kind: reflect.Int, Value: "5", DeclLine: 12, Flags: api.VariableShadowed},
+		{Name: "w", Kind: reflect.Int, Unreadable: "optimized away", DeclLine: 13},
+	}
+	tgt := map[int]string{10: "x = 3, y = 4"}
+	if out := formatAnnotations(vars); !reflect.DeepEqual(out, tgt) {
+		t.Errorf("expected %v got %v", tgt, out)
+	}
+}
+
+func TestProfileLoc(t *testing.T) {
+	if out := profileLoc("work"); out != filepath.Join(profilesDir(), "work.json") {
+		t.Errorf("wrong location for named profile: %q", out)
+	}
+	for _, path := range []string{"work.json", filepath.Join("some", "dir", "work")} {
+		if out := profileLoc(path); out != path {
+			t.Errorf("wrong location for %q: %q", path, out)
+		}
+	}
+}
+
+func TestTypeLoadLimits(t *testing.T) {
+	defer func(old map[string]TypeLoadLimits) { conf.TypeLoadLimits = old }(conf.TypeLoadLimits)
+	conf.TypeLoadLimits = map[string]TypeLoadLimits{"[]main.Item": {MaxArrayValues: 500, MaxStringLen: 0}}
+
+	if cfg := getVariableLoadConfigForType("[]main.Item"); cfg.MaxArrayValues != 500 || cfg.MaxStringLen != getVariableLoadConfig().MaxStringLen {
+		t.Errorf("wrong load config %#v", cfg)
+	}
+	if cfg := getVariableLoadConfigForType("[]int"); cfg != getVariableLoadConfig() {
+		t.Errorf("wrong load config for type without limits %#v", cfg)
+	}
+
+	v := &api.Variable{Type: "[]main.Item", Kind: reflect.Slice, Addr: 0xc000010000, Len: 1000, Children: make([]api.Variable, 64)}
+	if !belowTypeLoadLimits(v) {
+		t.Errorf("truncated slice not reloaded")
+	}
+	v.Children = make([]api.Variable, 500)
+	if belowTypeLoadLimits(v) {
+		t.Errorf("slice loaded up to its limit reloaded")
+	}
+	v.Type = "[]int"
+	v.Children = v.Children[:64]
+	if belowTypeLoadLimits(v) {
+		t.Errorf("slice without limits reloaded")
+	}
+}
+
+func TestInSkippedPackage(t *testing.T) {
+	defer func(old []string) { conf.StepSkipPackages = old }(conf.StepSkipPackages)
+	conf.StepSkipPackages = []string{"runtime", "github.com/some/lib"}
+	for fnname, tgt := range map[string]bool{
+		"runtime.gopark":                      true,
+		"runtime/internal/atomic.Load":        true,
+		"runtimex.F":                          false,
+		"main.main":                           false,
+		"github.com/some/lib.(*T).Method":     true,
+		"github.com/some/lib/sub.F":           true,
+		"github.com/some/library.F":           false,
+		"github.com/other/pkg.F.func1":        false,
+		"github.com/some/lib.F.func1.gowrap2": true,
+	} {
+		if out := inSkippedPackage(fnname); out != tgt {
+			t.Errorf("%s: expected %v got %v", fnname, tgt, out)
+		}
+	}
+}
+
+func TestParseProcessList(t *testing.T) {
+	out := `    1 init
+   42 gdlv
+  100 my server
+  abc broken
+
+  200 other
+`
+	procs := parseProcessList(out, 42)
+	tgt := []processInfo{{1, "init"}, {100, "my server"}, {200, "other"}}
+	if !reflect.DeepEqual(procs, tgt) {
+		t.Fatalf("parseProcessList: got %v expected %v", procs, tgt)
+	}
+	matches := matchProcesses(procs, regexp.MustCompile("^(my|other)"))
+	tgt = []processInfo{{100, "my server"}, {200, "other"}}
+	if !reflect.DeepEqual(matches, tgt) {
+		t.Fatalf("matchProcesses: got %v expected %v", matches, tgt)
+	}
+}
+
+func TestDiffVariables(t *testing.T) {
+	intv := func(name, val string) api.Variable {
+		return api.Variable{Name: name, Kind: reflect.Int, Type: "int", Value: val}
+	}
+	old := &api.Variable{Name: "s", Kind: reflect.Struct, Type: "T", Children: []api.Variable{
+		intv("a", "1"),
+		intv("b", "2"),
+		{Name: "c", Kind: reflect.Slice, Type: "[]int", Len: 2, Cap: 2, Children: []api.Variable{intv("", "1"), intv("", "2")}},
+	}}
+	new := &api.Variable{Name: "s", Kind: reflect.Struct, Type: "T", Children: []api.Variable{
+		intv("a", "1"),
+		intv("b", "3"),
+		{Name: "c", Kind: reflect.Slice, Type: "[]int", Len: 1, Cap: 2, Children: []api.Variable{intv("", "1")}},
+	}}
+
+	d := diffVariables("s", old, new)
+	if !d.Changed || len(d.Children) != 3 {
+		t.Fatalf("wrong root diff: %#v", d)
+	}
+	changed := map[string]bool{}
+	for _, c := range d.Children {
+		changed[c.Name] = c.Changed
+	}
+	if !reflect.DeepEqual(changed, map[string]bool{"a": false, "b": true, "c": true}) {
+		t.Errorf("wrong changed fields: %v", changed)
+	}
+	c := d.Children[2]
+	if len(c.Children) != 2 || c.Children[0].Changed || !c.Children[1].Changed || c.Children[1].New != "" {
+		t.Errorf("wrong slice diff: %#v %#v", c.Children[0], c.Children[1])
+	}
+	if diffVariables("s", old, old).Changed {
+		t.Errorf("identical variables reported as changed")
+	}
+}
+
+func TestExprRecordValue(t *testing.T) {
+	var e Expr
+	t0 := time.Now()
+	for i := 0; i < maxWatchHistory+3; i++ {
+		if !e.recordValue(t0.Add(time.Duration(i)*time.Second), strconv.Itoa(i)) {
+			t.Fatalf("value %d not recorded", i)
+		}
+		if e.recordValue(t0, strconv.Itoa(i)) {
+			t.Fatalf("repeated value %d recorded", i)
+		}
+	}
+	if len(e.history) != maxWatchHistory {
+		t.Fatalf("wrong history length %d", len(e.history))
+	}
+	if e.history[0].value != "3" || e.history[len(e.history)-1].value != strconv.Itoa(maxWatchHistory+2) {
+		t.Fatalf("wrong history %v", e.history)
+	}
+}
+
+func TestDescribeLocationExpr(t *testing.T) {
+	for _, tc := range []struct{ in, out string }{
+		{"[block] DW_OP_fbreg -0x18 ", "on the stack at frame base-24"},
+		{"[block] DW_OP_call_frame_cfa DW_OP_consts 0x8 DW_OP_plus ", "on the stack at CFA+8"},
+		{"[block] DW_OP_addr 0x54c9a0 ", "in static memory at 0x54c9a0"},
+		{"[0x4a1000:0x4a1020] DW_OP_reg0 ", "in register rax"},
+		{"[block] DW_OP_reg0 DW_OP_piece 0x8 DW_OP_reg3 DW_OP_piece 0x8 ", "bytes 0-7 in register rax, bytes 8-15 in register rbx"},
+		{"[block] DW_OP_piece 0x8 DW_OP_breg7 0x10 DW_OP_piece 0x8 ", "bytes 0-7 optimized out, bytes 8-15 on the stack at rsp+16"},
+		{"[block] DW_OP_lit1 DW_OP_stack_value ", "not in memory, its value is computed"},
+		{"[block] DW_OP_breg0 0x0 DW_OP_deref ", "computed by DW_OP_breg0 0x0 DW_OP_deref"},
+		{"", "no location (optimized out)"},
+	} {
+		if out := describeLocationExpr(tc.in, amd64DwarfRegs); out != tc.out {
+			t.Errorf("%q: got %q expected %q", tc.in, out, tc.out)
+		}
+	}
+	for _, tc := range []struct {
+		regs    *dwarfRegs
+		in, out string
+	}{
+		{arm64DwarfRegs, "[block] DW_OP_reg0 ", "in register x0"},
+		{arm64DwarfRegs, "[block] DW_OP_breg31 0x10 ", "on the stack at sp+16"},
+		{nil, "[block] DW_OP_reg0 ", "in register with DWARF number 0"},
+	} {
+		if out := describeLocationExpr(tc.in, tc.regs); out != tc.out {
+			t.Errorf("%q: got %q expected %q", tc.in, out, tc.out)
+		}
+	}
+}
+
+func TestVariableAddress(t *testing.T) {
+	for _, tc := range []struct {
+		v   api.Variable
+		tgt uint64
+	}{
+		{api.Variable{Kind: reflect.Ptr, Addr: 0x10, Children: []api.Variable{{Addr: 0x2000}}}, 0x2000},
+		{api.Variable{Kind: reflect.Uintptr, Addr: 0x10, Value: "12345"}, 12345},
+		{api.Variable{Kind: reflect.Slice, Addr: 0x10, Base: 0x3000}, 0x3000},
+		{api.Variable{Kind: reflect.Struct, Addr: 0x10}, 0x10},
+	} {
+		addr, err := variableAddress(&tc.v)
+		if err != nil || addr != tc.tgt {
+			t.Errorf("%v: got %#x %v expected %#x", tc.v.Kind, addr, err, tc.tgt)
+		}
+	}
+	if _, err := variableAddress(&api.Variable{Kind: reflect.Int, Unreadable: "optimized out"}); err == nil {
+		t.Errorf("no error for unreadable variable")
+	}
+}
+
+func TestOrderStructFields(t *testing.T) {
+	mk := func(names ...string) []*Variable {
+		r := make([]*Variable, len(names))
+		for i := range names {
+			r[i] = &Variable{Variable: &api.Variable{Name: names[i]}}
+		}
+		return r
+	}
+	names := func(vs []*Variable) []string {
+		r := []string{}
+		for _, v := range vs {
+			r = append(r, v.Name)
+		}
+		return r
+	}
+	children := mk("a", "b", "c", "d", "e")
+	visible, hidden := orderStructFields(children, StructFieldPrefs{Hidden: []string{"b", "e"}, Pinned: []string{"d", "b", "missing"}})
+	if tgt := []string{"d", "a", "c"}; !reflect.DeepEqual(names(visible), tgt) {
+		t.Errorf("visible: got %v expected %v", names(visible), tgt)
+	}
+	if tgt := []string{"b", "e"}; !reflect.DeepEqual(names(hidden), tgt) {
+		t.Errorf("hidden: got %v expected %v", names(hidden), tgt)
+	}
+	visible, hidden = orderStructFields(children, StructFieldPrefs{})
+	if len(visible) != len(children) || hidden != nil {
+		t.Errorf("fields changed without preferences")
+	}
+}
+
+func TestAsyncLoadCoalesce(t *testing.T) {
+	loads := make(chan int, 10)
+	n := 0
+	var l asyncLoad
+	l.load = func(p *asyncLoad) {
+		n++
+		loads <- n
+	}
+	l.startLoad()
+	<-loads
+	// clears while loading are coalesced into a single reload
+	l.clear()
+	l.clear()
+	l.clear()
+	if !l.superseded() {
+		t.Fatalf("load not superseded after clear")
+	}
+	l.done(nil)
+	if got := <-loads; got != 2 {
+		t.Fatalf("expected second load got %d", got)
+	}
+	if l.superseded() {
+		t.Fatalf("reload still pending")
+	}
+}
+
+func TestPackageFilter(t *testing.T) {
+	re := regexp.MustCompile(packageFilter("foo"))
+	for _, tc := range []struct {
+		name  string
+		match bool
+	}{
+		{"foo.X", true},
+		{"github.com/user/foo.X", true},
+		{"github.com/user/foobar.X", false},
+		{"github.com/foo/bar.X", false},
+		{"main.foo", false},
+	} {
+		if re.MatchString(tc.name) != tc.match {
+			t.Errorf("%q: expected match %v", tc.name, tc.match)
+		}
+	}
+	if packageFilter("") != "" {
+		t.Errorf("empty package should not filter")
+	}
+}
+
+func TestFilterVariable(t *testing.T) {
+	mk := func(name, value, expr string, children ...*Variable) *Variable {
+		return &Variable{Variable: &api.Variable{Name: name}, Value: value, Expression: expr, Children: children}
+	}
+	config := mk("config", "", "config",
+		mk("Timeout", "30", "config.Timeout"),
+		mk("inner", "", "config.inner", mk("host", "localhost", "config.inner.host")))
+	other := mk("other", "1", "other")
+
+	match := makeVarFilter("TIMEOUT", false)
+	if !filterVariable(config, match, false) || filterVariable(other, match, false) {
+		t.Errorf("nested name not matched")
+	}
+	match = makeVarFilter("^local", true)
+	setVarTreeOpen("config", false)
+	setVarTreeOpen("config.inner", false)
+	if !filterVariable(config, match, true) {
+		t.Errorf("nested value not matched")
+	}
+	if !isVarTreeOpen("config") || !isVarTreeOpen("config.inner") || isVarTreeOpen("config.inner.host") {
+		t.Errorf("wrong nodes expanded: %v", varTreeOpen)
+	}
+	setVarTreeOpen("config", false)
+	setVarTreeOpen("config.inner", false)
+	if makeVarFilter("", false) != nil || makeVarFilter("(", true) != nil {
+		t.Errorf("empty or invalid filter should show everything")
+	}
+}
+
+func TestFuzzyCompletion(t *testing.T) {
+	cm := completeMachine{word: "ma.ma", fuzzy: true}
+	for _, compl := range []string{"main.main", "main", "runtime.main", "math.Max", "fmt.Println"} {
+		cm.add(compl)
+	}
+	if len(cm.compls) != 0 {
+		t.Errorf("unexpected prefix completions %v", cm.compls)
+	}
+	if tgt := []string{"main.main", "math.Max"}; !reflect.DeepEqual(rankFuzzy(cm.word, cm.fuzzyCompls), tgt) {
+		t.Errorf("got %v expected %v", rankFuzzy(cm.word, cm.fuzzyCompls), tgt)
+	}
+	if fuzzyRank("ma.ma", "main.main") >= fuzzyRank("ma.ma", "math.Max") {
+		t.Errorf("main.main should rank ahead of math.Max")
+	}
+
+	cm = completeMachine{word: "mai", fuzzy: false}
+	cm.add("main.main")
+	cm.add("runtime.main")
+	if len(cm.compls) != 1 || len(cm.fuzzyCompls) != 0 {
+		t.Errorf("strict completion: %v %v", cm.compls, cm.fuzzyCompls)
+	}
+}
+
+func TestParseCommandScript(t *testing.T) {
+	src := "break main.main\n\n  # comment\n\tcontinue  \nprint x\n"
+	tgt := []string{"break main.main", "continue", "print x"}
+	if got := parseCommandScript(src); !reflect.DeepEqual(got, tgt) {
+		t.Fatalf("got %q expected %q", got, tgt)
+	}
+}
+
+func TestAssertResult(t *testing.T) {
+	for _, tc := range []struct {
+		v      api.Variable
+		ok     bool
+		hasErr bool
+	}{
+		{api.Variable{Name: "x > 1", Kind: reflect.Bool, Type: "bool", Value: "true"}, true, false},
+		{api.Variable{Name: "x > 1", Kind: reflect.Bool, Type: "bool", Value: "false"}, false, false},
+		{api.Variable{Name: "x", Kind: reflect.Int, Type: "int", Value: "1"}, false, true},
+		{api.Variable{Name: "y", Unreadable: "could not find symbol value for y"}, false, true},
+	} {
+		ok, err := assertResult(&tc.v)
+		if ok != tc.ok || (err != nil) != tc.hasErr {
+			t.Errorf("%s: got %v, %v expected %v (error %v)", tc.v.Name, ok, err, tc.ok, tc.hasErr)
+		}
+	}
+}
+
+func TestChangepoint(t *testing.T) {
+	cp := &changepoint{}
+	for i, tc := range []struct {
+		val     string
+		changed bool
+	}{
+		{"1", true},
+		{"1", false},
+		{"2", true},
+		{"2", false},
+		{"1", true},
+	} {
+		if got := cp.changed(tc.val); got != tc.changed {
+			t.Errorf("%d: changed(%q) = %v expected %v", i, tc.val, got, tc.changed)
+		}
+	}
+}
+
+func TestGoroutineLabels(t *testing.T) {
+	g := &api.Goroutine{ID: 1, Labels: map[string]string{"worker": "3", "job": "index"}}
+	if got := formatGoroutineLabels(g.Labels); got != "job=index worker=3" {
+		t.Errorf("formatGoroutineLabels: got %q", got)
+	}
+	for _, tc := range []struct {
+		filter string
+		match  bool
+	}{
+		{"", true},
+		{"worker", true},
+		{"worker=3", true},
+		{"worker=4", false},
+		{"other", false},
+		{"job=", false},
+	} {
+		if got := goroutineHasLabel(g, tc.filter); got != tc.match {
+			t.Errorf("goroutineHasLabel(%q): got %v expected %v", tc.filter, got, tc.match)
+		}
+	}
+	if goroutineHasLabel(&api.Goroutine{ID: 2}, "worker") {
+		t.Errorf("goroutine without labels matched")
+	}
+}
+
+func TestGroupGoroutinesByFrame(t *testing.T) {
+	fn := func(name string) api.Location {
+		return api.Location{File: "/x/main.go", Line: 10, Function: &api.Function{Name_: name}}
+	}
+	locs := map[int]api.Location{1: fn("main.a"), 2: fn("main.b"), 3: fn("main.b"), 5: fn("main.a"), 6: fn("main.b")}
+	groups, rest := groupGoroutinesByFrame([]int{1, 2, 3, 4, 5, 6}, func(gid int) (api.Location, bool) {
+		loc, ok := locs[gid]
+		return loc, ok
+	})
+	if len(groups) != 2 {
+		t.Fatalf("wrong number of groups %d", len(groups))
+	}
+	if groups[0].loc.Function.Name() != "main.b" || !reflect.DeepEqual(groups[0].gids, []int{2, 3, 6}) {
+		t.Errorf("wrong first group %s %v", groups[0].key, groups[0].gids)
+	}
+	if groups[1].loc.Function.Name() != "main.a" || !reflect.DeepEqual(groups[1].gids, []int{1, 5}) {
+		t.Errorf("wrong second group %s %v", groups[1].key, groups[1].gids)
+	}
+	if !reflect.DeepEqual(rest, []int{4}) {
+		t.Errorf("wrong rest %v", rest)
+	}
+}
+
+func TestRepinFrameOffset(t *testing.T) {
+	frame := func(fn string, off int64) api.Stackframe {
+		return api.Stackframe{Location: api.Location{Function: &api.Function{Name_: fn}}, FrameOffset: off}
+	}
+	frames := []api.Stackframe{frame("main.f", -200), frame("main.g", -100), frame("main.main", -40)}
+	for _, tc := range []struct {
+		fn  string
+		off int64
+		tgt int64
+		ok  bool
+	}{
+		{"main.g", -100, -100, true},
+		{"main.g", -120, -100, true},
+		{"main.f", -100, -200, true},
+		{"main.h", -100, 0, false},
+	} {
+		off, ok := repinFrameOffset(frames, tc.fn, tc.off)
+		if off != tc.tgt || ok != tc.ok {
+			t.Errorf("repinFrameOffset(%s, %d): got %d %v expected %d %v", tc.fn, tc.off, off, ok, tc.tgt, tc.ok)
+		}
+	}
+}
+
+func TestDetailHistory(t *testing.T) {
+	for _, tc := range []struct {
+		v  api.Variable
+		x  float64
+		ok bool
+	}{
+		{api.Variable{Kind: reflect.Int, Value: "-12"}, -12, true},
+		{api.Variable{Kind: reflect.Uint8, Value: "200"}, 200, true},
+		{api.Variable{Kind: reflect.Float64, Value: "1.5"}, 1.5, true},
+		{api.Variable{Kind: reflect.String, Value: "12"}, 0, false},
+		{api.Variable{Kind: reflect.Int, Value: "1", Unreadable: "error"}, 0, false},
+	} {
+		x, ok := numericValue(&tc.v)
+		if x != tc.x || ok != tc.ok {
+			t.Errorf("numericValue(%v): got %g %v expected %g %v", tc.v, x, ok, tc.x, tc.ok)
+		}
+	}
+
+	var history []float64
+	for i := 0; i < 5; i++ {
+		history = appendHistory(history, float64(i), 3)
+	}
+	if len(history) != 3 || history[0] != 2 || history[2] != 4 {
+		t.Errorf("appendHistory: got %v", history)
+	}
+}
+
+func TestRekeyBreakpoint(t *testing.T) {
+	defer func(fbps []frozenBreakpoint) { FrozenBreakpoints = fbps }(FrozenBreakpoints)
+	FrozenBreakpoints = []frozenBreakpoint{{Bp: api.Breakpoint{ID: 3}}, {Bp: api.Breakpoint{ID: 4}}}
+	logpoints[3] = "x = {x}"
+	prevConditions[3] = &prevCondition{Cond: "prev(x) != x"}
+	defer delete(logpoints, 7)
+	defer delete(prevConditions, 7)
+
+	rekeyBreakpoint(3, 7)
+	if FrozenBreakpoints[0].Bp.ID != 7 || FrozenBreakpoints[1].Bp.ID != 4 {
+		t.Errorf("frozen breakpoints not updated: %v", FrozenBreakpoints)
+	}
+	if _, ok := logpoints[3]; ok || logpoints[7] != "x = {x}" {
+		t.Errorf("logpoint not moved: %v", logpoints)
+	}
+	if _, ok := prevConditions[3]; ok || prevConditions[7] == nil {
+		t.Errorf("condition not moved: %v", prevConditions)
+	}
+}
+
+func TestIsCore(t *testing.T) {
+	for _, tc := range []struct {
+		dlvargs []string
+		tgt     bool
+	}{
+		{[]string{"--headless", "core", "./prog", "core.1234"}, true},
+		{[]string{"--headless", "exec", "./prog", "--", "core"}, false},
+		{[]string{"--headless", "exec", "./prog"}, false},
+		{[]string{"--headless", "exec", "core", "--"}, false},
+		{[]string{"--backend=rr", "--headless", "core", "./prog", "core.1234"}, true},
+	} {
+		descr := ServerDescr{dlvargs: tc.dlvargs}
+		if out := descr.IsCore(); out != tc.tgt {
+			t.Errorf("IsCore(%v): got %v expected %v", tc.dlvargs, out, tc.tgt)
+		}
+	}
+}
+
+func TestSavedBreakpointJSON(t *testing.T) {
+	var saved []savedBreakpoint
+	if err := json.Unmarshal([]byte(`[{"id":1,"file":"main.go","line":3}]`), &saved); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 1 || saved[0].File != "main.go" || saved[0].Line != 3 || saved[0].LogFormat != "" {
+		t.Errorf("could not read old breakpoints file: %#v", saved)
+	}
+	saved[0].LogFormat = "x = {x}"
+	buf, err := json.Marshal(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved2 []savedBreakpoint
+	if err := json.Unmarshal(buf, &saved2); err != nil {
+		t.Fatal(err)
+	}
+	if saved2[0].LogFormat != "x = {x}" || saved2[0].Line != 3 {
+		t.Errorf("log format not saved: %s", buf)
+	}
+}
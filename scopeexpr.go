@@ -2,6 +2,9 @@ package main
 
 import (
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"io"
 	"reflect"
 	"regexp"
 	"strconv"
@@ -288,6 +291,80 @@ func evalScopedExpr(expr string, cfg api.LoadConfig) *api.Variable {
 	return convertStarlarkToVariable(expr, sv)
 }
 
+// exprHasCall returns true if expr contains a function call that isn't a
+// call to one of the builtin functions supported by the expression
+// evaluator.
+func exprHasCall(expr string) bool {
+	t, err := parser.ParseExpr(expr)
+	if err != nil {
+		return false
+	}
+	found := false
+	ast.Inspect(t, func(n ast.Node) bool {
+		if found {
+			return false
+		}
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		switch fn := call.Fun.(type) {
+		case *ast.Ident:
+			switch fn.Name {
+			case "len", "cap", "complex", "real", "imag":
+				// builtins evaluated by delve
+			default:
+				found = true
+			}
+		case *ast.SelectorExpr:
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// evalCallExpr evaluates expr, which contains a function call, by
+// injecting the call into the current goroutine of the target process.
+func evalCallExpr(out io.Writer, expr string, cfg api.LoadConfig) *api.Variable {
+	se := ParseScopedExpr(expr)
+	if exprIsScoped(expr) || curFrame != 0 || curDeferredCall != 0 {
+		return &api.Variable{Name: expr, Unreadable: "function calls can only be evaluated in the topmost frame of the current goroutine"}
+	}
+	state, err := client.Call(se.EvalExpr, &cfg, false)
+	if err != nil {
+		return &api.Variable{Name: expr, Unreadable: fmt.Sprintf("could not call function: %v", err)}
+	}
+	th := state.CurrentThread
+	if th != nil && th.Breakpoint != nil {
+		printcontext(out, state)
+		refreshState(refreshToFrameZero, clearStop, state)
+		return &api.Variable{Name: expr, Unreadable: fmt.Sprintf("function call interrupted by %s", formatBreakpointName(th.Breakpoint, false))}
+	}
+	// the call could have changed the value of any variable
+	refreshState(refreshToSameFrame, clearStop, state)
+	if th == nil {
+		return &api.Variable{Name: expr, Unreadable: "could not call function: no current thread"}
+	}
+
+	switch len(th.ReturnValues) {
+	case 0:
+		return &api.Variable{Name: expr, Value: "(no return values)"}
+	case 1:
+		v := th.ReturnValues[0]
+		v.Name = expr
+		return &v
+	default:
+		return &api.Variable{
+			Name: expr,
+			Type: "return values", RealType: "return values",
+			Kind:     reflect.Struct,
+			Len:      int64(len(th.ReturnValues)),
+			Children: th.ReturnValues,
+		}
+	}
+}
+
 func convertStarlarkToVariable(expr string, sv starlark.Value) *api.Variable {
 	switch sv := sv.(type) {
 	case *starlark.List:
@@ -53,3 +53,22 @@ func TestScopeSpecs(t *testing.T) {
 		}
 	}
 }
+
+func TestExprHasCall(t *testing.T) {
+	for _, tc := range []struct {
+		expr string
+		tgt  bool
+	}{
+		{"a", false},
+		{"len(s)", false},
+		{"a.b[2]", false},
+		{"obj.Method(1, \"a\")", true},
+		{"fn()", true},
+		{"a + cap(fn(1))", true},
+		{"a +", false},
+	} {
+		if out := exprHasCall(tc.expr); out != tc.tgt {
+			t.Errorf("exprHasCall(%q): expected %v got %v", tc.expr, tc.tgt, out)
+		}
+	}
+}
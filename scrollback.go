@@ -1,8 +1,19 @@
 package main
 
 import (
+	"fmt"
+	"image/color"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
 	"github.com/aarzilli/nucular"
+	ncommand "github.com/aarzilli/nucular/command"
 	"github.com/aarzilli/nucular/rect"
+
+	"golang.org/x/mobile/event/key"
 )
 
 var silenced bool
@@ -29,11 +40,25 @@ func (w *editorWriter) Write(b []byte) (int, error) {
 
 	logf("Output: %s", string(b))
 
-	w.ed.Buffer = autowrappend(w.ed.Buffer, []rune(expandTabs(string(b))), 260)
+	s := scrollbackANSI.pending + string(b)
+	if conf.TimestampOutput {
+		s = timestampLines(s, currentColumn(w.ed.Buffer) == 0, time.Now())
+	}
+
+	var segs []ansiSegment
+	segs, scrollbackANSI.attr, scrollbackANSI.pending = parseANSI(s, scrollbackANSI.attr)
+	for _, seg := range segs {
+		start := len(w.ed.Buffer)
+		w.ed.Buffer = autowrappend(w.ed.Buffer, []rune(expandTabs(seg.text)), 260)
+		if seg.attr != (ansiAttr{}) && !conf.DisableANSIColors {
+			scrollbackANSI.addSpan(start, len(w.ed.Buffer), seg.attr)
+		}
+	}
 	if len(w.ed.Buffer) > scrollbackHighMark {
 		copy(w.ed.Buffer, w.ed.Buffer[scrollbackLowMark:])
 		w.ed.Buffer = w.ed.Buffer[:len(w.ed.Buffer)-scrollbackLowMark]
 		w.ed.Cursor = len(w.ed.Buffer) - 256
+		scrollbackANSI.shift(scrollbackLowMark)
 	}
 	oldcursor := w.ed.Cursor
 	for w.ed.Cursor = len(w.ed.Buffer) - 2; w.ed.Cursor > oldcursor; w.ed.Cursor-- {
@@ -52,6 +77,327 @@ func (w *editorWriter) Write(b []byte) (int, error) {
 	return len(b), nil
 }
 
+// ansiAttr is the graphic rendition state set by SGR escape sequences, fg
+// is 0 for the default color or 1 + the index of one of the 16 basic
+// colors.
+type ansiAttr struct {
+	fg   uint8
+	bold bool
+}
+
+type ansiSegment struct {
+	text string
+	attr ansiAttr
+}
+
+type ansiSpan struct {
+	start, end int
+	attr       ansiAttr
+}
+
+type ansiState struct {
+	spans   []ansiSpan
+	attr    ansiAttr
+	pending string // incomplete escape sequence at the end of the last write
+}
+
+// scrollbackANSI records the colored ranges of scrollbackEditor.Buffer.
+var scrollbackANSI ansiState
+
+var ansiColors = [16]color.RGBA{
+	{0x55, 0x55, 0x55, 0xff}, // black (lightened to be visible on the dark background)
+	{0xcd, 0x31, 0x31, 0xff}, // red
+	{0x0d, 0xbc, 0x79, 0xff}, // green
+	{0xe5, 0xe5, 0x10, 0xff}, // yellow
+	{0x24, 0x72, 0xc8, 0xff}, // blue
+	{0xbc, 0x3f, 0xbc, 0xff}, // magenta
+	{0x11, 0xa8, 0xcd, 0xff}, // cyan
+	{0xe5, 0xe5, 0xe5, 0xff}, // white
+	{0x76, 0x76, 0x76, 0xff}, // bright black
+	{0xf1, 0x4c, 0x4c, 0xff}, // bright red
+	{0x23, 0xd1, 0x8b, 0xff}, // bright green
+	{0xf5, 0xf5, 0x43, 0xff}, // bright yellow
+	{0x3b, 0x8e, 0xea, 0xff}, // bright blue
+	{0xd6, 0x70, 0xd6, 0xff}, // bright magenta
+	{0x29, 0xb8, 0xdb, 0xff}, // bright cyan
+	{0xff, 0xff, 0xff, 0xff}, // bright white
+}
+
+// parseANSI splits s into runs of text with the same graphic rendition,
+// starting with attr. SGR sequences for bold and the 16 basic foreground
+// colors are interpreted, all other escape sequences are removed. An
+// incomplete escape sequence at the end of s is returned in rest.
+func parseANSI(s string, attr ansiAttr) (segs []ansiSegment, attrOut ansiAttr, rest string) {
+	start := 0
+	flush := func(end int) {
+		if end > start {
+			segs = append(segs, ansiSegment{s[start:end], attr})
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\x1b' {
+			continue
+		}
+		flush(i)
+		if i+1 >= len(s) {
+			return segs, attr, s[i:]
+		}
+		switch s[i+1] {
+		case '[':
+			// CSI: parameter and intermediate bytes followed by a final byte
+			j := i + 2
+			for j < len(s) && (s[j] < 0x40 || s[j] > 0x7e) {
+				j++
+			}
+			if j >= len(s) {
+				return segs, attr, s[i:]
+			}
+			if s[j] == 'm' {
+				attr = applySGR(attr, s[i+2:j])
+			}
+			i = j
+		case ']':
+			// OSC: terminated by BEL or ST
+			j := i + 2
+			for ; j < len(s); j++ {
+				if s[j] == '\a' {
+					break
+				}
+				if s[j] == '\x1b' && j+1 < len(s) && s[j+1] == '\\' {
+					j++
+					break
+				}
+			}
+			if j >= len(s) {
+				return segs, attr, s[i:]
+			}
+			i = j
+		default:
+			i++
+		}
+		start = i + 1
+	}
+	flush(len(s))
+	return segs, attr, ""
+}
+
+func applySGR(attr ansiAttr, params string) ansiAttr {
+	fields := strings.Split(params, ";")
+	for i := 0; i < len(fields); i++ {
+		n, err := strconv.Atoi(fields[i])
+		if fields[i] == "" {
+			n, err = 0, nil
+		}
+		if err != nil {
+			return attr
+		}
+		switch {
+		case n == 0:
+			attr = ansiAttr{}
+		case n == 1:
+			attr.bold = true
+		case n == 22:
+			attr.bold = false
+		case n >= 30 && n <= 37:
+			attr.fg = uint8(n-30) + 1
+		case n >= 90 && n <= 97:
+			attr.fg = uint8(n-90) + 9
+		case n == 39:
+			attr.fg = 0
+		case n == 38 || n == 48:
+			// extended colors are not supported, skip their arguments
+			if i+1 < len(fields) {
+				switch fields[i+1] {
+				case "5":
+					i += 2
+				case "2":
+					i += 4
+				}
+			}
+		}
+	}
+	return attr
+}
+
+func (st *ansiState) addSpan(start, end int, attr ansiAttr) {
+	if start >= end {
+		return
+	}
+	if n := len(st.spans); n > 0 && st.spans[n-1].end == start && st.spans[n-1].attr == attr {
+		st.spans[n-1].end = end
+		return
+	}
+	st.spans = append(st.spans, ansiSpan{start, end, attr})
+}
+
+// shift moves all spans n characters back, after the first n characters
+// of the buffer have been removed.
+func (st *ansiState) shift(n int) {
+	spans := st.spans[:0]
+	for _, span := range st.spans {
+		span.start -= n
+		span.end -= n
+		if span.end <= 0 {
+			continue
+		}
+		if span.start < 0 {
+			span.start = 0
+		}
+		spans = append(spans, span)
+	}
+	st.spans = spans
+}
+
+func (st *ansiState) reset() {
+	*st = ansiState{}
+}
+
+// attrAt returns the graphic rendition of the character at idx and the
+// index where it ends.
+func (st *ansiState) attrAt(idx int) (ansiAttr, int) {
+	i := sort.Search(len(st.spans), func(i int) bool { return st.spans[i].end > idx })
+	if i >= len(st.spans) {
+		return ansiAttr{}, -1
+	}
+	if st.spans[i].start > idx {
+		return ansiAttr{}, st.spans[i].start
+	}
+	return st.spans[i].attr, st.spans[i].end
+}
+
+func (attr ansiAttr) color(dflt color.RGBA) color.RGBA {
+	if attr.fg == 0 {
+		return dflt
+	}
+	return ansiColors[attr.fg-1]
+}
+
+// colorScrollback recolors the text drawn by scrollbackEditor and
+// highlights the matches of the find bar, first is the index of the first
+// command emitted by scrollbackEditor.Edit in w and bounds is its widget
+// bounds.
+// The editor has no support for colored text so we find the buffer
+// position of each text command by looking at its coordinates and split it
+// into differently colored pieces.
+func colorScrollback(w *nucular.Window, first int, bounds rect.Rect) {
+	colors := !conf.DisableANSIColors && len(scrollbackANSI.spans) > 0
+	highlight := scrollbackFind.active && len(scrollbackFind.matches) > 0
+	if !colors && !highlight {
+		return
+	}
+	style := w.Master().Style()
+	ed := &scrollbackEditor
+	cmds := w.Commands()
+	if first >= len(cmds.Commands) {
+		return
+	}
+
+	lineStarts := []int{0}
+	for i, ch := range ed.Buffer {
+		if ch == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+
+	rowHeight := nucular.FontHeight(style.Font) + style.Edit.RowPadding
+	y0 := bounds.Y + style.Edit.Padding.Y + style.Edit.Border - ed.Scrollbar.Y
+	isText := func(c color.RGBA) bool {
+		return c == style.Edit.TextNormal || c == style.Edit.TextHover || c == style.Edit.TextActive
+	}
+
+	out := make([]ncommand.Command, 0, len(cmds.Commands)-first)
+	lastLine, lastEnd := -1, 0
+
+	for _, cmd := range cmds.Commands[first:] {
+		if cmd.Kind != ncommand.TextCmd || cmd.Text.Face != style.Font || cmd.Rect.Y < y0 {
+			out = append(out, cmd)
+			continue
+		}
+		line := (cmd.Rect.Y - y0) / rowHeight
+		if line >= len(lineStarts) {
+			out = append(out, cmd)
+			continue
+		}
+		pos := lineStarts[line]
+		if line == lastLine {
+			pos = lastEnd
+		}
+		text := []rune(cmd.Text.String)
+		if pos+len(text) > len(ed.Buffer) || string(ed.Buffer[pos:pos+len(text)]) != cmd.Text.String {
+			lastLine = -1
+			out = append(out, cmd)
+			continue
+		}
+		lastLine, lastEnd = line, pos+len(text)
+		if !isText(cmd.Text.Foreground) {
+			out = append(out, cmd)
+			continue
+		}
+
+		x := cmd.Rect.X
+		for i := 0; i < len(text); {
+			end := pos + len(text)
+			var attr ansiAttr
+			if colors {
+				var attrEnd int
+				attr, attrEnd = scrollbackANSI.attrAt(pos + i)
+				if attrEnd >= 0 && attrEnd < end {
+					end = attrEnd
+				}
+			}
+			inMatch := false
+			if highlight {
+				var matchEnd int
+				inMatch, matchEnd = scrollbackFind.matchAt(pos + i)
+				if matchEnd >= 0 && matchEnd < end {
+					end = matchEnd
+				}
+			}
+			piece := string(text[i : end-pos])
+			face := style.Font
+			if attr.bold && boldFace != nil {
+				face = boldFace
+			}
+			c := cmd
+			c.Rect.X = x
+			c.Rect.W = nucular.FontWidth(style.Font, piece)
+			c.Text.String = piece
+			c.Text.Face = face
+			c.Text.Foreground = attr.color(cmd.Text.Foreground)
+			if inMatch {
+				var bg ncommand.Command
+				bg.Kind = ncommand.RectFilledCmd
+				bg.Rect = rect.Rect{X: c.Rect.X, Y: c.Rect.Y, W: c.Rect.W, H: nucular.FontHeight(style.Font)}
+				bg.RectFilled.Color = findHighlightColor
+				out = append(out, bg)
+				c.Text.Foreground = color.RGBA{0x00, 0x00, 0x00, 0xff}
+			}
+			out = append(out, c)
+			x += c.Rect.W
+			i = end - pos
+		}
+	}
+
+	cmds.Commands = append(cmds.Commands[:first], out...)
+}
+
+const timestampFormat = "15:04:05.000 "
+
+// timestampLines prefixes every line that starts in s with a timestamp,
+// atLineStart is true if the first character of s starts a line.
+func timestampLines(s string, atLineStart bool, t time.Time) string {
+	ts := t.Format(timestampFormat)
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		if atLineStart {
+			buf.WriteString(ts)
+		}
+		buf.WriteByte(s[i])
+		atLineStart = s[i] == '\n'
+	}
+	return buf.String()
+}
+
 func currentColumn(buf []rune) int {
 	for i := len(buf) - 1; i >= 0; i-- {
 		if buf[i] == '\n' {
@@ -79,3 +425,150 @@ func autowrappend(r, r1 []rune, ncols int) []rune {
 	}
 	return r
 }
+
+var findHighlightColor = color.RGBA{0xe5, 0xc0, 0x7b, 0xff}
+
+// scrollbackFinder is the find bar of the scrollback editor.
+type scrollbackFinder struct {
+	active  bool
+	ed      nucular.TextEditor
+	needle  string
+	buflen  int
+	matches []int // start of each match in scrollbackEditor.Buffer
+	n       int   // length of the needle
+	cur     int   // index in matches of the selected match, -1 if none
+}
+
+var scrollbackFind = scrollbackFinder{cur: -1}
+
+// findMatches returns the start of all the non-overlapping occurrences of
+// needle in buf, ignoring case.
+func findMatches(buf, needle []rune) []int {
+	if len(needle) == 0 {
+		return nil
+	}
+	var r []int
+	for i := 0; i+len(needle) <= len(buf); i++ {
+		match := true
+		for j := range needle {
+			if unicode.ToLower(buf[i+j]) != unicode.ToLower(needle[j]) {
+				match = false
+				break
+			}
+		}
+		if match {
+			r = append(r, i)
+			i += len(needle) - 1
+		}
+	}
+	return r
+}
+
+func (f *scrollbackFinder) open(mw nucular.MasterWindow) {
+	f.active = true
+	f.ed.Flags = nucular.EditSelectable | nucular.EditClipboard
+	f.ed.SelectStart, f.ed.SelectEnd = 0, len(f.ed.Buffer)
+	f.ed.Cursor = len(f.ed.Buffer)
+	mw.ActivateEditor(&f.ed)
+}
+
+func (f *scrollbackFinder) close(mw nucular.MasterWindow) {
+	f.active = false
+	f.cur = -1
+	mw.ActivateEditor(&commandLineEditor)
+}
+
+// update recomputes the matches if the needle or the contents of the
+// scrollback changed.
+func (f *scrollbackFinder) update() {
+	needle := string(f.ed.Buffer)
+	if needle == f.needle && len(scrollbackEditor.Buffer) == f.buflen {
+		return
+	}
+	if needle != f.needle {
+		f.cur = -1
+	}
+	f.needle = needle
+	f.buflen = len(scrollbackEditor.Buffer)
+	f.n = len(f.ed.Buffer)
+	f.matches = findMatches(scrollbackEditor.Buffer, f.ed.Buffer)
+	if f.cur >= len(f.matches) {
+		f.cur = -1
+	}
+}
+
+// jump selects the next (dir > 0) or previous (dir < 0) match.
+func (f *scrollbackFinder) jump(dir int) {
+	if len(f.matches) == 0 {
+		return
+	}
+	switch {
+	case f.cur < 0 && dir < 0:
+		f.cur = len(f.matches) - 1
+	case f.cur < 0:
+		f.cur = 0
+	default:
+		f.cur = (f.cur + dir + len(f.matches)) % len(f.matches)
+	}
+	ed := &scrollbackEditor
+	ed.SelectStart = f.matches[f.cur]
+	ed.SelectEnd = f.matches[f.cur] + f.n
+	ed.Cursor = ed.SelectEnd
+	ed.CursorFollow = true
+	ed.Redraw = true
+}
+
+// matchAt returns true if idx is inside a match and the index where the
+// current match ends or the next one starts.
+func (f *scrollbackFinder) matchAt(idx int) (bool, int) {
+	i := sort.Search(len(f.matches), func(i int) bool { return f.matches[i]+f.n > idx })
+	if i >= len(f.matches) {
+		return false, -1
+	}
+	if f.matches[i] > idx {
+		return false, f.matches[i]
+	}
+	return true, f.matches[i] + f.n
+}
+
+func findBar(w *nucular.Window) {
+	f := &scrollbackFind
+	mw := w.Master()
+	if f.ed.Active {
+		for _, k := range w.Input().Keyboard.Keys {
+			switch {
+			case k.Modifiers == 0 && k.Code == key.CodeReturnEnter:
+				f.jump(+1)
+			case k.Modifiers == key.ModShift && k.Code == key.CodeReturnEnter:
+				f.jump(-1)
+			case k.Modifiers == 0 && k.Code == key.CodeEscape:
+				f.close(mw)
+				return
+			}
+		}
+	}
+
+	w.Row(commandLineHeight).Static(50, 0, 100, 60, 60, 60)
+	w.Label("Find:", "LC")
+	f.ed.Edit(w)
+	f.update()
+	switch {
+	case f.needle == "":
+		w.Label("", "LC")
+	case len(f.matches) == 0:
+		w.Label("no matches", "LC")
+	case f.cur < 0:
+		w.Label(fmt.Sprintf("%d matches", len(f.matches)), "LC")
+	default:
+		w.Label(fmt.Sprintf("%d/%d", f.cur+1, len(f.matches)), "LC")
+	}
+	if w.ButtonText("Prev") {
+		f.jump(-1)
+	}
+	if w.ButtonText("Next") {
+		f.jump(+1)
+	}
+	if w.ButtonText("Close") {
+		f.close(mw)
+	}
+}
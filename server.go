@@ -2,17 +2,21 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aarzilli/gdlv/internal/dlvclient/service/api"
 	"github.com/aarzilli/gdlv/internal/dlvclient/service/rpc2"
+	"github.com/aarzilli/gdlv/internal/prettyprint"
 	"github.com/derekparker/delve/pkg/goversion"
 )
 
@@ -41,6 +45,10 @@ type ServerDescr struct {
 	// connection to delve failed
 	connectionFailed bool
 	debugid          string
+	// working directory of the inferior, passed to delve with --wd
+	workdir string
+	// working directory used the last time delve was started
+	launchWorkdir string
 }
 
 var RemoveExecutable bool = true
@@ -80,6 +88,8 @@ func parseArguments() (descr ServerDescr) {
 	}
 
 	opts := parseOptions(os.Args)
+	initCommands.path = opts.initScript
+	initCommands.continueOnError = opts.continueOnError
 
 	optflags := []string{"-gcflags", "-N -l"}
 	ver, _ := goversion.Installed()
@@ -188,7 +198,7 @@ func parseArguments() (descr ServerDescr) {
 			usage("can not use -d with 'core'")
 		}
 		descr.debugid, _ = filepath.Abs(opts.cmdArgs[0])
-		finish(true, "--headless", "core", opts.cmdArgs[0], opts.cmdArgs[1])
+		finish(false, "--headless", "core", opts.cmdArgs[0], opts.cmdArgs[1])
 
 	case "replay":
 		if !opts.defaultBackend {
@@ -225,7 +235,7 @@ func parseListenString(listenstr string) string {
 
 func (s *ServerDescr) Start() {
 	if s.connectString != "" {
-		s.connectTo()
+		s.connectTo(s.atStart)
 		return
 	}
 
@@ -270,7 +280,7 @@ func (descr *ServerDescr) stdoutProcess(lenient bool) {
 		if first {
 			if !lenient || strings.HasPrefix(scan.Text(), apiServerPrefix) {
 				descr.connectString = parseListenString(scan.Text())
-				descr.connectTo()
+				descr.connectTo(descr.atStart)
 				first = false
 			} else {
 				copyToScrollback()
@@ -329,7 +339,12 @@ func (descr *ServerDescr) Rebuild() {
 				lenient = true
 			}
 		}
-		cmd := exec.Command("dlv", descr.dlvargs...)
+		args := descr.dlvargs
+		if descr.workdir != "" {
+			args = append([]string{"--wd=" + descr.workdir}, args...)
+		}
+		descr.launchWorkdir = descr.workdir
+		cmd := exec.Command("dlv", args...)
 		descr.stdinChan = make(chan string, 10)
 		descr.stdin, _ = cmd.StdinPipe()
 		descr.stdout, _ = cmd.StdoutPipe()
@@ -345,6 +360,189 @@ func (descr *ServerDescr) Rebuild() {
 	}
 }
 
+// CanSetWorkdir returns true if the inferior is started by delve, and
+// therefore its working directory can be changed.
+func (descr *ServerDescr) CanSetWorkdir() bool {
+	for _, arg := range descr.dlvargs {
+		if arg == "exec" {
+			return true
+		}
+	}
+	return false
+}
+
+// IsCore returns true if the backend is reading a core file, in which
+// case the execution of the target can not be resumed.
+func (descr *ServerDescr) IsCore() bool {
+	for i, arg := range descr.dlvargs {
+		if arg == "--headless" {
+			// the subcommand always follows --headless
+			return i+1 < len(descr.dlvargs) && descr.dlvargs[i+1] == "core"
+		}
+	}
+	return false
+}
+
+// OpenCore stops the current backend and starts a new one reading
+// corefile, which must have been produced by executable exe.
+func (descr *ServerDescr) OpenCore(out io.Writer, exe, corefile string) error {
+	debugid, _ := filepath.Abs(exe)
+	fmt.Fprintf(out, "Opening core file %s\n", corefile)
+	return descr.switchTarget(debugid, "--headless", "core", exe, corefile)
+}
+
+// Attach stops the current backend and starts a new one attached to the
+// process with the specified pid.
+func (descr *ServerDescr) Attach(out io.Writer, pid int) error {
+	fmt.Fprintf(out, "Attaching to %d\n", pid)
+	return descr.switchTarget("", "--headless", "attach", strconv.Itoa(pid))
+}
+
+// switchTarget terminates the current debugging session and starts delve
+// with dlvargs.
+func (descr *ServerDescr) switchTarget(debugid string, dlvargs ...string) error {
+	if client != nil {
+		updateFrozenBreakpoints()
+		saveConfiguration()
+		if err := client.Detach(descr.atStart); err != nil {
+			return err
+		}
+	}
+	if descr.serverProcess != nil {
+		descr.serverProcess.Wait()
+		descr.serverProcess = nil
+	}
+	wnd.Lock()
+	client = nil
+	wnd.Unlock()
+
+	descr.connectString = ""
+	descr.connectionFailed = false
+	descr.buildcmd = nil
+	descr.workdir = ""
+	descr.atStart = false
+	descr.dlvargs = dlvargs
+	descr.debugid = debugid
+
+	FrozenBreakpoints = FrozenBreakpoints[:0]
+	DisabledBreakpoints = DisabledBreakpoints[:0]
+	MonitoredExpressions = MonitoredExpressions[:0]
+	if debugid != "" {
+		FrozenBreakpoints = append(FrozenBreakpoints, conf.FrozenBreakpoints[debugid]...)
+		DisabledBreakpoints = append(DisabledBreakpoints, conf.DisabledBreakpoints[debugid]...)
+		MonitoredExpressions = append(MonitoredExpressions, conf.MonitoredExpressions[debugid]...)
+	}
+
+	descr.Rebuild()
+	return nil
+}
+
+type processInfo struct {
+	pid  int
+	name string
+}
+
+// listProcesses returns the list of processes running on this machine,
+// except for gdlv itself.
+func listProcesses() ([]processInfo, error) {
+	out, err := exec.Command("ps", "-A", "-o", "pid=,comm=").Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not list processes: %v", err)
+	}
+	return parseProcessList(string(out), os.Getpid()), nil
+}
+
+// parseProcessList parses the output of ps, skipping the process with pid
+// self.
+func parseProcessList(out string, self int) []processInfo {
+	r := []processInfo{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil || pid == self {
+			continue
+		}
+		r = append(r, processInfo{pid, strings.TrimSpace(fields[1])})
+	}
+	return r
+}
+
+// matchProcesses returns the processes whose name matches re.
+func matchProcesses(procs []processInfo, re *regexp.Regexp) []processInfo {
+	r := []processInfo{}
+	for _, p := range procs {
+		if re.MatchString(p.name) {
+			r = append(r, p)
+		}
+	}
+	return r
+}
+
+// Reconnect drops the current connection to delve and dials the same
+// address again, this is used to recover from a dropped connection or a
+// restarted headless server.
+func (descr *ServerDescr) Reconnect(out io.Writer) error {
+	if descr.connectString == "" {
+		return errors.New("no server address to reconnect to")
+	}
+	if client != nil {
+		if _, err := client.GetStateNonBlocking(); err == nil {
+			if !client.IsMulticlient() {
+				return errors.New("connection still active and the server does not accept multiple clients")
+			}
+			// the server keeps its breakpoints, clear them so that the
+			// frozen breakpoints can be restored without duplicates.
+			updateFrozenBreakpoints()
+			clearFrozenBreakpoints()
+		}
+		client.Disconnect(false)
+	}
+	wnd.Lock()
+	client = nil
+	wnd.Unlock()
+
+	descr.connectionFailed = false
+	fmt.Fprintf(out, "Reconnecting to %s\n", descr.connectString)
+	descr.connectTo(false)
+	if client == nil {
+		return errors.New("could not reconnect")
+	}
+	return nil
+}
+
+// Relaunch kills the inferior and delve and starts them again, this is
+// necessary to change the working directory of the inferior.
+// If resetArgs is set the arguments of the inferior are replaced by args.
+func (descr *ServerDescr) Relaunch(out io.Writer, resetArgs bool, args []string) error {
+	updateFrozenBreakpoints()
+	if err := client.Detach(true); err != nil {
+		return err
+	}
+	if descr.serverProcess != nil {
+		descr.serverProcess.Wait()
+		descr.serverProcess = nil
+	}
+	wnd.Lock()
+	client = nil
+	wnd.Unlock()
+
+	if resetArgs {
+		for i := range descr.dlvargs {
+			if descr.dlvargs[i] == "--" {
+				descr.dlvargs = append(descr.dlvargs[:i+1], args...)
+				break
+			}
+		}
+	}
+
+	fmt.Fprintf(out, "Restarting delve with working directory %q\n", descr.workdir)
+	descr.Rebuild()
+	return nil
+}
+
 func (descr *ServerDescr) StaleExecutable() bool {
 	if descr.buildcmd == nil {
 		return false
@@ -361,7 +559,9 @@ func (descr *ServerDescr) StaleExecutable() bool {
 	return false
 }
 
-func (descr *ServerDescr) connectTo() {
+// connectTo connects to the delve server at connectString, if contToMain
+// is set the target is then continued to the startup function.
+func (descr *ServerDescr) connectTo(contToMain bool) {
 	var scrollbackOut = editorWriter{&scrollbackEditor, true}
 
 	if descr.connectString == "" {
@@ -394,9 +594,13 @@ func (descr *ServerDescr) connectTo() {
 		fmt.Fprintf(&scrollbackOut, "Could not connect\n")
 	}
 
-	restoreFrozenBreakpoints(&scrollbackOut)
+	if !descr.IsCore() {
+		// breakpoints can not be set on a core file, restoring them would
+		// also forget all frozen breakpoints.
+		restoreFrozenBreakpoints(&scrollbackOut)
+	}
 
-	finishRestart(&scrollbackOut, descr.atStart)
+	finishRestart(&scrollbackOut, contToMain)
 
 	state, err := client.GetState()
 	if err == nil && state == nil {
@@ -407,6 +611,10 @@ func (descr *ServerDescr) connectTo() {
 	}
 
 	refreshState(refreshToFrameZero, clearStop, state)
+
+	if client != nil {
+		go runInitCommands()
+	}
 }
 
 func continueToRuntimeMain() {
@@ -439,6 +647,8 @@ func finishRestart(out io.Writer, contToMain bool) {
 		ScheduledBreakpoints = ScheduledBreakpoints[:0]
 	}
 
+	restoreMonitoredExpressions()
+
 	if contToMain {
 		continueToRuntimeMain()
 	}
@@ -448,6 +658,9 @@ func loadProgramInfo(out io.Writer) {
 	fmt.Fprintf(out, "Loading program info...")
 
 	var err error
+	clearEnumCache()
+	prettyprint.ClearShortenTypeCache()
+	loadTargetIntSize()
 	funcsPanel.slice, err = client.ListFunctions("")
 	if err != nil {
 		fmt.Fprintf(out, "Could not list functions: %v\n", err)
@@ -8,9 +8,11 @@ import (
 	"image"
 	"image/color"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
+	"github.com/aarzilli/gdlv/internal/dlvclient/service/api"
 	"github.com/aarzilli/nucular"
 	"github.com/aarzilli/nucular/label"
 	"github.com/aarzilli/nucular/rect"
@@ -32,6 +34,9 @@ const (
 	infoTypes         = "Types"
 	infoCheckpoints   = "Checkpoints"
 	infoDeferredCalls = "DeferredCalls"
+	infoHistory       = "History"
+	infoWatches       = "Watches"
+	infoStackTree     = "Stacks"
 )
 
 type infoPanel struct {
@@ -43,7 +48,7 @@ type infoPanel struct {
 var infoNameToPanel map[string]infoPanel
 
 var infoModes = []string{
-	infoCommand, infoListing, infoDisassembly, infoGoroutines, infoStacktrace, infoLocals, infoGlobal, infoBps, infoThreads, infoRegisters, infoSources, infoFuncs, infoTypes, infoCheckpoints, infoDeferredCalls,
+	infoCommand, infoListing, infoDisassembly, infoGoroutines, infoStacktrace, infoLocals, infoGlobal, infoBps, infoThreads, infoRegisters, infoSources, infoFuncs, infoTypes, infoCheckpoints, infoDeferredCalls, infoHistory, infoWatches, infoStackTree,
 }
 
 var codeToInfoMode = map[byte]string{
@@ -62,6 +67,9 @@ var codeToInfoMode = map[byte]string{
 	'T': infoThreads,
 	'k': infoCheckpoints,
 	'd': infoDeferredCalls,
+	'h': infoHistory,
+	'w': infoWatches,
+	'A': infoStackTree,
 }
 
 var infoModeToCode = map[string]byte{}
@@ -84,6 +92,9 @@ func init() {
 	infoNameToPanel[infoTypes] = infoPanel{typesPanel.update, nucular.WindowNoScrollbar, nil}
 	infoNameToPanel[infoCheckpoints] = infoPanel{updateCheckpoints, 0, &checkpointsPanel.asyncLoad}
 	infoNameToPanel[infoDeferredCalls] = infoPanel{updateDeferredCalls, 0, &stackPanel.asyncLoad}
+	infoNameToPanel[infoHistory] = infoPanel{updateHistory, nucular.WindowNoScrollbar, nil}
+	infoNameToPanel[infoWatches] = infoPanel{updateWatches, 0, nil}
+	infoNameToPanel[infoStackTree] = infoPanel{updateStackTree, 0, &stackTreePanel.asyncLoad}
 
 	for k, v := range codeToInfoMode {
 		infoModeToCode[v] = k
@@ -96,8 +107,8 @@ const (
 	controlBtnWidth = 30
 )
 
-func loadPanelDescrToplevel(in string) {
-	var width, height int
+// splitLayoutSize removes the window size prefix from a serialized layout.
+func splitLayoutSize(in string) (width, height int, rest string) {
 	if len(in) > 3 {
 		if in[0] == '$' {
 			if dollar := strings.Index(in[1:], "$"); dollar >= 0 {
@@ -110,6 +121,11 @@ func loadPanelDescrToplevel(in string) {
 			}
 		}
 	}
+	return width, height, in
+}
+
+func loadPanelDescrToplevel(in string) {
+	width, height, in := splitLayoutSize(in)
 	if width <= 0 || height <= 0 {
 		width = 640
 		height = 480
@@ -120,18 +136,40 @@ func loadPanelDescrToplevel(in string) {
 		setupStyle()
 	}
 
-	in = loadPanelDescr(in, wnd.ResetWindows())
+	in, err := loadPanelDescr(in, wnd.ResetWindows(), false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "deserialization error: %v\n", err)
+		return
+	}
 
-	loadFloatingDescr(in)
+	if err := loadFloatingDescr(in, false); err != nil {
+		fmt.Fprintf(os.Stderr, "deserialization error: %v\n", err)
+	}
 
 	return
 }
 
-func loadPanelDescr(in string, curDockSplit *nucular.DockSplit) (rest string) {
+// checkLayout returns an error if in can not be loaded by
+// loadPanelDescrToplevel.
+func checkLayout(in string) error {
+	_, _, in = splitLayoutSize(in)
+	rest, err := loadPanelDescr(in, nil, true)
+	if err != nil {
+		return err
+	}
+	return loadFloatingDescr(rest, true)
+}
+
+// loadPanelDescr opens the docked panels described by in inside
+// curDockSplit. If dryRun is set the description is only validated and no
+// panel is opened.
+func loadPanelDescr(in string, curDockSplit *nucular.DockSplit, dryRun bool) (rest string, err error) {
+	if len(in) == 0 {
+		return "", fmt.Errorf("unexpected end of layout")
+	}
 	switch in[0] {
 	case '0':
-		rest = loadPanelDescr(in[1:], curDockSplit)
-		return rest
+		return loadPanelDescr(in[1:], curDockSplit, dryRun)
 	case '_', '|':
 		horiz := true
 		if in[0] == '|' {
@@ -143,28 +181,41 @@ func loadPanelDescr(in string, curDockSplit *nucular.DockSplit) (rest string) {
 				break
 			}
 		}
-		size, _ := strconv.Atoi(in[1:i])
+		size, err := strconv.Atoi(in[1:i])
+		if err != nil {
+			return "", fmt.Errorf("bad split size in %q", in)
+		}
 
-		left, right := curDockSplit.Split(horiz, size)
+		var left, right *nucular.DockSplit
+		if !dryRun {
+			left, right = curDockSplit.Split(horiz, size)
+		}
 
 		rest = in[i:]
-		rest = loadPanelDescr(rest, left)
-		rest = loadPanelDescr(rest, right)
-		return rest
+		rest, err = loadPanelDescr(rest, left, dryRun)
+		if err != nil {
+			return "", err
+		}
+		return loadPanelDescr(rest, right, dryRun)
 	default:
-		m := codeToInfoMode[in[0]]
-		p := infoNameToPanel[m]
-		curDockSplit.Open(m, p.Flags(m), rect.Rect{0, 0, 500, 300}, true, p.update)
-		rest = in[1:]
-		return rest
+		m, ok := codeToInfoMode[in[0]]
+		if !ok {
+			return "", fmt.Errorf("unknown panel %q", in[0])
+		}
+		if !dryRun {
+			p := infoNameToPanel[m]
+			curDockSplit.Open(m, p.Flags(m), rect.Rect{0, 0, 500, 300}, true, p.update)
+		}
+		return in[1:], nil
 	}
 }
 
-func loadFloatingDescr(rest string) {
+// loadFloatingDescr opens the floating windows described by rest. If
+// dryRun is set the description is only validated and no window is opened.
+func loadFloatingDescr(rest string, dryRun bool) error {
 	for len(rest) > 0 {
 		if rest[0] != ',' {
-			fmt.Fprintf(os.Stderr, "deserialization error: %q\n", rest)
-			return
+			return fmt.Errorf("bad floating window description %q", rest)
 		}
 
 		rest = rest[1:]
@@ -172,28 +223,32 @@ func loadFloatingDescr(rest string) {
 		var dim [4]int
 
 		for i := 0; i < len(dim); i++ {
-			for j := 0; j < len(rest); j++ {
-				if rest[j] < '0' || rest[j] > '9' {
-					var err error
-					dim[i], err = strconv.Atoi(rest[:j])
-					if err != nil {
-						fmt.Fprintf(os.Stderr, "deserialization error (%v): %q\n", err, rest)
-					}
-					if i == len(dim)-1 {
-						rest = rest[j:]
-					} else {
-						rest = rest[j+1:]
-					}
-					break
-				}
+			j := 0
+			for j < len(rest) && rest[j] >= '0' && rest[j] <= '9' {
+				j++
+			}
+			if j == 0 || j >= len(rest) || (i < len(dim)-1 && rest[j] != ',') {
+				return fmt.Errorf("bad floating window dimensions %q", rest)
+			}
+			dim[i], _ = strconv.Atoi(rest[:j])
+			if i == len(dim)-1 {
+				rest = rest[j:]
+			} else {
+				rest = rest[j+1:]
 			}
 		}
 
-		m := codeToInfoMode[rest[0]]
-		p := infoNameToPanel[m]
+		m, ok := codeToInfoMode[rest[0]]
+		if !ok {
+			return fmt.Errorf("unknown panel %q", rest[0])
+		}
 		rest = rest[1:]
-		wnd.PopupOpen(m, p.Flags(m), rect.Rect{dim[0], dim[1], dim[2], dim[3]}, true, p.update)
+		if !dryRun {
+			p := infoNameToPanel[m]
+			wnd.PopupOpen(m, p.Flags(m), rect.Rect{dim[0], dim[1], dim[2], dim[3]}, true, p.update)
+		}
 	}
+	return nil
 }
 
 func cleanWindowTitle(title string) string {
@@ -276,6 +331,40 @@ func listingToolbar(sw *nucular.Window) {
 		sw.Label(listingPanel.abbrevFile, "LC")
 	}
 
+	if len(listingPanel.tabs) > 1 {
+		listingTabs(sw)
+	}
+}
+
+// listingTabs draws a tab for each recently viewed file.
+func listingTabs(sw *nucular.Window) {
+	style := sw.Master().Style()
+	sw.Row(headerRow).Static()
+	closeIdx := -1
+	for i, tab := range listingPanel.tabs {
+		name := filepath.Base(tab.file)
+		selected := tab.file == listingPanel.file
+		sw.LayoutSetWidthScaled(nucular.FontWidth(style.Font, name) + style.Selectable.Padding.X*2)
+		if sw.SelectableLabel(name, "CC", &selected) && tab.file != listingPanel.file {
+			listingPanel.pinnedLoc = &api.Location{File: tab.file, Line: tab.line}
+			go refreshState(refreshToSameFrame, clearNothing, nil)
+		}
+		if sw.Input().Mouse.HoveringRect(sw.LastWidgetBounds) {
+			sw.Tooltip(tab.file)
+		}
+		sw.LayoutSetWidth(20)
+		if sw.ButtonText("x") {
+			closeIdx = i
+		}
+	}
+	if closeIdx >= 0 {
+		tab := listingPanel.tabs[closeIdx]
+		listingPanel.tabs = append(listingPanel.tabs[:closeIdx], listingPanel.tabs[closeIdx+1:]...)
+		if tab.file == listingPanel.file && listingPanel.pinnedLoc != nil {
+			listingPanel.pinnedLoc = nil
+			go refreshState(refreshToSameFrame, clearNothing, nil)
+		}
+	}
 }
 
 func commandToolbar(sw *nucular.Window) {
@@ -337,6 +426,13 @@ func commandToolbar(sw *nucular.Window) {
 		cmdbtn(stepoutIconChar, "stepout")
 	}
 
+	if gid := interruptedGid; gid >= 0 && gid != curGid && client != nil && !scriptRunning && !client.Running() {
+		sw.LayoutSetWidth(150)
+		if sw.ButtonText(fmt.Sprintf("back to goroutine %d", gid)) {
+			go switchToInterruptedGoroutine()
+		}
+	}
+
 	sw.LayoutSetWidth(100)
 	sw.Label(hovering, "LC")
 
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aarzilli/nucular"
+
+	"github.com/aarzilli/gdlv/internal/dlvclient/service/api"
+)
+
+const stackTreeDepth = 50
+
+// stackTreePanel shows the stacks of all goroutines as a tree, goroutines
+// that share the same topmost frames are collapsed into a single node.
+// Stacks are only loaded when a node is expanded.
+var stackTreePanel = struct {
+	asyncLoad  asyncLoad
+	goroutines map[int]*api.Goroutine
+	gids       []int
+
+	mu      sync.Mutex
+	stacks  map[int][]api.Stackframe
+	loading bool
+}{}
+
+func init() {
+	stackTreePanel.asyncLoad.load = loadStackTree
+}
+
+// stackGroup is a set of goroutines that have the same frame at some depth.
+type stackGroup struct {
+	key  string
+	loc  api.Location
+	gids []int
+}
+
+func stackFrameKey(loc api.Location) string {
+	return fmt.Sprintf("%s %s:%d", loc.Function.Name(), loc.File, loc.Line)
+}
+
+// groupGoroutinesByFrame groups gids by the location returned by frameAt,
+// goroutines for which frameAt returns false are returned separately. The
+// largest groups come first.
+func groupGoroutinesByFrame(gids []int, frameAt func(gid int) (api.Location, bool)) (groups []*stackGroup, rest []int) {
+	m := map[string]*stackGroup{}
+	for _, gid := range gids {
+		loc, ok := frameAt(gid)
+		if !ok {
+			rest = append(rest, gid)
+			continue
+		}
+		key := stackFrameKey(loc)
+		grp := m[key]
+		if grp == nil {
+			grp = &stackGroup{key: key, loc: loc}
+			m[key] = grp
+			groups = append(groups, grp)
+		}
+		grp.gids = append(grp.gids, gid)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if len(groups[i].gids) != len(groups[j].gids) {
+			return len(groups[i].gids) > len(groups[j].gids)
+		}
+		return groups[i].key < groups[j].key
+	})
+	return groups, rest
+}
+
+func loadStackTree(p *asyncLoad) {
+	gs, err := client.ListGoroutines(0, 0)
+	if err != nil {
+		p.done(err)
+		return
+	}
+	sort.Sort(goroutinesByID(gs))
+	stackTreePanel.goroutines = make(map[int]*api.Goroutine, len(gs))
+	stackTreePanel.gids = stackTreePanel.gids[:0]
+	for _, g := range gs {
+		stackTreePanel.goroutines[g.ID] = g
+		stackTreePanel.gids = append(stackTreePanel.gids, g.ID)
+	}
+	stackTreePanel.mu.Lock()
+	stackTreePanel.stacks = map[int][]api.Stackframe{}
+	stackTreePanel.mu.Unlock()
+	p.done(nil)
+}
+
+// stackTreeStacks returns the stacks of gids, if some of them have not been
+// loaded yet it starts loading them and returns false. The returned map is
+// a copy that can be used without holding stackTreePanel.mu.
+func stackTreeStacks(gids []int) (map[int][]api.Stackframe, bool) {
+	stackTreePanel.mu.Lock()
+	defer stackTreePanel.mu.Unlock()
+	var missing []int
+	for _, gid := range gids {
+		if _, ok := stackTreePanel.stacks[gid]; !ok {
+			missing = append(missing, gid)
+		}
+	}
+	if len(missing) == 0 {
+		r := make(map[int][]api.Stackframe, len(gids))
+		for _, gid := range gids {
+			r[gid] = stackTreePanel.stacks[gid]
+		}
+		return r, true
+	}
+	if !stackTreePanel.loading && !client.Running() {
+		stackTreePanel.loading = true
+		stacks := stackTreePanel.stacks
+		go func() {
+			loaded := make(map[int][]api.Stackframe, len(missing))
+			for _, gid := range missing {
+				frames, err := client.Stacktrace(gid, stackTreeDepth, false, nil)
+				if err != nil {
+					frames = []api.Stackframe{}
+				}
+				loaded[gid] = frames
+			}
+			stackTreePanel.mu.Lock()
+			for gid, frames := range loaded {
+				stacks[gid] = frames
+			}
+			stackTreePanel.loading = false
+			stackTreePanel.mu.Unlock()
+			wnd.Changed()
+		}()
+	}
+	return nil, false
+}
+
+func updateStackTree(container *nucular.Window) {
+	w := stackTreePanel.asyncLoad.showRequest(container)
+	if w == nil {
+		return
+	}
+
+	groups, _ := groupGoroutinesByFrame(stackTreePanel.gids, func(gid int) (api.Location, bool) {
+		return stackTreePanel.goroutines[gid].CurrentLoc, true
+	})
+	w.Row(varRowHeight).Dynamic(1)
+	w.Label(fmt.Sprintf("%d goroutines, %d distinct locations", len(stackTreePanel.gids), len(groups)), "LC")
+	for _, grp := range groups {
+		showStackGroup(w, grp, 0, "stacks")
+	}
+}
+
+func showStackGroup(w *nucular.Window, grp *stackGroup, depth int, path string) {
+	path = path + "/" + grp.key
+	lbl := fmt.Sprintf("%d goroutines: %s", len(grp.gids), strings.Replace(formatLocation2(grp.loc), "\n", " ", -1))
+	if len(grp.gids) == 1 {
+		lbl = fmt.Sprintf("goroutine %d: %s", grp.gids[0], strings.Replace(formatLocation2(grp.loc), "\n", " ", -1))
+	}
+	if !w.TreePushNamed(nucular.TreeNode, path, lbl, false) {
+		return
+	}
+	defer w.TreePop()
+
+	stacks, ok := stackTreeStacks(grp.gids)
+	if !ok {
+		w.Row(varRowHeight).Dynamic(1)
+		w.Label("Loading...", "LC")
+		return
+	}
+
+	children, rest := groupGoroutinesByFrame(grp.gids, func(gid int) (api.Location, bool) {
+		if depth+1 < len(stacks[gid]) {
+			return stacks[gid][depth+1].Location, true
+		}
+		return api.Location{}, false
+	})
+	if len(rest) > 0 {
+		w.Row(varRowHeight).Dynamic(1)
+		w.Label(fmt.Sprintf("Stack ends for goroutines %s", formatGoroutineIDs(rest)), "LC")
+	}
+	for _, child := range children {
+		showStackGroup(w, child, depth+1, path)
+	}
+}
+
+func formatGoroutineIDs(gids []int) string {
+	v := make([]string, len(gids))
+	for i := range gids {
+		v[i] = fmt.Sprintf("%d", gids[i])
+	}
+	return strings.Join(v, ", ")
+}
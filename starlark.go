@@ -72,6 +72,38 @@ func (s starlarkContext) LoadConfig() api.LoadConfig {
 	return getVariableLoadConfig()
 }
 
+func (s starlarkContext) EvalScopedExpr(expr string) *api.Variable {
+	return evalScopedExpr(expr, getVariableLoadConfig())
+}
+
+func (s starlarkContext) CreateBreakpoint(bp *api.Breakpoint) (*api.Breakpoint, error) {
+	defer refreshState(refreshToSameFrame, clearBreakpoint, nil)
+	out := editorWriter{&scrollbackEditor, true}
+	bp, err := client.CreateBreakpoint(bp)
+	if err != nil {
+		return nil, err
+	}
+	freezeBreakpoint(&out, bp)
+	return bp, nil
+}
+
+func (s starlarkContext) ClearBreakpoint(id int, name string) (*api.Breakpoint, error) {
+	defer refreshState(refreshToSameFrame, clearBreakpoint, nil)
+	var bp *api.Breakpoint
+	var err error
+	if name != "" {
+		bp, err = client.ClearBreakpointByName(name)
+	} else {
+		bp, err = client.ClearBreakpoint(id)
+	}
+	removeFrozenBreakpoint(bp)
+	if err != nil {
+		return nil, err
+	}
+	forgetBreakpoint(bp.ID)
+	return bp, nil
+}
+
 const defaultInitFile = `
 def command_find_array(arr, pred):
 	"""Calls pred for each element of the array or slice 'arr' returns the index of
@@ -10,7 +10,12 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/aarzilli/nucular"
+	"github.com/aarzilli/nucular/rect"
+
 	"github.com/aarzilli/gdlv/internal/dlvclient/service/api"
+
+	"golang.org/x/mobile/event/key"
 )
 
 type stmtsInLocVisitor struct {
@@ -369,3 +374,73 @@ func (sii *stepIntoInfo) Config(filename string, lineno, colno int) bool {
 	}
 	return false
 }
+
+type stepIntoChooser struct {
+	sics     []stepIntoCall
+	selected int
+}
+
+// openStepIntoChooser opens a popup listing the calls that can be stepped
+// into from the current line. A call can be picked with the mouse, by
+// pressing its number or with the arrow keys followed by enter.
+func openStepIntoChooser(mw nucular.MasterWindow) {
+	out := editorWriter{&scrollbackEditor, true}
+	sics, pc, err := currentStepIntoCalls()
+	if err != nil {
+		fmt.Fprintf(&out, "Could not list calls: %v\n", err)
+		return
+	}
+	sc := &stepIntoChooser{}
+	for _, sic := range sics {
+		if sic.Inst.Loc.PC >= pc {
+			sc.sics = append(sc.sics, sic)
+		}
+	}
+	if len(sc.sics) == 0 {
+		fmt.Fprintf(&out, "No calls to step into on the current line\n")
+		return
+	}
+	mw.PopupOpen("Step into...", dynamicPopupFlags|nucular.WindowClosable, rect.Rect{100, 100, 500, 400}, true, sc.update)
+}
+
+func (sc *stepIntoChooser) update(w *nucular.Window) {
+	chosen := -1
+	for _, e := range w.Input().Keyboard.Keys {
+		switch {
+		case e.Modifiers == 0 && e.Code >= key.Code1 && e.Code <= key.Code9:
+			if i := int(e.Code - key.Code1); i < len(sc.sics) {
+				chosen = i
+			}
+		case e.Modifiers == 0 && e.Code == key.CodeUpArrow:
+			if sc.selected > 0 {
+				sc.selected--
+			}
+		case e.Modifiers == 0 && e.Code == key.CodeDownArrow:
+			if sc.selected < len(sc.sics)-1 {
+				sc.selected++
+			}
+		case e.Modifiers == 0 && (e.Code == key.CodeReturnEnter || e.Code == key.CodeKeypadEnter):
+			chosen = sc.selected
+		case e.Modifiers == 0 && e.Code == key.CodeEscape:
+			w.Close()
+			return
+		}
+	}
+
+	w.Row(20).Dynamic(1)
+	for i := range sc.sics {
+		selected := i == sc.selected
+		prefix := "  "
+		if i < 9 {
+			prefix = fmt.Sprintf("%d.", i+1)
+		}
+		if w.SelectableLabel(fmt.Sprintf("%s %s\t%s", prefix, sc.sics[i].Name, sc.sics[i].ExprString()), "LC", &selected) {
+			chosen = i
+		}
+	}
+
+	if chosen >= 0 {
+		w.Close()
+		go stepInto(&editorWriter{&scrollbackEditor, true}, sc.sics[chosen])
+	}
+}
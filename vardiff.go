@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"reflect"
+	"sync"
+
+	"github.com/aarzilli/nucular"
+	"github.com/aarzilli/nucular/rect"
+
+	"github.com/aarzilli/gdlv/internal/dlvclient/service/api"
+	"github.com/aarzilli/gdlv/internal/prettyprint"
+)
+
+// varSnapshots contains the values captured with the "Snapshot" action of
+// the expression menu, indexed by expression.
+var varSnapshots = map[string]*api.Variable{}
+var varSnapshotsMu sync.Mutex
+
+// snapshotLoadConfig is used to load both sides of a comparison, it loads
+// variables deeply so that nested fields can be compared.
+var snapshotLoadConfig = api.LoadConfig{FollowPointers: true, MaxVariableRecurse: 5, MaxStringLen: 256, MaxArrayValues: 256, MaxStructFields: -1}
+
+var varDiffChangedColor = color.RGBA{0xff, 0x80, 0x00, 0xff}
+
+// varDiff is a node of the comparison between two values of a variable.
+type varDiff struct {
+	Name     string
+	Old, New string // single line representation of the values, empty if missing
+	Changed  bool
+	Children []*varDiff
+}
+
+func takeVarSnapshot(expr string) {
+	out := editorWriter{&scrollbackEditor, true}
+	v := evalScopedExpr(expr, snapshotLoadConfig)
+	if v.Unreadable != "" {
+		fmt.Fprintf(&out, "Could not take snapshot of %s: %s\n", expr, v.Unreadable)
+		return
+	}
+	varSnapshotsMu.Lock()
+	varSnapshots[expr] = v
+	varSnapshotsMu.Unlock()
+	fmt.Fprintf(&out, "Snapshot of %s taken\n", expr)
+}
+
+func hasVarSnapshot(expr string) bool {
+	varSnapshotsMu.Lock()
+	defer varSnapshotsMu.Unlock()
+	_, ok := varSnapshots[expr]
+	return ok
+}
+
+// diffVariables compares two values of a variable, children of structs are
+// matched by field name, children of arrays and slices by index and
+// children of maps by key.
+func diffVariables(name string, old, new *api.Variable) *varDiff {
+	d := &varDiff{Name: name}
+	if old != nil {
+		d.Old = prettyprint.Singleline(old, false, false)
+	}
+	if new != nil {
+		d.New = prettyprint.Singleline(new, false, false)
+	}
+	d.Changed = old == nil || new == nil || d.Old != d.New
+
+	oldch, oldnames := varDiffChildren(old)
+	newch, newnames := varDiffChildren(new)
+	for _, n := range newnames {
+		d.Children = append(d.Children, diffVariables(n, oldch[n], newch[n]))
+	}
+	for _, n := range oldnames {
+		if _, ok := newch[n]; !ok {
+			d.Children = append(d.Children, diffVariables(n, oldch[n], nil))
+		}
+	}
+	for _, c := range d.Children {
+		if c.Changed {
+			d.Changed = true
+		}
+	}
+	return d
+}
+
+// varDiffChildren returns the children of v indexed by the name used to
+// match them with the children of another value of the same variable.
+func varDiffChildren(v *api.Variable) (map[string]*api.Variable, []string) {
+	if v == nil || v.Unreadable != "" {
+		return nil, nil
+	}
+	r := map[string]*api.Variable{}
+	names := []string{}
+	add := func(name string, c *api.Variable) {
+		r[name] = c
+		names = append(names, name)
+	}
+	switch v.Kind {
+	case reflect.Struct:
+		for i := range v.Children {
+			add(v.Children[i].Name, &v.Children[i])
+		}
+	case reflect.Array, reflect.Slice:
+		for i := range v.Children {
+			add(fmt.Sprintf("[%d]", i), &v.Children[i])
+		}
+	case reflect.Map:
+		for i := 0; i+1 < len(v.Children); i += 2 {
+			add(fmt.Sprintf("[%s]", prettyprint.Singleline(&v.Children[i], false, false)), &v.Children[i+1])
+		}
+	case reflect.Ptr, reflect.Interface:
+		if len(v.Children) > 0 && v.Children[0].Kind != reflect.Invalid {
+			add("*", &v.Children[0])
+		}
+	}
+	return r, names
+}
+
+type varDiffViewer struct {
+	expr string
+	diff *varDiff
+}
+
+func newVarDiffViewer(mw nucular.MasterWindow, expr string) {
+	varSnapshotsMu.Lock()
+	old := varSnapshots[expr]
+	varSnapshotsMu.Unlock()
+	if old == nil {
+		return
+	}
+	go func() {
+		cur := evalScopedExpr(expr, snapshotLoadConfig)
+		vd := &varDiffViewer{expr: expr, diff: diffVariables(expr, old, cur)}
+		mw.PopupOpen(fmt.Sprintf("Compare %s", expr), popupFlags|nucular.WindowNonmodal|nucular.WindowScalable|nucular.WindowClosable, rect.Rect{100, 100, 700, 500}, true, vd.Update)
+		mw.Changed()
+	}()
+}
+
+func (vd *varDiffViewer) Update(w *nucular.Window) {
+	w.Row(varRowHeight).Ratio(0.3, 0.35, 0.35)
+	w.Label("Name", "LC")
+	w.Label("Snapshot", "LC")
+	w.Label("Current", "LC")
+	showVarDiff(w, vd.diff, vd.expr)
+}
+
+func showVarDiff(w *nucular.Window, d *varDiff, path string) {
+	if len(d.Children) == 0 {
+		w.Row(varRowHeight).Ratio(0.3, 0.35, 0.35)
+		w.Label(d.Name, "LC")
+		if d.Changed {
+			w.LabelColored(d.Old, "LC", varDiffChangedColor)
+			w.LabelColored(d.New, "LC", varDiffChangedColor)
+		} else {
+			w.Label(d.Old, "LC")
+			w.Label(d.New, "LC")
+		}
+		return
+	}
+
+	title := d.Name
+	if d.Changed {
+		title += " (changed)"
+	}
+	if w.TreePushNamed(nucular.TreeNode, path, title, d.Changed) {
+		for _, c := range d.Children {
+			showVarDiff(w, c, path+"/"+c.Name)
+		}
+		w.TreePop()
+	}
+}